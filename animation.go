@@ -0,0 +1,349 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// Disposal 帧显示后对画布的处理
+type Disposal uint8
+
+// Disposal
+const (
+	DisposeNone       Disposal = iota // 保留
+	DisposeBackground                 // 清除为透明
+	DisposePrevious                   // 恢复到绘制前
+)
+
+// Frame 动画帧
+type Frame struct {
+	Image    image.Image // Bounds 为在画布中的位置
+	Delay    int         // 显示时长, 毫秒
+	Disposal Disposal
+	Blend    bool // 是否与画布混合, 否则直接覆盖
+}
+
+// Animation 与格式无关的动画
+type Animation struct {
+	Width, Height int // 画布大小
+	Frames        []Frame
+	LoopCount     int // 播放次数, 0 为无限循环
+}
+
+// decodeGIFAnimation 读取 GIF 的全部帧
+func decodeGIFAnimation(r io.Reader) (*Animation, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	a := &Animation{Width: g.Config.Width, Height: g.Config.Height}
+	switch {
+	case g.LoopCount == 0:
+		a.LoopCount = 0
+	case g.LoopCount < 0:
+		a.LoopCount = 1
+	default:
+		a.LoopCount = g.LoopCount + 1
+	}
+	for i, m := range g.Image {
+		f := Frame{Image: m, Blend: true}
+		if i < len(g.Delay) {
+			f.Delay = g.Delay[i] * 10
+		}
+		if i < len(g.Disposal) {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				f.Disposal = DisposeBackground
+			case gif.DisposalPrevious:
+				f.Disposal = DisposePrevious
+			}
+		}
+		a.Frames = append(a.Frames, f)
+	}
+	return a, nil
+}
+
+// Composite 依次把每一帧绘制到画布上, canvas 会被复用, fn 需要保留时应复制
+func (a *Animation) Composite(fn func(i int, canvas *image.RGBA) error) error {
+	canvas := image.NewRGBA(image.Rect(0, 0, a.Width, a.Height))
+	var prev *image.RGBA
+	for i, f := range a.Frames {
+		b := f.Image.Bounds().Intersect(canvas.Bounds())
+		if f.Disposal == DisposePrevious {
+			if prev == nil {
+				prev = image.NewRGBA(canvas.Bounds())
+			}
+			copy(prev.Pix, canvas.Pix)
+		}
+		op := draw.Src
+		if f.Blend {
+			op = draw.Over
+		}
+		draw.Draw(canvas, b, f.Image, b.Min, op)
+		if err := fn(i, canvas); err != nil {
+			return err
+		}
+		switch f.Disposal {
+		case DisposeBackground:
+			draw.Draw(canvas, b, image.Transparent, image.Point{}, draw.Src)
+		case DisposePrevious:
+			copy(canvas.Pix, prev.Pix)
+		}
+	}
+	return nil
+}
+
+// First 返回第一帧合成后的图像
+func (a *Animation) First() image.Image {
+	var first *image.RGBA
+	_ = a.Composite(func(i int, canvas *image.RGBA) error {
+		first = canvas
+		return io.EOF // stop
+	})
+	return first
+}
+
+// Transform 对合成后的每一帧做同样的处理, 结果的每一帧都覆盖整个画布
+func (a *Animation) Transform(fn func(m image.Image) (image.Image, error)) (*Animation, error) {
+	out := &Animation{LoopCount: a.LoopCount}
+	err := a.Composite(func(i int, canvas *image.RGBA) error {
+		m, err := fn(canvas)
+		if err != nil {
+			return err
+		}
+		if m == image.Image(canvas) { // 未处理时需要复制
+			c := image.NewRGBA(canvas.Bounds())
+			copy(c.Pix, canvas.Pix)
+			m = c
+		}
+		b := m.Bounds()
+		out.Width, out.Height = b.Dx(), b.Dy()
+		if b.Min != (image.Point{}) {
+			m = translate(m)
+		}
+		out.Frames = append(out.Frames, Frame{Image: m, Delay: a.Frames[i].Delay, Disposal: DisposeBackground})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !out.hasAlpha() {
+		for i := range out.Frames {
+			out.Frames[i].Disposal = DisposeNone
+		}
+	}
+	return out, nil
+}
+
+// hasAlpha 是否有帧含透明像素
+func (a *Animation) hasAlpha() bool {
+	for _, f := range a.Frames {
+		if !isOpaque(f.Image) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOpaque(m image.Image) bool {
+	if o, ok := m.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// translate 把图像移动到原点
+func translate(m image.Image) image.Image {
+	b := m.Bounds()
+	dst := newImageLike(m, image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), m, b.Min, draw.Src)
+	return dst
+}
+
+// ThumbnailAnimation 用同样的缩图参数处理每一帧
+func ThumbnailAnimation(a *Animation, topt *ThumbOption) (*Animation, error) {
+	var last ThumbOption
+	out, err := a.Transform(func(m image.Image) (image.Image, error) {
+		last = *topt // calc 会修改选项, 每帧都从原始选项开始
+		return ThumbnailImage(m, &last)
+	})
+	if err != nil {
+		return nil, err
+	}
+	*topt = last
+	return out, nil
+}
+
+// SaveAnimationTo 保存动画, 不支持动画的格式只保存第一帧;
+// 动画不能按 MaxBytes 或 AutoQuality 查找质量, 设置时返回 ErrInvalidOption
+func SaveAnimationTo(w io.Writer, a *Animation, opt *WriteOption) (*Output, error) {
+	if opt == nil {
+		opt = new(WriteOption)
+	}
+	opt.patch()
+	if len(a.Frames) < 2 || (opt.Format != FormatGIF && opt.Format != FormatWEBP) {
+		return SaveTo(w, a.First(), opt)
+	}
+	if opt.MaxBytes > 0 || opt.AutoQuality > 0 {
+		return nil, ErrInvalidOption
+	}
+	if opt.ExtraWriter != nil {
+		w = io.MultiWriter(w, opt.ExtraWriter)
+	}
+	cw := new(CountWriter)
+	if err := saveAnimation(io.MultiWriter(w, cw), a, opt); err != nil {
+		return nil, err
+	}
+	out := newOutput(a.Width, a.Height, opt.Format, opt.quality(a.First()), cw.Len())
+	out.Frames, out.Animated = len(a.Frames), true
+	return out, nil
+}
+
+func saveAnimation(w io.Writer, a *Animation, opt *WriteOption) (err error) {
+	if opt.Format == FormatGIF {
+		if !a.isPaletted() {
+			a, err = a.flatten()
+			if err != nil {
+				return
+			}
+		}
+		var o *GIFOption
+		if o, err = optionOf[GIFOption](opt, FormatGIF); err != nil {
+			return
+		}
+		return encodeGIFAnimation(w, a, o)
+	}
+
+	o, err := optionOf[WebPOption](opt, FormatWEBP)
+	if err != nil {
+		return
+	}
+	if a, err = a.flatten(); err != nil {
+		return
+	}
+	return encodeWebpAnimation(w, a, float32(opt.webpQuality()), o)
+}
+
+// isPaletted 是否所有帧都是调色板图像, 如原始的 GIF 帧
+func (a *Animation) isPaletted() bool {
+	for _, f := range a.Frames {
+		if _, ok := f.Image.(*image.Paletted); !ok || !f.Blend {
+			return false
+		}
+	}
+	return true
+}
+
+// flatten 合成为每帧都覆盖整个画布的动画
+func (a *Animation) flatten() (*Animation, error) {
+	canvas := image.Rect(0, 0, a.Width, a.Height)
+	for _, f := range a.Frames {
+		if f.Blend || f.Image.Bounds() != canvas {
+			return a.Transform(func(m image.Image) (image.Image, error) { return m, nil })
+		}
+	}
+	return a, nil
+}
+
+// encodeGIFAnimation 编码为 GIF 动画; 调色板帧直接写入, 其他帧先按选项量化
+func encodeGIFAnimation(w io.Writer, a *Animation, o *GIFOption) error {
+	g := &gif.GIF{
+		Config: image.Config{Width: a.Width, Height: a.Height, ColorModel: color.Palette(palette.Plan9)},
+	}
+	switch {
+	case a.LoopCount == 0:
+		g.LoopCount = 0
+	case a.LoopCount == 1:
+		g.LoopCount = -1
+	default:
+		g.LoopCount = a.LoopCount - 1
+	}
+	alpha := a.hasAlpha()
+	var prev image.Image
+	for _, f := range a.Frames {
+		pm, ok := f.Image.(*image.Paletted)
+		disposal := f.Disposal
+		if !ok {
+			m := f.Image
+			if !alpha && prev != nil && disposal == DisposeNone {
+				// 不透明时只写入与上一帧不同的区域
+				m = subImage(m, diffRect(prev, m))
+			}
+			prev = f.Image
+			if o != nil {
+				pm = o.quantize(m)
+			} else {
+				pm = quantize(m, alpha)
+			}
+		}
+		g.Image = append(g.Image, pm)
+		g.Delay = append(g.Delay, (f.Delay+5)/10)
+		switch disposal {
+		case DisposeBackground:
+			g.Disposal = append(g.Disposal, gif.DisposalBackground)
+		case DisposePrevious:
+			g.Disposal = append(g.Disposal, gif.DisposalPrevious)
+		default:
+			g.Disposal = append(g.Disposal, gif.DisposalNone)
+		}
+	}
+	return gif.EncodeAll(w, g)
+}
+
+func subImage(m image.Image, r image.Rectangle) image.Image {
+	if s, ok := m.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	return m
+}
+
+// diffRect 返回两帧不同像素的外框, 完全相同时返回左上角 1x1
+func diffRect(a, b image.Image) image.Rectangle {
+	r := b.Bounds()
+	ra, aok := a.(*image.RGBA)
+	rb, bok := b.(*image.RGBA)
+	if !aok || !bok || ra.Bounds() != rb.Bounds() {
+		return r
+	}
+	minX, minY, maxX, maxY := r.Max.X, r.Max.Y, r.Min.X-1, r.Min.Y-1
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := ra.PixOffset(x, y)
+			if ra.Pix[i] != rb.Pix[i] || ra.Pix[i+1] != rb.Pix[i+1] || ra.Pix[i+2] != rb.Pix[i+2] {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	if maxX < minX {
+		return image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Min.Y+1)
+	}
+	return image.Rect(minX, minY, maxX+1, maxY+1)
+}
+
+// quantize 使用 Plan9 调色板及 Floyd-Steinberg 抖动, 与 gif.Encode 的默认行为一致
+func quantize(m image.Image, alpha bool) *image.Paletted {
+	b := m.Bounds()
+	p := color.Palette(palette.Plan9)
+	if alpha {
+		p = append(p[:255:255], color.Transparent)
+	}
+	pm := image.NewPaletted(b, p)
+	draw.FloydSteinberg.Draw(pm, b, m, b.Min)
+	if alpha {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if _, _, _, a := m.At(x, y).RGBA(); a < 0x8000 {
+					pm.SetColorIndex(x, y, 255)
+				}
+			}
+		}
+	}
+	return pm
+}
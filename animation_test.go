@@ -0,0 +1,154 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testPalette = color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}, color.White}
+)
+
+// gifAnimation 40x30, a white background, a red box moves and a blue box shown only in second frame
+func gifAnimation(t *testing.T) []byte {
+	bg := image.NewPaletted(image.Rect(0, 0, 40, 30), testPalette)
+	for i := range bg.Pix {
+		bg.Pix[i] = 3
+	}
+	g := &gif.GIF{LoopCount: 2, Image: []*image.Paletted{bg}, Delay: []int{10}, Disposal: []byte{gif.DisposalNone}}
+	for i := 0; i < 2; i++ {
+		m := image.NewPaletted(image.Rect(10*i, 10, 10*i+10, 20), testPalette)
+		for j := range m.Pix {
+			m.Pix[j] = uint8(i + 1)
+		}
+		g.Image = append(g.Image, m)
+		g.Delay = append(g.Delay, 20)
+		g.Disposal = append(g.Disposal, gif.DisposalPrevious)
+	}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, g)
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestAnimationComposite(t *testing.T) {
+	a, err := decodeGIFAnimation(bytes.NewReader(gifAnimation(t)))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, a.LoopCount)
+	assert.Len(t, a.Frames, 3)
+	assert.Equal(t, 200, a.Frames[1].Delay)
+
+	var colors []color.RGBA
+	err = a.Composite(func(i int, canvas *image.RGBA) error {
+		colors = append(colors, canvas.RGBAAt(5, 15))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []color.RGBA{{255, 255, 255, 255}, {255, 0, 0, 255}, {255, 255, 255, 255}}, colors)
+}
+
+func TestAnimatedGIF(t *testing.T) {
+	data := gifAnimation(t)
+
+	attr, err := Probe(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.True(t, attr.Animated)
+	assert.Equal(t, 3, attr.Frames)
+
+	im, err := Open(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.True(t, im.Animated)
+	assert.Equal(t, 3, im.Frames)
+	assert.Equal(t, uint32(40), im.Width)
+
+	var buf bytes.Buffer
+	_, err = im.ThumbnailTo(&buf, &ThumbOption{Width: 20, Height: 20, IsFit: true})
+	assert.NoError(t, err)
+	g, err := gif.DecodeAll(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, g.Image, 3)
+	assert.Equal(t, 20, g.Config.Width)
+	assert.Equal(t, 15, g.Config.Height)
+	assert.Equal(t, 2, g.LoopCount)
+	assert.Equal(t, []int{10, 20, 20}, g.Delay)
+
+	buf.Reset()
+	_, err = Thumbnail(bytes.NewReader(data), &buf, &ThumbOption{Width: 20, Height: 20, IsFit: true, IsCrop: true})
+	assert.NoError(t, err)
+	g, err = gif.DecodeAll(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, g.Image, 3)
+	assert.Equal(t, 20, g.Config.Width)
+	assert.Equal(t, 20, g.Config.Height)
+
+	buf.Reset()
+	_, err = im.SaveTo(&buf, &WriteOption{Format: FormatGIF})
+	assert.NoError(t, err)
+	g, err = gif.DecodeAll(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, g.Image, 3)
+
+	buf.Reset()
+	_, err = im.SaveTo(&buf, &WriteOption{Format: FormatPNG})
+	assert.NoError(t, err)
+	cfg, format, err := image.DecodeConfig(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatPNG, format)
+	assert.Equal(t, 40, cfg.Width)
+}
+
+func TestAnimatedWebp(t *testing.T) {
+	im, err := Open(bytes.NewReader(gifAnimation(t)))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = im.SaveTo(&buf, &WriteOption{Format: FormatWEBP, Quality: 90})
+	assert.NoError(t, err)
+	data := buf.Bytes()
+	assert.True(t, isWebpAnimated(data))
+
+	attr, err := Probe(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attr.Frames)
+	assert.Equal(t, "image/webp", attr.Mime)
+
+	wim, err := Open(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.True(t, wim.Animated)
+	a := wim.Animation()
+	assert.Equal(t, 3, a.LoopCount)
+	assert.Equal(t, 40, a.Width)
+	assert.Equal(t, []int{100, 200, 200}, []int{a.Frames[0].Delay, a.Frames[1].Delay, a.Frames[2].Delay})
+
+	var colors []color.RGBA
+	err = a.Composite(func(i int, canvas *image.RGBA) error {
+		colors = append(colors, canvas.RGBAAt(5, 15))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, colors, 3)
+	assert.Greater(t, colors[1].R, uint8(200))
+	assert.Less(t, colors[1].G, uint8(60))
+	assert.Greater(t, colors[2].G, uint8(200))
+
+	buf.Reset()
+	_, err = wim.ThumbnailTo(&buf, &ThumbOption{Width: 20, Height: 20, IsFit: true})
+	assert.NoError(t, err)
+	attr, err = Probe(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attr.Frames)
+	assert.Equal(t, uint32(20), attr.Width)
+
+	buf.Reset()
+	_, err = wim.SaveTo(&buf, &WriteOption{Format: FormatGIF})
+	assert.NoError(t, err)
+	g, err := gif.DecodeAll(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, g.Image, 3)
+	assert.Equal(t, 2, g.LoopCount)
+}
@@ -0,0 +1,177 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"io"
+
+	"golang.org/x/image/webp"
+)
+
+// ANMF flags
+const (
+	anmfDispose = 0x01 // dispose to background
+	anmfNoBlend = 0x02 // do not blend
+)
+
+// isWebpAnimated 根据文件头判断是否为 WebP 动画
+func isWebpAnimated(hdr []byte) bool {
+	return len(hdr) >= 21 && string(hdr[:4]) == "RIFF" && string(hdr[8:12]) == "WEBP" &&
+		string(hdr[12:16]) == "VP8X" && hdr[20]&vp8xAnimation != 0
+}
+
+func getUint24(b []byte) int {
+	return int(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16)
+}
+
+func countWebpFrames(chunks []riffChunk) (n int) {
+	for _, c := range chunks {
+		if c.fourcc == "ANMF" {
+			n++
+		}
+	}
+	return
+}
+
+// decodeWebpAnimation 逐帧解码 ANMF 块, max > 0 时只解码前 max 帧; 帧需在画布之内, 且尺寸受 l 限制
+func decodeWebpAnimation(chunks []riffChunk, max int, l *Limits) (*Animation, error) {
+	a := new(Animation)
+	for _, c := range chunks {
+		switch c.fourcc {
+		case "VP8X":
+			if len(c.data) < 10 {
+				return nil, ErrInvalidFormat
+			}
+			a.Width, a.Height = 1+getUint24(c.data[4:]), 1+getUint24(c.data[7:])
+		case "ANIM":
+			if len(c.data) >= 6 {
+				a.LoopCount = int(binary.LittleEndian.Uint16(c.data[4:]))
+			}
+		case "ANMF":
+			if max > 0 && len(a.Frames) >= max {
+				continue
+			}
+			if len(c.data) < 16 {
+				return nil, ErrInvalidFormat
+			}
+			d := c.data
+			pt := image.Pt(2*getUint24(d), 2*getUint24(d[3:]))
+			w, h := 1+getUint24(d[6:]), 1+getUint24(d[9:])
+			if pt.X+w > a.Width || pt.Y+h > a.Height {
+				return nil, ErrInvalidFormat
+			}
+			m, err := decodeWebpFrame(d[16:], w, h, l)
+			if err != nil {
+				return nil, err
+			}
+			f := Frame{Image: moveTo(m, pt), Delay: getUint24(d[12:]), Blend: d[15]&anmfNoBlend == 0}
+			if d[15]&anmfDispose != 0 {
+				f.Disposal = DisposeBackground
+			}
+			a.Frames = append(a.Frames, f)
+		}
+	}
+	if len(a.Frames) == 0 || a.Width == 0 {
+		return nil, ErrInvalidFormat
+	}
+	return a, nil
+}
+
+// decodeWebpFrame 把帧数据包装为独立的 WebP 文件后解码, 位流中的尺寸需与 ANMF 中的相同
+func decodeWebpFrame(data []byte, w, h int, l *Limits) (image.Image, error) {
+	chunks, err := readChunks(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		if c.fourcc == "ALPH" {
+			vp8x := make([]byte, 10)
+			vp8x[0] = vp8xAlpha
+			putUint24(vp8x[4:], uint32(w-1))
+			putUint24(vp8x[7:], uint32(h-1))
+			chunks = append([]riffChunk{{fourcc: "VP8X", data: vp8x}}, chunks...)
+			break
+		}
+	}
+	data = writeRiffChunks(chunks)
+	cfg, err := webp.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width != w || cfg.Height != h {
+		return nil, ErrInvalidFormat
+	}
+	if err = l.Check(cfg); err != nil {
+		return nil, err
+	}
+	m, _, err := image.Decode(bytes.NewReader(data))
+	return m, err
+}
+
+// moveTo 把图像移动到画布中的 pt 位置
+func moveTo(m image.Image, pt image.Point) image.Image {
+	b := m.Bounds()
+	if b.Min == pt {
+		return m
+	}
+	dst := newImageLike(m, b.Sub(b.Min).Add(pt))
+	draw.Draw(dst, dst.Bounds(), m, b.Min, draw.Src)
+	return dst
+}
+
+// encodeWebpAnimation 逐帧编码后写入 ANMF 块, 各帧需已覆盖整个画布
+func encodeWebpAnimation(w io.Writer, a *Animation, qlt float32, o *WebPOption) error {
+	alpha := a.hasAlpha()
+	vp8x := make([]byte, 10)
+	vp8x[0] = vp8xAnimation
+	if alpha {
+		vp8x[0] |= vp8xAlpha
+	}
+	putUint24(vp8x[4:], uint32(a.Width-1))
+	putUint24(vp8x[7:], uint32(a.Height-1))
+	anim := make([]byte, 6) // background color BGRA, loop count
+	binary.LittleEndian.PutUint16(anim[4:], uint16(min(a.LoopCount, 0xffff)))
+	chunks := []riffChunk{{fourcc: "VP8X", data: vp8x}, {fourcc: "ANIM", data: anim}}
+
+	var prev image.Image
+	for _, f := range a.Frames {
+		m := f.Image
+		if !alpha && prev != nil {
+			// 不透明时只写入与上一帧不同的区域, 位置需为偶数
+			r := diffRect(prev, m)
+			r.Min.X, r.Min.Y = r.Min.X&^1, r.Min.Y&^1
+			m = subImage(m, r)
+		}
+		prev = f.Image
+
+		var buf bytes.Buffer
+		if err := webpEncode(&buf, m, qlt, o); err != nil {
+			return err
+		}
+		fcs, err := readRiffChunks(&buf, int64(buf.Len()))
+		if err != nil {
+			return err
+		}
+		b := m.Bounds()
+		hdr := make([]byte, 16)
+		putUint24(hdr, uint32(b.Min.X/2))
+		putUint24(hdr[3:], uint32(b.Min.Y/2))
+		putUint24(hdr[6:], uint32(b.Dx()-1))
+		putUint24(hdr[9:], uint32(b.Dy()-1))
+		putUint24(hdr[12:], uint32(min(f.Delay, 0xffffff)))
+		hdr[15] = anmfNoBlend
+		if f.Disposal == DisposeBackground {
+			hdr[15] |= anmfDispose
+		}
+		for _, c := range fcs {
+			if c.fourcc == "ALPH" || c.fourcc == "VP8 " || c.fourcc == "VP8L" {
+				hdr = appendChunks(hdr, c)
+			}
+		}
+		chunks = append(chunks, riffChunk{fourcc: "ANMF", data: hdr})
+	}
+	_, err := w.Write(writeRiffChunks(chunks))
+	return err
+}
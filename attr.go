@@ -8,6 +8,13 @@ type Attr struct {
 	Quality uint8  `json:"qlt,omitempty"`  // Original quality
 	Ext     string `json:"ext"`            // file extension include dot
 	Mime    string `json:"mime,omitempty"` // content type
+
+	ColorSpace string `json:"cs,omitempty"`    // 原图的颜色空间, 如 RGB, CMYK
+	BitDepth   uint8  `json:"depth,omitempty"` // 原图每通道的位数, 8 或 16
+
+	Frames   int  `json:"frames,omitempty"` // 动画帧数
+	Animated bool `json:"anim,omitempty"`   // 是否为动画
+	Pages    int  `json:"pages,omitempty"`  // 多页 TIFF 的页数
 }
 
 // ToMap ...
@@ -22,6 +29,19 @@ func (a Attr) ToMap() map[string]any {
 	if a.Quality > 0 {
 		m["qlt"] = a.Quality
 	}
+	if a.ColorSpace != "" {
+		m["cs"] = a.ColorSpace
+	}
+	if a.BitDepth > 0 {
+		m["depth"] = a.BitDepth
+	}
+	if a.Animated {
+		m["frames"] = a.Frames
+		m["anim"] = a.Animated
+	}
+	if a.Pages > 1 {
+		m["pages"] = a.Pages
+	}
 	return m
 }
 
@@ -53,6 +73,31 @@ func (a *Attr) FromMap(m map[string]any) {
 			a.Mime = vv
 		}
 	}
+	if v, ok := m["cs"]; ok {
+		if vv, ok := v.(string); ok {
+			a.ColorSpace = vv
+		}
+	}
+	if v, ok := m["depth"]; ok {
+		if vv, ok := v.(uint8); ok {
+			a.BitDepth = vv
+		}
+	}
+	if v, ok := m["frames"]; ok {
+		if vv, ok := v.(int); ok {
+			a.Frames = vv
+		}
+	}
+	if v, ok := m["anim"]; ok {
+		if vv, ok := v.(bool); ok {
+			a.Animated = vv
+		}
+	}
+	if v, ok := m["pages"]; ok {
+		if vv, ok := v.(int); ok {
+			a.Pages = vv
+		}
+	}
 }
 
 // NewAttr ...
@@ -67,13 +112,13 @@ func NewAttr(w, h uint, f string) *Attr {
 
 // Format2Ext ...
 func Format2Ext(f string) string {
-	if f == "jpeg" {
-		return ".jpg"
+	if ff := lookupFormat(f); ff != nil {
+		return ff.Ext()
 	}
 	return "." + f
 }
 
-// PatchFormat ...
+// PatchFormat 把扩展名转换为格式名, 如 jpg 为 jpeg
 func PatchFormat(s string) string {
 	if s == "" {
 		return s
@@ -81,8 +126,8 @@ func PatchFormat(s string) string {
 	if s[0] == '.' {
 		s = s[1:]
 	}
-	if s == "jpg" {
-		return "jpeg"
+	if f := lookupFormat(s); f != nil {
+		return f.Name
 	}
 	return s
 }
@@ -0,0 +1,75 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"log/slog"
+)
+
+// saveAutoQuality 选择 SSIM 不低于 opt.AutoQuality 的最低质量并写入 w;
+// 同时有 MaxBytes 时, 以选出的质量为上限再按 MaxBytes 查找, 返回写入的图像
+func saveAutoQuality(w io.Writer, m image.Image, opt *WriteOption, md *Metadata) (image.Image, error) {
+	lo, hi := opt.qualityRange()
+	q, data, err := searchSSIM(m, opt, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	if opt.MaxBytes > 0 {
+		o := *opt
+		o.Quality = uint8(q)
+		m, err = saveMaxBytes(w, m, &o, md)
+		opt.finalQuality = o.finalQuality
+		return m, err
+	}
+	if data, err = embedMeta(opt.Format, data, md); err != nil {
+		return nil, err
+	}
+	opt.finalQuality = uint8(q)
+	_, err = w.Write(data)
+	return m, err
+}
+
+// searchSSIM 二分查找 [lo, hi] 中 SSIM 不低于 AutoQuality 的最低质量, 返回质量及编码结果;
+// 都低于时返回 hi
+func searchSSIM(m image.Image, opt *WriteOption, lo, hi int) (int, []byte, error) {
+	b := m.Bounds()
+	f := ssimScale(b.Dx(), b.Dy())
+	ref := lumaPlane(m).downsample(f)
+	o := *opt
+	try := func(q int) ([]byte, bool, error) {
+		o.Quality = uint8(q)
+		var buf bytes.Buffer
+		if err := encode(&buf, m, &o); err != nil {
+			return nil, false, err
+		}
+		got, _, err := image.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return nil, false, err
+		}
+		s, _, _ := ssimMap(ref, lumaPlane(got).downsample(f))
+		slog.Debug("auto quality", "quality", q, "ssim", s, "bytes", buf.Len())
+		return buf.Bytes(), s >= opt.AutoQuality, nil
+	}
+
+	var best []byte
+	bestQ := hi
+	for l, r := lo, hi; l <= r; {
+		mid := (l + r) / 2
+		data, ok, err := try(mid)
+		if err != nil {
+			return 0, nil, err
+		}
+		if ok {
+			best, bestQ = data, mid
+			r = mid - 1
+		} else {
+			l = mid + 1
+		}
+	}
+	if best == nil {
+		data, _, err := try(hi)
+		return hi, data, err
+	}
+	return bestQ, best, nil
+}
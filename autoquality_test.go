@@ -0,0 +1,80 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSIMLuma(t *testing.T) {
+	src := photo(120, 90)
+	assert.InDelta(t, 1, ssimLuma(src, src), 1e-6)
+
+	var lo, hi bytes.Buffer
+	_, err := SaveTo(&lo, src, &WriteOption{Format: FormatJPEG, Quality: 20})
+	assert.NoError(t, err)
+	_, err = SaveTo(&hi, src, &WriteOption{Format: FormatJPEG, Quality: 90})
+	assert.NoError(t, err)
+	mlo, _, _ := image.Decode(&lo)
+	mhi, _, _ := image.Decode(&hi)
+	assert.Less(t, ssimLuma(src, mlo), ssimLuma(src, mhi))
+	assert.Less(t, ssimLuma(src, mhi), 1.0)
+}
+
+func TestAutoQuality(t *testing.T) {
+	smooth := image.NewRGBA(image.Rect(0, 0, 200, 150))
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			smooth.Set(x, y, color.RGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	detailed := photo(200, 150)
+
+	for _, format := range []string{FormatJPEG, FormatWEBP} {
+		quality := map[string]int{}
+		for name, m := range map[string]image.Image{"smooth": smooth, "detailed": detailed} {
+			opt := &WriteOption{Format: format, AutoQuality: 0.98}
+			var buf bytes.Buffer
+			out, err := SaveTo(&buf, m, opt)
+			assert.NoError(t, err)
+			q := int(out.Quality)
+			quality[name] = q
+
+			got, _, err := image.Decode(bytes.NewReader(buf.Bytes()))
+			if assert.NoError(t, err) {
+				assert.GreaterOrEqual(t, ssimLuma(m, got), 0.98, "%s %s q%d", format, name, q)
+			}
+		}
+		assert.Less(t, quality["smooth"], quality["detailed"], format)
+	}
+
+	// 以选出的质量为 MaxBytes 的上限
+	opt := &WriteOption{Format: FormatJPEG, AutoQuality: 0.98}
+	out, err := SaveTo(new(bytes.Buffer), detailed, opt)
+	assert.NoError(t, err)
+	auto := out.Quality
+	opt = &WriteOption{Format: FormatJPEG, AutoQuality: 0.98, MaxBytes: 1 << 20}
+	out, err = SaveTo(new(bytes.Buffer), detailed, opt)
+	assert.NoError(t, err)
+	assert.Equal(t, auto, out.Quality)
+	opt.MaxBytes = 4000
+	var buf bytes.Buffer
+	out, err = SaveTo(&buf, detailed, opt)
+	assert.NoError(t, err)
+	assert.Less(t, out.Quality, auto)
+	assert.LessOrEqual(t, buf.Len(), 4000)
+
+	// 达不到时使用最高质量
+	opt = &WriteOption{Format: FormatJPEG, Quality: 30, AutoQuality: 0.9999}
+	out, err = SaveTo(new(bytes.Buffer), detailed, opt)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, int(out.Quality))
+
+	topt := &ThumbOption{Width: 100, Height: 75, WriteOption: WriteOption{Format: FormatJPEG, AutoQuality: 0.95}}
+	out, err = ThumbnailImageTo(detailed, new(bytes.Buffer), topt)
+	assert.NoError(t, err)
+	assert.NotZero(t, out.Quality)
+}
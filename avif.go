@@ -0,0 +1,60 @@
+package image
+
+import (
+	"image"
+	"io"
+)
+
+// AVIF 的编解码使用 libavif, 需要 cgo 及 libavif 标签 (go build -tags libavif);
+// 否则只能读取属性, 解码及编码返回 ErrNoCodec
+
+// AVIFOption AVIF 编码选项
+type AVIFOption struct {
+	Speed        int  // 速度 1-10, 越大越快压缩率越低, 0 为默认的 6
+	AlphaQuality int  // alpha 的质量 1-100, 0 为与 Quality 相同
+	Lossless     bool // 无损, 使用 YUV444 及 identity 矩阵
+}
+
+const avifDefaultSpeed = 6
+
+func (o *AVIFOption) speed() int {
+	if o == nil || o.Speed <= 0 {
+		return avifDefaultSpeed
+	}
+	return min(o.Speed, 10)
+}
+
+func (o *AVIFOption) alphaQuality(qlt int) int {
+	if o == nil || o.AlphaQuality <= 0 {
+		return qlt
+	}
+	return min(o.AlphaQuality, 100)
+}
+
+// readAVIF 读取 AVIF 的属性, 主图须为 av01 或 grid
+func readAVIF(r io.Reader) (*heifInfo, error) {
+	h, err := readHEIF(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.kind() != FormatAVIF || (h.codec != "av01" && h.codec != "grid") {
+		return nil, ErrInvalidFormat
+	}
+	return h, nil
+}
+
+func avifDecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readAVIF(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return h.config(), nil
+}
+
+func encodeAVIFWith(w io.Writer, m image.Image, quality uint8, o *AVIFOption) error {
+	qlt := int(quality)
+	if qlt == 0 {
+		qlt = MinAVIFQuality
+	}
+	return avifEncode(w, m, qlt, o)
+}
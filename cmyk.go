@@ -0,0 +1,432 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// 原图的颜色空间
+const (
+	ColorSpaceRGB   = "RGB"
+	ColorSpaceGray  = "Gray"
+	ColorSpaceYCbCr = "YCbCr"
+	ColorSpaceCMYK  = "CMYK"
+	ColorSpaceYCCK  = "YCCK"
+)
+
+// Adobe APP14 中的 transform
+const (
+	adobeTransformUnknown = 0 // RGB 或 CMYK
+	adobeTransformYCbCr   = 1
+	adobeTransformYCCK    = 2
+)
+
+const markerAPP14 = 0xee
+
+var adobeHeader = []byte("Adobe")
+
+// colorSpaceOf 按解码的颜色模型返回颜色空间
+func colorSpaceOf(model color.Model) string {
+	switch model {
+	case color.GrayModel, color.Gray16Model:
+		return ColorSpaceGray
+	case color.YCbCrModel:
+		return ColorSpaceYCbCr
+	case color.CMYKModel:
+		return ColorSpaceCMYK
+	}
+	return ColorSpaceRGB
+}
+
+// jpegColorSpace 根据 SOF 的通道数及 Adobe APP14 判断 JPEG 的颜色空间
+func jpegColorSpace(r io.Reader) string {
+	var comps int
+	transform := -1
+	_ = readJPEGSegments(r, func(marker byte, payload []byte) bool {
+		switch {
+		case marker == markerAPP14 && bytes.HasPrefix(payload, adobeHeader) && len(payload) >= 12:
+			transform = int(payload[11])
+		case marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc: // SOFn
+			if len(payload) >= 6 {
+				comps = int(payload[5])
+			}
+		}
+		return true
+	})
+	switch comps {
+	case 1:
+		return ColorSpaceGray
+	case 3:
+		if transform == adobeTransformUnknown {
+			return ColorSpaceRGB
+		}
+		return ColorSpaceYCbCr
+	case 4:
+		if transform == adobeTransformYCCK || transform == adobeTransformYCbCr {
+			return ColorSpaceYCCK
+		}
+		return ColorSpaceCMYK
+	}
+	return ""
+}
+
+// decodeCMYK 解码 4 通道的 JPEG 并转换为 RGB
+//
+// 有 Adobe APP14 时 CMYK 按 Adobe 的习惯反相存储, image/jpeg 已经处理;
+// 没有时 image/jpeg 无法解码, 补上 APP14 后再把结果反相回来.
+// 有 CMYK 的 ICC profile 时按其 A2B 查找表转换, 否则使用简单公式.
+func decodeCMYK(data []byte) (image.Image, error) {
+	var adobe bool
+	md := new(Metadata)
+	err := readJPEGMeta(bytes.NewReader(data), md)
+	if err != nil {
+		return nil, err
+	}
+	_ = readJPEGSegments(bytes.NewReader(data), func(marker byte, payload []byte) bool {
+		adobe = adobe || (marker == markerAPP14 && bytes.HasPrefix(payload, adobeHeader))
+		return !adobe
+	})
+	if !adobe {
+		app14 := appendJPEGSegment(append([]byte(nil), data[:2]...), markerAPP14,
+			adobeHeader, []byte{0, 100, 0, 0, 0, 0, adobeTransformUnknown})
+		data = append(app14, data[2:]...)
+	}
+	m, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	cm, ok := m.(*image.CMYK)
+	if !ok {
+		return m, nil
+	}
+	if !adobe {
+		for i := range cm.Pix {
+			cm.Pix[i] = 255 - cm.Pix[i]
+		}
+	}
+	return cmykToRGB(cm, md.ICC), nil
+}
+
+// cmykToRGB 转换为 sRGB, icc 不可用时使用与 color.CMYK 相同的公式
+func cmykToRGB(m *image.CMYK, icc []byte) *image.RGBA {
+	b := m.Bounds()
+	dst := image.NewRGBA(b)
+	lut, _ := parseCMYKProfile(icc)
+	var in [4]float64
+	var out [3]float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		si, di := m.PixOffset(b.Min.X, y), dst.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x, si, di = x+1, si+4, di+4 {
+			s, d := m.Pix[si:si+4:si+4], dst.Pix[di:di+4:di+4]
+			if lut == nil {
+				w := 255 - uint32(s[3])
+				d[0] = uint8((255 - uint32(s[0])) * w / 255)
+				d[1] = uint8((255 - uint32(s[1])) * w / 255)
+				d[2] = uint8((255 - uint32(s[2])) * w / 255)
+			} else {
+				for i := range in {
+					in[i] = float64(s[i]) / 255
+				}
+				lut.eval(in[:], out[:])
+				r, g, b := lut.toSRGB(out)
+				d[0], d[1], d[2] = srgbEncode8(r), srgbEncode8(g), srgbEncode8(b)
+			}
+			d[3] = 0xff
+		}
+	}
+	return dst
+}
+
+// iccLut A2B 查找表, 依次为 A 曲线, CLUT, M 曲线, 矩阵, B 曲线
+//
+// lut8Type 及 lut16Type 只有输入曲线 (A), CLUT 及输出曲线 (B)
+type iccLut struct {
+	a      []*iccCurve
+	grid   []int
+	clut   []float32 // 每个格点 nout 个值, 0..1
+	m      []*iccCurve
+	matrix []float64 // 3x3 及偏移
+	b      []*iccCurve
+	nout   int
+	lab    bool // PCS 为 Lab
+	legacy bool // lut16Type 的 Lab 编码
+}
+
+// parseCMYKProfile 解析 CMYK profile 的 A2B0 (或 A2B1)
+func parseCMYKProfile(icc []byte) (*iccLut, error) {
+	if iccColorSpace(icc) != iccSpaceCMYK {
+		return nil, ErrUnsupportFormat
+	}
+	tags, err := iccTags(icc)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := tags["A2B0"]
+	if !ok {
+		if data, ok = tags["A2B1"]; !ok {
+			return nil, ErrUnsupportFormat
+		}
+	}
+	var lut *iccLut
+	switch string(data[:4]) {
+	case "mft1", "mft2":
+		lut, err = parseLut816(data)
+	case "mAB ":
+		lut, err = parseLutAtoB(data)
+	default:
+		return nil, ErrUnsupportFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(lut.a) != 4 || lut.nout != 3 {
+		return nil, ErrUnsupportFormat
+	}
+	switch string(icc[20:24]) {
+	case iccPCSLab:
+		lut.lab = true
+	case iccPCSXYZ:
+	default:
+		return nil, ErrUnsupportFormat
+	}
+	return lut, nil
+}
+
+// parseLut816 lut8Type 及 lut16Type
+func parseLut816(b []byte) (*iccLut, error) {
+	if len(b) < 52 {
+		return nil, ErrInvalidFormat
+	}
+	nin, nout, g := int(b[8]), int(b[9]), int(b[10])
+	if nin == 0 || nin > 4 || nout == 0 || g < 2 {
+		return nil, ErrUnsupportFormat
+	}
+	wide := string(b[:4]) == "mft2"
+	inN, outN, pos, size := 256, 256, 48, 1
+	if wide {
+		inN, outN = int(binary.BigEndian.Uint16(b[48:])), int(binary.BigEndian.Uint16(b[50:]))
+		pos, size = 52, 2
+	}
+	points := int(math.Pow(float64(g), float64(nin)))
+	if inN < 2 || outN < 2 || len(b) < pos+(nin*inN+points*nout+nout*outN)*size {
+		return nil, ErrInvalidFormat
+	}
+	value := func(i int) uint16 {
+		if wide {
+			return binary.BigEndian.Uint16(b[pos+i*2:])
+		}
+		return uint16(b[pos+i]) * 257
+	}
+	curves := func(n, entries int) []*iccCurve {
+		cs := make([]*iccCurve, n)
+		for c := range cs {
+			cs[c] = &iccCurve{table: make([]uint16, entries)}
+			for i := range cs[c].table {
+				cs[c].table[i] = value(c*entries + i)
+			}
+		}
+		pos += n * entries * size
+		return cs
+	}
+
+	lut := &iccLut{nout: nout, legacy: wide}
+	lut.a = curves(nin, inN)
+	lut.grid = make([]int, nin)
+	for i := range lut.grid {
+		lut.grid[i] = g
+	}
+	lut.clut = make([]float32, points*nout)
+	for i := range lut.clut {
+		lut.clut[i] = float32(value(i)) / 65535
+	}
+	pos += len(lut.clut) * size
+	lut.b = curves(nout, outN)
+	return lut, nil
+}
+
+// parseLutAtoB lutAToBType
+func parseLutAtoB(b []byte) (*iccLut, error) {
+	if len(b) < 32 {
+		return nil, ErrInvalidFormat
+	}
+	nin, nout := int(b[8]), int(b[9])
+	if nin == 0 || nin > 4 || nout == 0 {
+		return nil, ErrUnsupportFormat
+	}
+	offset := func(i int) int { return int(binary.BigEndian.Uint32(b[12+i*4:])) }
+	bOff, matOff, mOff, clutOff, aOff := offset(0), offset(1), offset(2), offset(3), offset(4)
+	if bOff == 0 || clutOff == 0 || aOff == 0 {
+		return nil, ErrUnsupportFormat
+	}
+	lut := &iccLut{nout: nout}
+	var err error
+	if lut.a, err = readCurves(b, aOff, nin); err != nil {
+		return nil, err
+	}
+	if lut.b, err = readCurves(b, bOff, nout); err != nil {
+		return nil, err
+	}
+	if mOff > 0 {
+		if lut.m, err = readCurves(b, mOff, nout); err != nil {
+			return nil, err
+		}
+	}
+	if matOff > 0 {
+		if len(b) < matOff+48 || nout != 3 {
+			return nil, ErrInvalidFormat
+		}
+		lut.matrix = make([]float64, 12)
+		for i := range lut.matrix {
+			lut.matrix[i] = s15Fixed16(b[matOff+i*4:])
+		}
+	}
+
+	if len(b) < clutOff+20 {
+		return nil, ErrInvalidFormat
+	}
+	points := 1
+	lut.grid = make([]int, nin)
+	for i := range lut.grid {
+		lut.grid[i] = int(b[clutOff+i])
+		if lut.grid[i] < 2 {
+			return nil, ErrUnsupportFormat
+		}
+		points *= lut.grid[i]
+	}
+	size := int(b[clutOff+16])
+	pos := clutOff + 20
+	if (size != 1 && size != 2) || len(b) < pos+points*nout*size {
+		return nil, ErrInvalidFormat
+	}
+	lut.clut = make([]float32, points*nout)
+	for i := range lut.clut {
+		if size == 2 {
+			lut.clut[i] = float32(binary.BigEndian.Uint16(b[pos+i*2:])) / 65535
+		} else {
+			lut.clut[i] = float32(b[pos+i]) / 255
+		}
+	}
+	return lut, nil
+}
+
+// readCurves 读取连续的 n 条 curv 或 para 曲线, 各自按 4 字节对齐
+func readCurves(b []byte, off, n int) ([]*iccCurve, error) {
+	cs := make([]*iccCurve, n)
+	for i := range cs {
+		if off+12 > len(b) {
+			return nil, ErrInvalidFormat
+		}
+		c, err := parseCurve(b[off:])
+		if err != nil {
+			return nil, err
+		}
+		cs[i] = c
+		if c.para {
+			off += 12 + len(c.params)*4
+		} else {
+			off += 12 + int(binary.BigEndian.Uint32(b[off+8:]))*2
+		}
+		off = (off + 3) &^ 3
+	}
+	return cs, nil
+}
+
+func evalCurves(cs []*iccCurve, v []float64) {
+	for i, c := range cs {
+		v[i] = c.eval(min(max(v[i], 0), 1))
+	}
+}
+
+// eval 把 0..1 的输入转换为 PCS 编码值
+func (l *iccLut) eval(in, out []float64) {
+	var v [4]float64
+	copy(v[:], in)
+	evalCurves(l.a, v[:len(l.a)])
+
+	// 多线性插值, 第一个通道变化最慢
+	n := len(l.grid)
+	var base int
+	var frac [4]float64
+	var stride [4]int
+	s := l.nout
+	for i := n - 1; i >= 0; i-- {
+		stride[i] = s
+		p := min(max(v[i], 0), 1) * float64(l.grid[i]-1)
+		k := min(int(p), l.grid[i]-2)
+		frac[i] = p - float64(k)
+		base += k * s
+		s *= l.grid[i]
+	}
+	for o := range out[:l.nout] {
+		out[o] = 0
+	}
+	for corner := 0; corner < 1<<n; corner++ {
+		w, idx := 1.0, base
+		for i := 0; i < n; i++ {
+			if corner&(1<<i) != 0 {
+				w *= frac[i]
+				idx += stride[i]
+			} else {
+				w *= 1 - frac[i]
+			}
+		}
+		if w == 0 {
+			continue
+		}
+		for o := 0; o < l.nout; o++ {
+			out[o] += w * float64(l.clut[idx+o])
+		}
+	}
+
+	if l.m != nil {
+		evalCurves(l.m, out)
+	}
+	if l.matrix != nil {
+		m := l.matrix
+		x, y, z := out[0], out[1], out[2]
+		out[0] = m[0]*x + m[1]*y + m[2]*z + m[9]
+		out[1] = m[3]*x + m[4]*y + m[5]*z + m[10]
+		out[2] = m[6]*x + m[7]*y + m[8]*z + m[11]
+	}
+	evalCurves(l.b, out)
+}
+
+// toSRGB 把 PCS 编码值转换为线性 sRGB
+func (l *iccLut) toSRGB(v [3]float64) (r, g, b float32) {
+	var x, y, z float64
+	if l.lab {
+		var lv, av, bv float64
+		if l.legacy {
+			lv = v[0] * 65535 / 65280 * 100
+			av, bv = v[1]*65535/256-128, v[2]*65535/256-128
+		} else {
+			lv, av, bv = v[0]*100, v[1]*255-128, v[2]*255-128
+		}
+		x, y, z = labToXYZ(lv, av, bv)
+	} else {
+		x, y, z = v[0]*65535/32768, v[1]*65535/32768, v[2]*65535/32768
+	}
+	m := &srgbInverse
+	return float32(m[0][0]*x + m[0][1]*y + m[0][2]*z),
+		float32(m[1][0]*x + m[1][1]*y + m[1][2]*z),
+		float32(m[2][0]*x + m[2][1]*y + m[2][2]*z)
+}
+
+// labToXYZ CIE Lab 到 XYZ, 白点为 D50
+func labToXYZ(l, a, b float64) (x, y, z float64) {
+	const e, k = 216.0 / 24389, 24389.0 / 27
+	fy := (l + 16) / 116
+	fx, fz := fy+a/500, fy-b/200
+	f := func(t float64) float64 {
+		if t3 := t * t * t; t3 > e {
+			return t3
+		}
+		return (116*t - 16) / k
+	}
+	return 0.9642 * f(fx), f(fy), 0.8249 * f(fz)
+}
@@ -0,0 +1,164 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flatJPEG a 8x8 baseline JPEG, each component is filled with one value of vs,
+// transform < 0 for no Adobe APP14
+func flatJPEG(vs []uint8, transform int, icc []byte) []byte {
+	out := []byte{0xff, markerSOI}
+	if transform >= 0 {
+		out = appendJPEGSegment(out, markerAPP14, adobeHeader, []byte{0, 100, 0, 0, 0, 0, byte(transform)})
+	}
+	if len(icc) > 0 {
+		out = appendJPEGSegment(out, markerAPP2, iccHeader, []byte{1, 1}, icc)
+	}
+	out = appendJPEGSegment(out, 0xdb, []byte{0}, bytes.Repeat([]byte{1}, 64)) // DQT
+	sof := []byte{8, 0, 8, 0, 8, byte(len(vs))}
+	sos := []byte{byte(len(vs))}
+	for i := range vs {
+		sof = append(sof, byte(i+1), 0x11, 0)
+		sos = append(sos, byte(i+1), 0x00)
+	}
+	out = appendJPEGSegment(out, 0xc0, sof)
+	// DC: 12 categories with 4-bit codes, AC: only EOB with code "0"
+	dht := append([]byte{0x00, 0, 0, 0, 12}, make([]byte, 12)...)
+	for i := 0; i < 12; i++ {
+		dht = append(dht, byte(i))
+	}
+	dht = append(dht, 0x10, 1)
+	dht = append(dht, make([]byte, 15)...)
+	dht = append(dht, 0)
+	out = appendJPEGSegment(out, 0xc4, dht)
+	out = appendJPEGSegment(out, markerSOS, append(sos, 0, 63, 0))
+
+	var acc uint64
+	var nbits uint
+	var scan []byte
+	put := func(v uint64, n uint) {
+		acc = acc<<n | v&(1<<n-1)
+		nbits += n
+		for nbits >= 8 {
+			b := byte(acc >> (nbits - 8))
+			scan = append(scan, b)
+			if b == 0xff {
+				scan = append(scan, 0)
+			}
+			nbits -= 8
+		}
+	}
+	for _, v := range vs {
+		diff := 8 * (int(v) - 128)
+		a := diff
+		if a < 0 {
+			a = -a
+		}
+		s := uint(0)
+		for a>>s > 0 {
+			s++
+		}
+		put(uint64(s), 4)
+		if diff < 0 {
+			diff += 1<<s - 1
+		}
+		put(uint64(diff), s)
+		put(0, 1) // EOB
+	}
+	if nbits > 0 {
+		put(1<<(8-nbits)-1, 8-nbits)
+	}
+	out = append(out, scan...)
+	return append(out, 0xff, markerEOI)
+}
+
+// grayCMYKProfile a CMYK profile maps every color to Lab(50, 0, 0) with a lut16Type
+func grayCMYKProfile() []byte {
+	lut := append([]byte("mft2"), 0, 0, 0, 0, 4, 3, 2, 0)
+	for i := 0; i < 9; i++ {
+		v := uint32(0)
+		if i%4 == 0 {
+			v = 0x10000
+		}
+		lut = binary.BigEndian.AppendUint32(lut, v)
+	}
+	lut = binary.BigEndian.AppendUint16(lut, 2)
+	lut = binary.BigEndian.AppendUint16(lut, 2)
+	for i := 0; i < 4; i++ {
+		lut = binary.BigEndian.AppendUint16(lut, 0)
+		lut = binary.BigEndian.AppendUint16(lut, 0xffff)
+	}
+	lab := []uint16{uint16(math.Round(50 * 65280 / 100)), 0x8000, 0x8000}
+	for i := 0; i < 16; i++ {
+		for _, v := range lab {
+			lut = binary.BigEndian.AppendUint16(lut, v)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		lut = binary.BigEndian.AppendUint16(lut, 0)
+		lut = binary.BigEndian.AppendUint16(lut, 0xffff)
+	}
+
+	table := binary.BigEndian.AppendUint32(nil, 1)
+	table = append(table, "A2B0"...)
+	table = binary.BigEndian.AppendUint32(table, iccHeaderSize+16)
+	table = binary.BigEndian.AppendUint32(table, uint32(len(lut)))
+	hdr := make([]byte, iccHeaderSize)
+	binary.BigEndian.PutUint32(hdr, uint32(iccHeaderSize+len(table)+len(lut)))
+	binary.BigEndian.PutUint32(hdr[8:], 0x02100000)
+	copy(hdr[12:], "prtr")
+	copy(hdr[16:], iccSpaceCMYK)
+	copy(hdr[20:], iccPCSLab)
+	copy(hdr[36:], iccMagic)
+	return append(append(hdr, table...), lut...)
+}
+
+func TestCMYK(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	cases := []struct {
+		name  string
+		data  []byte
+		space string
+		want  color.RGBA
+	}{
+		{"adobe", flatJPEG([]uint8{255, 0, 0, 255}, adobeTransformUnknown, nil), ColorSpaceCMYK, red},
+		{"plain", flatJPEG([]uint8{0, 255, 255, 0}, -1, nil), ColorSpaceCMYK, red},
+		{"ycck", flatJPEG([]uint8{179, 171, 1, 255}, adobeTransformYCCK, nil), ColorSpaceYCCK, red},
+		{"icc", flatJPEG([]uint8{255, 0, 0, 255}, adobeTransformUnknown, grayCMYKProfile()), ColorSpaceCMYK, color.RGBA{119, 119, 119, 255}},
+	}
+	for _, c := range cases {
+		attr, err := Probe(bytes.NewReader(c.data))
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.space, attr.ColorSpace, c.name)
+
+		im, err := Open(bytes.NewReader(c.data))
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+		assert.Equal(t, c.space, im.ColorSpace, c.name)
+		m, ok := im.m.(*image.RGBA)
+		assert.True(t, ok, c.name)
+		got := m.RGBAAt(3, 3)
+		assert.InDelta(t, c.want.R, got.R, 3, c.name)
+		assert.InDelta(t, c.want.G, got.G, 3, c.name)
+		assert.InDelta(t, c.want.B, got.B, 3, c.name)
+
+		var buf bytes.Buffer
+		_, err = im.SaveTo(&buf, &WriteOption{KeepMeta: MetaAll})
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, ColorSpaceYCbCr, jpegColorSpace(bytes.NewReader(buf.Bytes())), c.name)
+		md, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err, c.name)
+		assert.Nil(t, md.ICC, c.name)
+	}
+
+	data := flatJPEG([]uint8{128, 128, 128}, -1, nil)
+	assert.Equal(t, ColorSpaceYCbCr, jpegColorSpace(bytes.NewReader(data)))
+}
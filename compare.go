@@ -0,0 +1,193 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// 图像的相似度, 用于评估 SaveTo 及 ThumbnailImage 的损失.
+// 像素按预乘的 RGBA 比较, 不同的颜色模型 (YCbCr, Gray, Paletted 等) 可以直接比较,
+// 取值按 8 位计算 (0-255)
+
+// Channel 比较的通道
+type Channel int
+
+// consts
+const (
+	ChannelR Channel = iota
+	ChannelG
+	ChannelB
+	ChannelA
+	ChannelY // BT.601 亮度
+)
+
+// ChannelSimilarity 单个通道的相似度
+type ChannelSimilarity struct {
+	MSE  float64 // 平均平方误差
+	PSNR float64 // 峰值信噪比 (dB), 相同时为 +Inf
+	SSIM float64 // 结构相似度, 1 为相同
+}
+
+// Similarity 两个图像的相似度
+type Similarity struct {
+	MSE    float64 // R, G, B 的平均平方误差
+	PSNR   float64 // 按 MSE 计算的峰值信噪比 (dB), 相同时为 +Inf
+	SSIM   float64 // 亮度的结构相似度
+	MSSSIM float64 // 亮度的多尺度结构相似度
+
+	Channels [5]ChannelSimilarity // 按 Channel 索引
+}
+
+// Compare 比较两个尺寸相同的图像, 尺寸不同时返回 ErrSizeMismatch
+func Compare(a, b image.Image) (*Similarity, error) {
+	pa, pb, err := comparePlanes(a, b)
+	if err != nil {
+		return nil, err
+	}
+	out := new(Similarity)
+	f := ssimScale(pa[0].w, pa[0].h)
+	for c := range out.Channels {
+		mse := planeMSE(pa[c], pb[c])
+		s, _, _ := ssimMap(pa[c].downsample(f), pb[c].downsample(f))
+		out.Channels[c] = ChannelSimilarity{MSE: mse, PSNR: psnr(mse), SSIM: s}
+	}
+	for _, c := range []Channel{ChannelR, ChannelG, ChannelB} {
+		out.MSE += out.Channels[c].MSE / 3
+	}
+	out.PSNR = psnr(out.MSE)
+	out.SSIM = out.Channels[ChannelY].SSIM
+	out.MSSSIM = msssim(pa[ChannelY], pb[ChannelY])
+	return out, nil
+}
+
+// MSE 两个图像 R, G, B 的平均平方误差
+func MSE(a, b image.Image) (float64, error) {
+	pa, pb, err := comparePlanes(a, b)
+	if err != nil {
+		return 0, err
+	}
+	var mse float64
+	for _, c := range []Channel{ChannelR, ChannelG, ChannelB} {
+		mse += planeMSE(pa[c], pb[c]) / 3
+	}
+	return mse, nil
+}
+
+// PSNR 两个图像的峰值信噪比 (dB), 相同时为 +Inf
+func PSNR(a, b image.Image) (float64, error) {
+	mse, err := MSE(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return psnr(mse), nil
+}
+
+// SSIM 两个图像亮度的结构相似度
+func SSIM(a, b image.Image) (float64, error) {
+	if err := sameSize(a, b); err != nil {
+		return 0, err
+	}
+	return ssimLuma(a, b), nil
+}
+
+// MSSSIM 两个图像亮度的多尺度结构相似度
+func MSSSIM(a, b image.Image) (float64, error) {
+	if err := sameSize(a, b); err != nil {
+		return 0, err
+	}
+	return msssim(lumaPlane(a), lumaPlane(b)), nil
+}
+
+// DiffHeatmap 差异热图, 每个像素为各通道最大差值, 由黑经红, 黄到白
+func DiffHeatmap(a, b image.Image) (*image.RGBA, error) {
+	if err := sameSize(a, b); err != nil {
+		return nil, err
+	}
+	ba, bb := a.Bounds(), b.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, ba.Dx(), ba.Dy()))
+	for y := 0; y < ba.Dy(); y++ {
+		for x := 0; x < ba.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ba.Min.X+x, ba.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			d := max(absDiff(r1, r2), absDiff(g1, g2), absDiff(b1, b2), absDiff(a1, a2)) >> 8
+			out.SetRGBA(x, y, heatColor(uint8(d)))
+		}
+	}
+	return out, nil
+}
+
+// heatColor 0-85 为黑到红, 86-170 为红到黄, 之后为黄到白
+func heatColor(d uint8) color.RGBA {
+	v := int(d) * 3
+	switch {
+	case v <= 255:
+		return color.RGBA{uint8(v), 0, 0, 0xff}
+	case v <= 510:
+		return color.RGBA{0xff, uint8(v - 255), 0, 0xff}
+	}
+	return color.RGBA{0xff, 0xff, uint8(v - 510), 0xff}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func sameSize(a, b image.Image) error {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return ErrSizeMismatch
+	}
+	return nil
+}
+
+// comparePlanes 两个图像按 Channel 分开的平面
+func comparePlanes(a, b image.Image) ([5]*plane, [5]*plane, error) {
+	if err := sameSize(a, b); err != nil {
+		return [5]*plane{}, [5]*plane{}, err
+	}
+	return channelPlanes(a), channelPlanes(b), nil
+}
+
+// channelPlanes 预乘的 R, G, B, A 及亮度
+func channelPlanes(m image.Image) [5]*plane {
+	b := m.Bounds()
+	var out [5]*plane
+	for c := range out {
+		out[c] = newPlane(b.Dx(), b.Dy())
+	}
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := m.At(x, y).RGBA()
+			out[ChannelR].pix[i] = float32(r) / 257
+			out[ChannelG].pix[i] = float32(g) / 257
+			out[ChannelB].pix[i] = float32(bl) / 257
+			out[ChannelA].pix[i] = float32(a) / 257
+			out[ChannelY].pix[i] = float32(0.299*float64(r)+0.587*float64(g)+0.114*float64(bl)) / 257
+			i++
+		}
+	}
+	return out
+}
+
+func planeMSE(a, b *plane) float64 {
+	if len(a.pix) == 0 {
+		return 0
+	}
+	var sum float64
+	for i, v := range a.pix {
+		d := float64(v - b.pix[i])
+		sum += d * d
+	}
+	return sum / float64(len(a.pix))
+}
+
+func psnr(mse float64) float64 {
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
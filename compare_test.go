@@ -0,0 +1,94 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	src := photo(200, 150)
+	s, err := Compare(src, src)
+	if assert.NoError(t, err) {
+		assert.Zero(t, s.MSE)
+		assert.True(t, math.IsInf(s.PSNR, 1))
+		assert.InDelta(t, 1, s.SSIM, 1e-6)
+		assert.InDelta(t, 1, s.MSSSIM, 1e-6)
+		assert.InDelta(t, 1, s.Channels[ChannelA].SSIM, 1e-6)
+	}
+
+	// 不同的颜色模型
+	gray := image.NewGray(image.Rect(0, 0, 40, 30))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7)
+	}
+	rgba := image.NewRGBA(gray.Bounds().Add(image.Pt(5, 5)))
+	draw.Draw(rgba, rgba.Bounds(), gray, image.Point{}, draw.Src)
+	mse, err := MSE(gray, rgba)
+	assert.NoError(t, err)
+	assert.Zero(t, mse)
+
+	// 已知的误差
+	dark := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	light := image.NewRGBA(dark.Bounds())
+	draw.Draw(dark, dark.Bounds(), image.NewUniform(color.Gray{90}), image.Point{}, draw.Src)
+	draw.Draw(light, light.Bounds(), image.NewUniform(color.Gray{100}), image.Point{}, draw.Src)
+	s, err = Compare(dark, light)
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 100, s.MSE, 1e-3)
+		assert.InDelta(t, 28.13, s.PSNR, 0.01)
+		assert.Zero(t, s.Channels[ChannelA].MSE)
+		assert.InDelta(t, 100, s.Channels[ChannelG].MSE, 1e-3)
+	}
+
+	_, err = Compare(src, gray)
+	assert.Equal(t, ErrSizeMismatch, err)
+	_, err = SSIM(src, gray)
+	assert.Equal(t, ErrSizeMismatch, err)
+
+	// 质量越低越不相似
+	var prev *Similarity
+	for _, q := range []uint8{95, 60, 20} {
+		var buf bytes.Buffer
+		_, err := SaveTo(&buf, src, &WriteOption{Format: FormatJPEG, Quality: q})
+		assert.NoError(t, err)
+		m, _, err := image.Decode(&buf)
+		assert.NoError(t, err)
+		s, err := Compare(src, m)
+		assert.NoError(t, err)
+		if prev != nil {
+			assert.Greater(t, s.MSE, prev.MSE)
+			assert.Less(t, s.PSNR, prev.PSNR)
+			assert.Less(t, s.SSIM, prev.SSIM)
+			assert.Less(t, s.MSSSIM, prev.MSSSIM)
+		}
+		ssim, _ := SSIM(src, m)
+		assert.Equal(t, s.SSIM, ssim)
+		psnr, _ := PSNR(src, m)
+		assert.Equal(t, s.PSNR, psnr)
+		prev = s
+	}
+}
+
+func TestDiffHeatmap(t *testing.T) {
+	src := gradient(30, 20)
+	h, err := DiffHeatmap(src, src)
+	if assert.NoError(t, err) {
+		assert.Equal(t, image.Rect(0, 0, 30, 20), h.Bounds())
+		assert.Equal(t, color.RGBA{A: 255}, h.RGBAAt(3, 4))
+	}
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), src, image.Point{}, draw.Src)
+	dst.SetRGBA(3, 4, color.RGBA{A: 255})
+	h, err = DiffHeatmap(src, dst)
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, color.RGBA{A: 255}, h.RGBAAt(3, 4))
+		assert.Equal(t, color.RGBA{A: 255}, h.RGBAAt(4, 4))
+	}
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, heatColor(255))
+}
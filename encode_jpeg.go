@@ -0,0 +1,873 @@
+package image
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Subsampling JPEG 的色度抽样
+type Subsampling uint8
+
+// Subsampling
+const (
+	Subsample420 Subsampling = iota // 4:2:0, 与标准库相同
+	Subsample422                    // 4:2:2, 只在水平方向抽样
+	Subsample444                    // 4:4:4, 不抽样, 适合有彩色文字的图
+)
+
+// JPEGOption JPEG 编码选项, 使用纯 Go 的编码器
+type JPEGOption struct {
+	Progressive     bool        // 渐进式, 总是使用优化的 Huffman 表
+	Subsampling     Subsampling // 色度抽样
+	OptimizeHuffman bool        // 按图像统计生成 Huffman 表
+	RestartInterval uint16      // 每隔多少个 MCU 插入 RST 标记, 0 为不插入; 不能用于渐进式且有色度抽样的彩色图
+}
+
+// JPEG markers used by the encoder
+const (
+	markerSOF0 = 0xc0
+	markerSOF2 = 0xc2
+	markerDHT  = 0xc4
+	markerRST0 = 0xd0
+	markerDQT  = 0xdb
+	markerDRI  = 0xdd
+)
+
+// jpegComponent 一个颜色分量, 系数按 zigzag 顺序保存
+type jpegComponent struct {
+	id     byte
+	h, v   int // 抽样因子
+	table  int // 量化表及 Huffman 表, 0 为亮度, 1 为色度
+	bw, bh int // 按 MCU 补齐后的块数
+	cw, ch int // 实际覆盖分量的块数, 非交错扫描只编码这些块
+	blocks [][64]int32
+}
+
+func (c *jpegComponent) block(bx, by int) *[64]int32 {
+	return &c.blocks[by*c.bw+bx]
+}
+
+// jpegScan 一次扫描, ss/se 为频谱范围, ah/al 为逐次逼近的位
+type jpegScan struct {
+	comps          []int
+	ss, se, ah, al int
+}
+
+type jpegEncoder struct {
+	opt          JPEGOption
+	w, h         int
+	quant        [2][64]uint16 // zigzag 顺序
+	comps        []*jpegComponent
+	mcusX, mcusY int
+}
+
+// encodeJPEG 按选项编码 JPEG, 灰度图像编码为单通道
+func encodeJPEG(w io.Writer, m image.Image, quality int, opt *JPEGOption) error {
+	b := m.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || b.Dx() > 0xffff || b.Dy() > 0xffff {
+		return errors.New("jpeg: image is too large to encode")
+	}
+	e := &jpegEncoder{opt: *opt, w: b.Dx(), h: b.Dy()}
+	e.setQuality(quality)
+	e.transform(m)
+	if e.opt.Progressive && e.opt.RestartInterval > 0 && e.subsampled() {
+		// image/jpeg 在非交错扫描中按整个 MCU 计算 restart 间隔, 抽样时无法解码
+		return ErrInvalidOption
+	}
+
+	out := []byte{0xff, markerSOI}
+	out = e.appendHeader(out)
+	scans := e.scans()
+	optimize := e.opt.Progressive || e.opt.OptimizeHuffman
+	var tables [2][2]*huffTable
+	if !optimize {
+		for class := range tables {
+			for id := range tables[class] {
+				tables[class][id] = newHuffTable(stdHuffman[class][id].bits, stdHuffman[class][id].vals)
+			}
+		}
+		out = e.appendDHT(out, tables)
+	}
+	for _, s := range scans {
+		if optimize {
+			var freq [2][2][257]int
+			e.encodeScan(s, &jpegBits{freq: &freq})
+			tables = [2][2]*huffTable{}
+			for class := range freq {
+				for id := range freq[class] {
+					if used(&freq[class][id]) {
+						tables[class][id] = optimalHuffTable(&freq[class][id])
+					}
+				}
+			}
+			out = e.appendDHT(out, tables)
+		}
+		out = e.appendSOS(out, s)
+		bits := &jpegBits{out: out, tables: &tables}
+		e.encodeScan(s, bits)
+		out = bits.out
+	}
+	out = append(out, 0xff, markerEOI)
+	_, err := w.Write(out)
+	return err
+}
+
+// subsampled 是否有抽样的分量
+func (e *jpegEncoder) subsampled() bool {
+	for _, c := range e.comps {
+		if c.h != e.comps[0].h || c.v != e.comps[0].v {
+			return true
+		}
+	}
+	return false
+}
+
+func used(freq *[257]int) bool {
+	for _, n := range freq[:256] {
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// setQuality 与标准库相同的量化表缩放
+func (e *jpegEncoder) setQuality(quality int) {
+	quality = min(max(quality, 1), 100)
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for i := range e.quant {
+		for j, v := range unscaledQuant[i] {
+			e.quant[i][j] = uint16(min(max((int(v)*scale+50)/100, 1), 255))
+		}
+	}
+}
+
+// transform 颜色转换, 抽样, DCT 及量化
+func (e *jpegEncoder) transform(m image.Image) {
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	planes := jpegPlanes(m)
+	if len(planes) == 1 {
+		e.comps = []*jpegComponent{{id: 1, h: 1, v: 1}}
+	} else {
+		hy, vy := 2, 2
+		switch e.opt.Subsampling {
+		case Subsample422:
+			vy = 1
+		case Subsample444:
+			hy, vy = 1, 1
+		}
+		e.comps = []*jpegComponent{{id: 1, h: hy, v: vy}, {id: 2, h: 1, v: 1, table: 1}, {id: 3, h: 1, v: 1, table: 1}}
+	}
+	hmax, vmax := e.comps[0].h, e.comps[0].v
+	e.mcusX, e.mcusY = (w+8*hmax-1)/(8*hmax), (h+8*vmax-1)/(8*vmax)
+
+	var in [64]float32
+	for i, c := range e.comps {
+		plane := planes[i]
+		sx, sy := hmax/c.h, vmax/c.v
+		pw, ph := (w+sx-1)/sx, (h+sy-1)/sy // 分量的像素大小
+		c.bw, c.bh = e.mcusX*c.h, e.mcusY*c.v
+		c.cw, c.ch = (pw+7)/8, (ph+7)/8
+		c.blocks = make([][64]int32, c.bw*c.bh)
+		for by := 0; by < c.bh; by++ {
+			for bx := 0; bx < c.bw; bx++ {
+				for j := 0; j < 8; j++ {
+					y := min(by*8+j, ph-1)
+					for i := 0; i < 8; i++ {
+						x := min(bx*8+i, pw-1)
+						var sum int
+						for dy := 0; dy < sy; dy++ {
+							row := plane[min(y*sy+dy, h-1)*w:]
+							for dx := 0; dx < sx; dx++ {
+								sum += int(row[min(x*sx+dx, w-1)])
+							}
+						}
+						in[j*8+i] = float32(sum)/float32(sx*sy) - 128
+					}
+				}
+				fdct(&in, &e.quant[c.table], c.block(bx, by))
+			}
+		}
+	}
+}
+
+// jpegPlanes 返回全尺寸的 Y (灰度) 或 Y, Cb, Cr 平面
+func jpegPlanes(m image.Image) [][]uint8 {
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	switch src := m.(type) {
+	case *image.Gray:
+		p := make([]uint8, w*h)
+		for y := 0; y < h; y++ {
+			i := src.PixOffset(b.Min.X, b.Min.Y+y)
+			copy(p[y*w:(y+1)*w], src.Pix[i:i+w])
+		}
+		return [][]uint8{p}
+	case *image.Gray16:
+		p := make([]uint8, w*h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				p[y*w+x] = uint8(src.Gray16At(b.Min.X+x, b.Min.Y+y).Y >> 8)
+			}
+		}
+		return [][]uint8{p}
+	}
+	at := func(x, y int) (uint8, uint8, uint8) {
+		r, g, b, _ := m.At(x, y).RGBA()
+		return color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+	}
+	switch src := m.(type) {
+	case *image.YCbCr:
+		at = func(x, y int) (uint8, uint8, uint8) {
+			yi, ci := src.YOffset(x, y), src.COffset(x, y)
+			return src.Y[yi], src.Cb[ci], src.Cr[ci]
+		}
+	case *image.RGBA:
+		at = func(x, y int) (uint8, uint8, uint8) {
+			s := src.Pix[src.PixOffset(x, y):]
+			return color.RGBToYCbCr(s[0], s[1], s[2])
+		}
+	}
+	py, pb, pr := make([]uint8, w*h), make([]uint8, w*h), make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			py[i], pb[i], pr[i] = at(b.Min.X+x, b.Min.Y+y)
+		}
+	}
+	return [][]uint8{py, pb, pr}
+}
+
+// dctCos[u][x] = C(u)/2 * cos((2x+1)uπ/16)
+var dctCos = func() (t [8][8]float32) {
+	for u := 0; u < 8; u++ {
+		c := 0.5
+		if u == 0 {
+			c = 0.5 / math.Sqrt2
+		}
+		for x := 0; x < 8; x++ {
+			t[u][x] = float32(c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16))
+		}
+	}
+	return
+}()
+
+// fdct 二维 DCT 后按 q 量化, 结果为 zigzag 顺序
+func fdct(in *[64]float32, q *[64]uint16, out *[64]int32) {
+	var tmp, f [64]float32
+	for y := 0; y < 8; y++ {
+		row := in[y*8 : y*8+8]
+		for u := 0; u < 8; u++ {
+			var s float32
+			for x, v := range row {
+				s += v * dctCos[u][x]
+			}
+			tmp[y*8+u] = s
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			var s float32
+			for y := 0; y < 8; y++ {
+				s += tmp[y*8+u] * dctCos[v][y]
+			}
+			f[v*8+u] = s
+		}
+	}
+	for zz, n := range unzig {
+		c := int32(math.Round(float64(f[n] / float32(q[zz]))))
+		if zz > 0 {
+			c = min(max(c, -1023), 1023) // 标准 AC 表最多 10 位
+		}
+		out[zz] = c
+	}
+}
+
+// scans 基线为一次交错扫描; 渐进式与 libjpeg 的默认脚本相同
+func (e *jpegEncoder) scans() []jpegScan {
+	if !e.opt.Progressive {
+		all := make([]int, len(e.comps))
+		for i := range all {
+			all[i] = i
+		}
+		return []jpegScan{{comps: all, se: 63}}
+	}
+	if len(e.comps) == 1 {
+		return []jpegScan{
+			{[]int{0}, 0, 0, 0, 1},
+			{[]int{0}, 1, 5, 0, 2},
+			{[]int{0}, 6, 63, 0, 2},
+			{[]int{0}, 1, 63, 2, 1},
+			{[]int{0}, 0, 0, 1, 0},
+			{[]int{0}, 1, 63, 1, 0},
+		}
+	}
+	return []jpegScan{
+		{[]int{0, 1, 2}, 0, 0, 0, 1},
+		{[]int{0}, 1, 5, 0, 2},
+		{[]int{2}, 1, 63, 0, 1},
+		{[]int{1}, 1, 63, 0, 1},
+		{[]int{0}, 6, 63, 0, 2},
+		{[]int{0}, 1, 63, 2, 1},
+		{[]int{0, 1, 2}, 0, 0, 1, 0},
+		{[]int{2}, 1, 63, 1, 0},
+		{[]int{1}, 1, 63, 1, 0},
+		{[]int{0}, 1, 63, 1, 0},
+	}
+}
+
+func (e *jpegEncoder) appendHeader(out []byte) []byte {
+	dqt := make([]byte, 0, 130)
+	for i := range e.quant[:min(len(e.comps), 2)] {
+		dqt = append(dqt, byte(i))
+		for _, v := range e.quant[i] {
+			dqt = append(dqt, byte(v))
+		}
+	}
+	out = appendJPEGSegment(out, markerDQT, dqt)
+
+	marker := byte(markerSOF0)
+	if e.opt.Progressive {
+		marker = markerSOF2
+	}
+	sof := []byte{8}
+	sof = binary.BigEndian.AppendUint16(sof, uint16(e.h))
+	sof = binary.BigEndian.AppendUint16(sof, uint16(e.w))
+	sof = append(sof, byte(len(e.comps)))
+	for _, c := range e.comps {
+		sof = append(sof, c.id, byte(c.h<<4|c.v), byte(c.table))
+	}
+	out = appendJPEGSegment(out, marker, sof)
+
+	if e.opt.RestartInterval > 0 {
+		out = appendJPEGSegment(out, markerDRI, binary.BigEndian.AppendUint16(nil, e.opt.RestartInterval))
+	}
+	return out
+}
+
+func (e *jpegEncoder) appendDHT(out []byte, tables [2][2]*huffTable) []byte {
+	var dht []byte
+	for class := range tables {
+		for id, t := range tables[class] {
+			if t == nil || (id > 0 && len(e.comps) == 1) {
+				continue
+			}
+			dht = append(dht, byte(class<<4|id))
+			dht = append(dht, t.bits[:]...)
+			dht = append(dht, t.vals...)
+		}
+	}
+	if len(dht) == 0 {
+		return out
+	}
+	return appendJPEGSegment(out, markerDHT, dht)
+}
+
+func (e *jpegEncoder) appendSOS(out []byte, s jpegScan) []byte {
+	sos := []byte{byte(len(s.comps))}
+	for _, ci := range s.comps {
+		c := e.comps[ci]
+		sos = append(sos, c.id, byte(c.table<<4|c.table))
+	}
+	sos = append(sos, byte(s.ss), byte(s.se), byte(s.ah<<4|s.al))
+	return appendJPEGSegment(out, markerSOS, sos)
+}
+
+// scanState 一次扫描中的预测值及 EOB 游程
+type scanState struct {
+	pred   []int32
+	eobrun int
+	corr   []byte // 逐次逼近中等待输出的修正位
+	table  int    // 当前 AC 表
+}
+
+// encodeScan 编码一次扫描, 交错扫描按 MCU, 非交错扫描按分量的块
+func (e *jpegEncoder) encodeScan(s jpegScan, b *jpegBits) {
+	st := &scanState{pred: make([]int32, len(e.comps))}
+	ri := int(e.opt.RestartInterval)
+	var count, restarts int
+	next := func() {
+		if ri > 0 && count > 0 && count%ri == 0 {
+			e.flushEOB(st, b)
+			b.restart(restarts % 8)
+			restarts++
+			clear(st.pred)
+		}
+		count++
+	}
+	if len(s.comps) > 1 {
+		for my := 0; my < e.mcusY; my++ {
+			for mx := 0; mx < e.mcusX; mx++ {
+				next()
+				for _, ci := range s.comps {
+					c := e.comps[ci]
+					for v := 0; v < c.v; v++ {
+						for h := 0; h < c.h; h++ {
+							e.encodeBlock(s, ci, c.block(mx*c.h+h, my*c.v+v), st, b)
+						}
+					}
+				}
+			}
+		}
+	} else {
+		ci := s.comps[0]
+		c := e.comps[ci]
+		for by := 0; by < c.ch; by++ {
+			for bx := 0; bx < c.cw; bx++ {
+				next()
+				e.encodeBlock(s, ci, c.block(bx, by), st, b)
+			}
+		}
+	}
+	e.flushEOB(st, b)
+	b.flush()
+}
+
+// magnitude 返回值的位数及其编码
+func magnitude(v int32) (uint32, int) {
+	a := v
+	if a < 0 {
+		a = -a
+	}
+	n := 0
+	for a>>n > 0 {
+		n++
+	}
+	if v < 0 {
+		v += 1<<n - 1
+	}
+	return uint32(v) & (1<<n - 1), n
+}
+
+func (e *jpegEncoder) encodeBlock(s jpegScan, ci int, blk *[64]int32, st *scanState, b *jpegBits) {
+	c := e.comps[ci]
+	st.table = c.table
+	if s.ss == 0 {
+		if s.ah > 0 { // DC 修正
+			b.bits(uint32(blk[0]>>s.al)&1, 1)
+			return
+		}
+		v := blk[0] >> s.al
+		bits, n := magnitude(v - st.pred[ci])
+		st.pred[ci] = v
+		b.symbol(0, c.table, byte(n))
+		b.bits(bits, n)
+		if s.se > 0 {
+			e.encodeAC(blk, c.table, b)
+		}
+		return
+	}
+	if s.ah == 0 {
+		e.encodeACFirst(s, blk, st, b)
+	} else {
+		e.encodeACRefine(s, blk, st, b)
+	}
+}
+
+// encodeAC 基线的 AC 系数
+func (e *jpegEncoder) encodeAC(blk *[64]int32, table int, b *jpegBits) {
+	r := 0
+	for k := 1; k < 64; k++ {
+		if blk[k] == 0 {
+			r++
+			continue
+		}
+		for r > 15 {
+			b.symbol(1, table, 0xf0)
+			r -= 16
+		}
+		bits, n := magnitude(blk[k])
+		b.symbol(1, table, byte(r<<4|n))
+		b.bits(bits, n)
+		r = 0
+	}
+	if r > 0 {
+		b.symbol(1, table, 0x00)
+	}
+}
+
+// flushEOB 输出累积的 EOB 游程及其后的修正位
+func (e *jpegEncoder) flushEOB(st *scanState, b *jpegBits) {
+	if st.eobrun == 0 {
+		return
+	}
+	n := 0
+	for st.eobrun>>(n+1) > 0 {
+		n++
+	}
+	b.symbol(1, st.table, byte(n<<4))
+	if n > 0 {
+		b.bits(uint32(st.eobrun)&(1<<n-1), n)
+	}
+	st.eobrun = 0
+	for _, bit := range st.corr {
+		b.bits(uint32(bit), 1)
+	}
+	st.corr = st.corr[:0]
+}
+
+// encodeACFirst 渐进式 AC 的第一次扫描
+func (e *jpegEncoder) encodeACFirst(s jpegScan, blk *[64]int32, st *scanState, b *jpegBits) {
+	r := 0
+	for k := s.ss; k <= s.se; k++ {
+		v := blk[k]
+		a := v
+		if a < 0 {
+			a = -a
+		}
+		a >>= s.al
+		if a == 0 {
+			r++
+			continue
+		}
+		e.flushEOB(st, b)
+		for r > 15 {
+			b.symbol(1, st.table, 0xf0)
+			r -= 16
+		}
+		if v < 0 {
+			a = -a
+		}
+		bits, n := magnitude(a)
+		b.symbol(1, st.table, byte(r<<4|n))
+		b.bits(bits, n)
+		r = 0
+	}
+	if r > 0 {
+		st.eobrun++
+		if st.eobrun == 0x7fff {
+			e.flushEOB(st, b)
+		}
+	}
+}
+
+// encodeACRefine 渐进式 AC 的逐次逼近修正, 与 libjpeg 的 encode_mcu_AC_refine 相同
+func (e *jpegEncoder) encodeACRefine(s jpegScan, blk *[64]int32, st *scanState, b *jpegBits) {
+	var abs [64]int32
+	eob := 0
+	for k := s.ss; k <= s.se; k++ {
+		a := blk[k]
+		if a < 0 {
+			a = -a
+		}
+		abs[k] = a >> s.al
+		if abs[k] == 1 {
+			eob = k
+		}
+	}
+	var br []byte
+	emitBR := func() {
+		for _, bit := range br {
+			b.bits(uint32(bit), 1)
+		}
+		br = br[:0]
+	}
+	r := 0
+	for k := s.ss; k <= s.se; k++ {
+		a := abs[k]
+		if a == 0 {
+			r++
+			continue
+		}
+		for r > 15 && k <= eob {
+			e.flushEOB(st, b)
+			b.symbol(1, st.table, 0xf0)
+			r -= 16
+			emitBR()
+		}
+		if a > 1 { // 之前已非零, 只输出修正位
+			br = append(br, byte(a&1))
+			continue
+		}
+		e.flushEOB(st, b)
+		b.symbol(1, st.table, byte(r<<4|1))
+		sign := uint32(1)
+		if blk[k] < 0 {
+			sign = 0
+		}
+		b.bits(sign, 1)
+		emitBR()
+		r = 0
+	}
+	if r > 0 || len(br) > 0 {
+		st.eobrun++
+		st.corr = append(st.corr, br...)
+		if st.eobrun == 0x7fff || len(st.corr) > 1000-64+1 {
+			e.flushEOB(st, b)
+		}
+	}
+}
+
+// jpegBits 写入扫描数据, freq 不为空时只统计符号频率
+type jpegBits struct {
+	out    []byte
+	tables *[2][2]*huffTable
+	freq   *[2][2][257]int
+	acc    uint32
+	n      int
+}
+
+func (b *jpegBits) symbol(class, id int, s byte) {
+	if b.freq != nil {
+		b.freq[class][id][s]++
+		return
+	}
+	t := b.tables[class][id]
+	b.bits(uint32(t.code[s]), int(t.size[s]))
+}
+
+func (b *jpegBits) bits(v uint32, n int) {
+	if b.freq != nil || n == 0 {
+		return
+	}
+	b.acc = b.acc<<n | v&(1<<n-1)
+	b.n += n
+	for b.n >= 8 {
+		c := byte(b.acc >> (b.n - 8))
+		b.out = append(b.out, c)
+		if c == 0xff {
+			b.out = append(b.out, 0)
+		}
+		b.n -= 8
+	}
+}
+
+// flush 用 1 补齐最后一个字节
+func (b *jpegBits) flush() {
+	if b.n > 0 {
+		b.bits(1<<(8-b.n)-1, 8-b.n)
+	}
+}
+
+func (b *jpegBits) restart(i int) {
+	if b.freq != nil {
+		return
+	}
+	b.flush()
+	b.out = append(b.out, 0xff, byte(markerRST0+i))
+}
+
+// huffTable Huffman 表, bits[i] 为长度 i+1 的码数
+type huffTable struct {
+	bits [16]byte
+	vals []byte
+	code [256]uint16
+	size [256]uint8
+}
+
+func newHuffTable(bits [16]byte, vals []byte) *huffTable {
+	t := &huffTable{bits: bits, vals: vals}
+	code, k := uint16(0), 0
+	for i, n := range bits {
+		for j := 0; j < int(n); j++ {
+			t.code[vals[k]] = code
+			t.size[vals[k]] = uint8(i + 1)
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return t
+}
+
+// optimalHuffTable 按频率生成码长不超过 16 的 Huffman 表, 见 JPEG 标准 K.2
+func optimalHuffTable(freq *[257]int) *huffTable {
+	var f [257]int
+	copy(f[:], freq[:])
+	f[256] = 1 // 保留一个码, 保证没有全 1 的码
+	var codesize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+	for {
+		c1, c2 := -1, -1
+		v := math.MaxInt
+		for i := range f {
+			if f[i] > 0 && f[i] <= v {
+				v, c1 = f[i], i
+			}
+		}
+		v = math.MaxInt
+		for i := range f {
+			if f[i] > 0 && f[i] <= v && i != c1 {
+				v, c2 = f[i], i
+			}
+		}
+		if c2 < 0 {
+			break
+		}
+		f[c1] += f[c2]
+		f[c2] = 0
+		codesize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codesize[c1]++
+		}
+		others[c1] = c2
+		codesize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codesize[c2]++
+		}
+	}
+
+	var bits [33]int
+	for _, n := range codesize {
+		if n > 0 {
+			bits[n]++
+		}
+	}
+	for i := 32; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]-- // 去掉保留的码
+
+	var tb [16]byte
+	for i := range tb {
+		tb[i] = byte(bits[i+1])
+	}
+	var vals []byte
+	for n := 1; n <= 32; n++ {
+		for s := 0; s < 256; s++ {
+			if codesize[s] == n {
+				vals = append(vals, byte(s))
+			}
+		}
+	}
+	return newHuffTable(tb, vals)
+}
+
+// unscaledQuant 未缩放的量化表, zigzag 顺序, 与标准库相同
+var unscaledQuant = [2][64]byte{
+	// Luminance.
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	// Chrominance.
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// stdHuffman JPEG 标准 K.3 的 Huffman 表, 按 [class][id]
+var stdHuffman = [2][2]struct {
+	bits [16]byte
+	vals []byte
+}{
+	{
+		// Luminance DC
+		{
+			[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+			[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+		// Chrominance DC
+		{
+			[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+			[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+	},
+	{
+		// Luminance AC
+		{
+			[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+			[]byte{
+				0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+				0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+				0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+				0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+				0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+				0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+				0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+				0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+				0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+				0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+				0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+				0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+				0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+				0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+				0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+				0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+				0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+				0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+				0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+				0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+				0xf9, 0xfa,
+			},
+		},
+		// Chrominance AC
+		{
+			[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+			[]byte{
+				0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+				0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+				0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+				0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+				0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+				0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+				0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+				0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+				0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+				0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+				0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+				0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+				0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+				0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+				0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+				0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+				0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+				0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+				0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+				0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+				0xf9, 0xfa,
+			},
+		},
+	},
+}
+
+// unzig zigzag 顺序到自然顺序
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
@@ -0,0 +1,143 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gradient a smooth color image with some texture, odd sized to exercise edge padding
+func gradient(w, h int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x ^ y) & 0x1f)
+			m.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128 + v, 255})
+		}
+	}
+	return m
+}
+
+// meanDiff 两个图像每个通道的平均差
+func meanDiff(a, b image.Image) float64 {
+	var sum, n float64
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			for _, d := range []int{int(r1>>8) - int(r2>>8), int(g1>>8) - int(g2>>8), int(b1>>8) - int(b2>>8)} {
+				if d < 0 {
+					d = -d
+				}
+				sum += float64(d)
+				n++
+			}
+		}
+	}
+	return sum / n
+}
+
+func hasMarker(b []byte, marker byte) bool {
+	return bytes.Contains(b, []byte{0xff, marker})
+}
+
+func TestEncodeJPEG(t *testing.T) {
+	src := gradient(77, 53)
+
+	encode := func(opt JPEGOption) ([]byte, image.Image) {
+		var buf bytes.Buffer
+		err := encodeJPEG(&buf, src, 85, &opt)
+		assert.NoError(t, err)
+		m, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		if assert.NotNil(t, m) {
+			assert.Equal(t, src.Bounds(), m.Bounds())
+		}
+		return buf.Bytes(), m
+	}
+
+	std, stdImg := encode(JPEGOption{})
+	assert.True(t, hasMarker(std, markerSOF0))
+	assert.False(t, hasMarker(std, markerSOF2))
+	assert.Less(t, meanDiff(src, stdImg), 4.0)
+
+	var ref bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&ref, src, &jpeg.Options{Quality: 85}))
+	refImg, _ := jpeg.Decode(&ref)
+	assert.Less(t, meanDiff(stdImg, refImg), 2.0)
+
+	opt, optImg := encode(JPEGOption{OptimizeHuffman: true})
+	assert.Less(t, len(opt), len(std))
+	assert.Zero(t, meanDiff(stdImg, optImg), "optimized huffman must not change pixels")
+
+	prog, progImg := encode(JPEGOption{Progressive: true})
+	assert.True(t, hasMarker(prog, markerSOF2))
+	assert.Zero(t, meanDiff(stdImg, progImg), "progressive must decode to the same pixels")
+
+	ratios := map[Subsampling]image.YCbCrSubsampleRatio{
+		Subsample420: image.YCbCrSubsampleRatio420,
+		Subsample422: image.YCbCrSubsampleRatio422,
+		Subsample444: image.YCbCrSubsampleRatio444,
+	}
+	for ss, ratio := range ratios {
+		_, m := encode(JPEGOption{Subsampling: ss, Progressive: true})
+		ycc, ok := m.(*image.YCbCr)
+		if assert.True(t, ok) {
+			assert.Equal(t, ratio, ycc.SubsampleRatio)
+		}
+		assert.Less(t, meanDiff(src, m), 4.0)
+	}
+
+	rst, rstImg := encode(JPEGOption{RestartInterval: 2})
+	assert.True(t, hasMarker(rst, markerDRI))
+	assert.True(t, hasMarker(rst, markerRST0))
+	assert.Zero(t, meanDiff(stdImg, rstImg))
+
+	// image/jpeg 在非交错扫描中按整个 MCU 计算 restart 间隔, 只能解码不抽样的渐进式 restart
+	_, img444 := encode(JPEGOption{Subsampling: Subsample444})
+	rst444, rstProg := encode(JPEGOption{Subsampling: Subsample444, RestartInterval: 3, Progressive: true})
+	assert.True(t, hasMarker(rst444, markerDRI))
+	assert.Zero(t, meanDiff(img444, rstProg))
+	// 抽样时返回错误
+	for _, ss := range []Subsampling{Subsample420, Subsample422} {
+		var buf bytes.Buffer
+		err := encodeJPEG(&buf, src, 85, &JPEGOption{Subsampling: ss, RestartInterval: 3, Progressive: true})
+		assert.ErrorIs(t, err, ErrInvalidOption)
+		assert.Zero(t, buf.Len())
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 33, 17))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7)
+	}
+	for _, o := range []JPEGOption{{}, {Progressive: true}, {OptimizeHuffman: true, RestartInterval: 1}} {
+		var buf bytes.Buffer
+		assert.NoError(t, encodeJPEG(&buf, gray, 90, &o))
+		assert.Equal(t, ColorSpaceGray, jpegColorSpace(bytes.NewReader(buf.Bytes())))
+		m, err := jpeg.Decode(&buf)
+		if assert.NoError(t, err) {
+			assert.IsType(t, &image.Gray{}, m)
+			assert.Less(t, meanDiff(gray, m), 4.0)
+		}
+	}
+}
+
+func TestSaveJPEGOption(t *testing.T) {
+	var in bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&in, gradient(64, 48), nil))
+	im, err := Open(bytes.NewReader(in.Bytes()))
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	_, err = im.SaveTo(&out, &WriteOption{Format: "jpeg", Quality: 80, JPEG: &JPEGOption{Progressive: true}})
+	assert.NoError(t, err)
+	assert.True(t, hasMarker(out.Bytes(), markerSOF2))
+	cfg, err := jpeg.DecodeConfig(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, 64, cfg.Width)
+}
@@ -0,0 +1,326 @@
+package image
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// PNGFilter PNG 每行的滤波方式
+type PNGFilter uint8
+
+// PNGFilter
+const (
+	PNGFilterAdaptive PNGFilter = iota // 每行选择绝对值和最小的滤波, 与标准库相同; 调色板图不滤波
+	PNGFilterNone
+	PNGFilterSub
+	PNGFilterUp
+	PNGFilterAverage
+	PNGFilterPaeth
+)
+
+// PNGOption PNG 编码选项
+type PNGOption struct {
+	Compression png.CompressionLevel // 压缩级别
+	Filter      PNGFilter            // 滤波方式
+	Colors      int                  // 量化为不超过该数目 (最多 256) 的调色板图, 0 为不量化
+	Quantizer   Quantizer            // 量化算法
+	Dither      bool                 // 量化时使用 Floyd-Steinberg 抖动
+}
+
+// PNG color types
+const (
+	pngGray     = 0
+	pngRGB      = 2
+	pngPaletted = 3
+	pngRGBA     = 6
+)
+
+const pngFilterCnt = 5
+
+// encodePNG 按选项编码 PNG, Colors > 0 时先量化为调色板图
+func encodePNG(w io.Writer, m image.Image, opt *PNGOption) error {
+	if opt.Colors > 0 {
+		if pm, ok := m.(*image.Paletted); !ok || len(pm.Palette) > opt.Colors {
+			var dither float32
+			if opt.Dither {
+				dither = 1
+			}
+			m = quantizeImage(m, opt.Quantizer, opt.Colors, dither, alphaKeep)
+		}
+	}
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	ct, depth, bpp := pngColorType(m)
+
+	bw := bufio.NewWriter(w)
+	_, _ = bw.Write(pngSignature)
+	ihdr := binary.BigEndian.AppendUint32(nil, uint32(b.Dx()))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(b.Dy()))
+	ihdr = append(ihdr, byte(depth), byte(ct), 0, 0, 0)
+	writePNGChunk(bw, "IHDR", ihdr)
+	if pm, ok := m.(*image.Paletted); ok {
+		plte, trns := pngPalette(pm.Palette)
+		writePNGChunk(bw, "PLTE", plte)
+		if len(trns) > 0 {
+			writePNGChunk(bw, "tRNS", trns)
+		}
+	}
+
+	idat := &pngChunkWriter{w: bw, name: "IDAT"}
+	zw, err := zlib.NewWriterLevel(idat, zlibLevel(opt.Compression))
+	if err != nil {
+		return err
+	}
+	filter := opt.Filter
+	if filter == PNGFilterAdaptive && (ct == pngPaletted || depth < 8 || opt.Compression == png.NoCompression) {
+		filter = PNGFilterNone
+	}
+	stride := b.Dx() * bpp
+	if depth < 8 {
+		stride = (b.Dx()*depth + 7) / 8
+	}
+	prev, cur := make([]byte, stride), make([]byte, stride)
+	var out [pngFilterCnt][]byte
+	for i := range out {
+		out[i] = make([]byte, stride+1)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		pngRow(m, y, ct, depth, cur)
+		row := filterRow(filter, cur, prev, bpp, &out)
+		if _, err = zw.Write(row); err != nil {
+			return err
+		}
+		prev, cur = cur, prev
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	idat.flush()
+	writePNGChunk(bw, "IEND", nil)
+	return bw.Flush()
+}
+
+// pngColorType 返回颜色类型, 位深及每像素的字节数 (位深小于 8 时为 1)
+func pngColorType(m image.Image) (ct, depth, bpp int) {
+	switch pm := m.(type) {
+	case *image.Paletted:
+		switch n := len(pm.Palette); {
+		case n <= 2:
+			depth = 1
+		case n <= 4:
+			depth = 2
+		case n <= 16:
+			depth = 4
+		default:
+			depth = 8
+		}
+		return pngPaletted, depth, 1
+	case *image.Gray:
+		return pngGray, 8, 1
+	case *image.Gray16:
+		return pngGray, 16, 2
+	}
+	opaque := isOpaque(m)
+	if isDeep(m) {
+		if opaque {
+			return pngRGB, 16, 6
+		}
+		return pngRGBA, 16, 8
+	}
+	if opaque {
+		return pngRGB, 8, 3
+	}
+	return pngRGBA, 8, 4
+}
+
+// pngPalette 返回 PLTE 及去掉末尾不透明项的 tRNS
+func pngPalette(p color.Palette) (plte, trns []byte) {
+	last := -1
+	for i, c := range p {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		plte = append(plte, n.R, n.G, n.B)
+		trns = append(trns, n.A)
+		if n.A != 0xff {
+			last = i
+		}
+	}
+	return plte, trns[:last+1]
+}
+
+// pngRow 把第 y 行按颜色类型写入 row
+func pngRow(m image.Image, y, ct, depth int, row []byte) {
+	b := m.Bounds()
+	switch pm := m.(type) {
+	case *image.Paletted:
+		off := pm.PixOffset(b.Min.X, y)
+		pix := pm.Pix[off : off+b.Dx()]
+		if depth == 8 {
+			copy(row, pix)
+			return
+		}
+		clear(row)
+		per := 8 / depth
+		for i, v := range pix {
+			row[i/per] |= v << (8 - depth*(i%per+1))
+		}
+		return
+	case *image.Gray:
+		off := pm.PixOffset(b.Min.X, y)
+		copy(row, pm.Pix[off:off+b.Dx()])
+		return
+	case *image.Gray16:
+		off := pm.PixOffset(b.Min.X, y)
+		copy(row, pm.Pix[off:off+b.Dx()*2])
+		return
+	case *image.NRGBA:
+		if ct == pngRGBA {
+			off := pm.PixOffset(b.Min.X, y)
+			copy(row, pm.Pix[off:off+b.Dx()*4])
+			return
+		}
+	}
+	i := 0
+	for x := b.Min.X; x < b.Max.X; x++ {
+		if depth == 16 {
+			c := color.NRGBA64Model.Convert(m.At(x, y)).(color.NRGBA64)
+			row = binary.BigEndian.AppendUint16(row[:i], c.R)
+			row = binary.BigEndian.AppendUint16(row, c.G)
+			row = binary.BigEndian.AppendUint16(row, c.B)
+			if ct == pngRGBA {
+				row = binary.BigEndian.AppendUint16(row, c.A)
+			}
+			i = len(row)
+			continue
+		}
+		c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+		row[i], row[i+1], row[i+2] = c.R, c.G, c.B
+		i += 3
+		if ct == pngRGBA {
+			row[i] = c.A
+			i++
+		}
+	}
+}
+
+// filterRow 滤波一行, 返回带滤波类型字节的数据; unit 为左侧对应字节的距离
+func filterRow(f PNGFilter, cur, prev []byte, unit int, out *[pngFilterCnt][]byte) []byte {
+	if f != PNGFilterAdaptive {
+		t := int(f) - 1
+		applyFilter(t, cur, prev, unit, out[t])
+		return out[t]
+	}
+	best, bestSum := 0, -1
+	for t := range out {
+		applyFilter(t, cur, prev, unit, out[t])
+		sum := 0
+		for _, v := range out[t][1:] {
+			sum += abs8(v)
+			if bestSum >= 0 && sum >= bestSum {
+				break
+			}
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = t, sum
+		}
+	}
+	return out[best]
+}
+
+// abs8 把字节看作有符号数的绝对值
+func abs8(v byte) int {
+	if v < 128 {
+		return int(v)
+	}
+	return 256 - int(v)
+}
+
+func applyFilter(t int, cur, prev []byte, unit int, out []byte) {
+	out[0] = byte(t)
+	dst := out[1:]
+	for i, x := range cur {
+		var a, b, c byte
+		if i >= unit {
+			a, c = cur[i-unit], prev[i-unit]
+		}
+		b = prev[i]
+		switch t {
+		case 0:
+			dst[i] = x
+		case 1:
+			dst[i] = x - a
+		case 2:
+			dst[i] = x - b
+		case 3:
+			dst[i] = x - byte((int(a)+int(b))/2)
+		case 4:
+			dst[i] = x - paeth(a, b, c)
+		}
+	}
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := p-int(a), p-int(b), p-int(c)
+	if pa < 0 {
+		pa = -pa
+	}
+	if pb < 0 {
+		pb = -pb
+	}
+	if pc < 0 {
+		pc = -pc
+	}
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func zlibLevel(l png.CompressionLevel) int {
+	switch l {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	}
+	return zlib.DefaultCompression
+}
+
+func writePNGChunk(w *bufio.Writer, typ string, data []byte) {
+	_, _ = w.Write(appendPNGChunk(nil, typ, data))
+}
+
+// pngChunkWriter 把压缩数据分成不超过 1<<16 字节的块
+type pngChunkWriter struct {
+	w    *bufio.Writer
+	name string
+	buf  []byte
+}
+
+func (c *pngChunkWriter) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	for len(c.buf) >= 1<<16 {
+		writePNGChunk(c.w, c.name, c.buf[:1<<16])
+		c.buf = c.buf[1<<16:]
+	}
+	return len(p), nil
+}
+
+func (c *pngChunkWriter) flush() {
+	if len(c.buf) > 0 {
+		writePNGChunk(c.w, c.name, c.buf)
+		c.buf = nil
+	}
+}
@@ -0,0 +1,138 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// samePixels 比较两个图像非预乘的 16 位像素
+func samePixels(t *testing.T, want, got image.Image) {
+	t.Helper()
+	if !assert.Equal(t, want.Bounds(), got.Bounds()) {
+		return
+	}
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			w := color.NRGBA64Model.Convert(want.At(x, y))
+			g := color.NRGBA64Model.Convert(got.At(x, y))
+			if !assert.Equal(t, w, g, "pixel %d,%d", x, y) {
+				return
+			}
+		}
+	}
+}
+
+func TestEncodePNG(t *testing.T) {
+	alpha := image.NewNRGBA(image.Rect(0, 0, 37, 21))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = uint8(i * 13)
+	}
+	deep := image.NewNRGBA64(image.Rect(0, 0, 9, 7))
+	for i := range deep.Pix {
+		deep.Pix[i] = uint8(i * 29)
+	}
+	gray16 := image.NewGray16(image.Rect(0, 0, 10, 3))
+	for i := range gray16.Pix {
+		gray16.Pix[i] = uint8(i * 7)
+	}
+	gray := image.NewGray(image.Rect(0, 0, 11, 5))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 3)
+	}
+	pal := image.NewPaletted(image.Rect(0, 0, 13, 5), color.Palette{color.Black, color.White, color.NRGBA{255, 0, 0, 128}})
+	for i := range pal.Pix {
+		pal.Pix[i] = uint8(i % 3)
+	}
+	images := []image.Image{gradient(23, 17), alpha, deep, gray16, gray, pal, alpha.SubImage(image.Rect(3, 2, 20, 9))}
+
+	for _, m := range images {
+		for f := PNGFilterAdaptive; f <= PNGFilterPaeth; f++ {
+			var buf bytes.Buffer
+			err := encodePNG(&buf, m, &PNGOption{Filter: f})
+			assert.NoError(t, err)
+			got, err := png.Decode(&buf)
+			if assert.NoError(t, err) {
+				samePixels(t, m, translateTo(got, m.Bounds().Min))
+			}
+		}
+	}
+
+	src := gradient(64, 64)
+	var none, best bytes.Buffer
+	assert.NoError(t, encodePNG(&none, src, &PNGOption{Compression: png.NoCompression}))
+	assert.NoError(t, encodePNG(&best, src, &PNGOption{Compression: png.BestCompression}))
+	assert.Less(t, best.Len(), none.Len())
+}
+
+// translateTo 解码的图像从原点开始, 移动到 min 以便与原图比较
+func translateTo(m image.Image, min image.Point) image.Image {
+	if min == (image.Point{}) {
+		return m
+	}
+	b := m.Bounds().Add(min)
+	dst := image.NewNRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.Set(x, y, m.At(x-min.X, y-min.Y))
+		}
+	}
+	return dst
+}
+
+func TestQuantizePNG(t *testing.T) {
+	// 少于目标颜色数时不损失
+	few := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 128}, {0, 0, 0, 0}, {10, 20, 30, 255}}
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			few.SetNRGBA(x, y, colors[(x/5+y/5)%len(colors)])
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, encodePNG(&buf, few, &PNGOption{Colors: 16}))
+	got, err := png.Decode(&buf)
+	assert.NoError(t, err)
+	if pm, ok := got.(*image.Paletted); assert.True(t, ok) {
+		assert.Len(t, pm.Palette, 4)
+	}
+	samePixels(t, few, got)
+
+	src := photo(80, 60)
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 60; y++ {
+			src.Set(x, y, color.Transparent)
+		}
+	}
+	var full bytes.Buffer
+	assert.NoError(t, png.Encode(&full, src))
+	for _, dither := range []bool{false, true} {
+		buf.Reset()
+		assert.NoError(t, encodePNG(&buf, src, &PNGOption{Colors: 64, Dither: dither, Compression: png.BestCompression}))
+		assert.Less(t, buf.Len(), full.Len())
+		got, err = png.Decode(&buf)
+		assert.NoError(t, err)
+		pm, ok := got.(*image.Paletted)
+		if assert.True(t, ok) {
+			assert.LessOrEqual(t, len(pm.Palette), 64)
+		}
+		assert.Less(t, meanDiff(src, got), 6.0)
+		_, _, _, a := got.At(5, 5).RGBA()
+		assert.Zero(t, a, "transparent area stays transparent")
+	}
+
+	im, err := Open(bytes.NewReader(full.Bytes()))
+	assert.NoError(t, err)
+	buf.Reset()
+	_, err = im.SaveTo(&buf, &WriteOption{Format: FormatPNG, PNG: &PNGOption{Colors: 32}})
+	assert.NoError(t, err)
+	assert.Less(t, buf.Len(), full.Len())
+	cfg, err := png.DecodeConfig(&buf)
+	assert.NoError(t, err)
+	assert.IsType(t, color.Palette{}, cfg.ColorModel)
+}
@@ -0,0 +1,311 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// TIFFCompression TIFF 的压缩方式
+type TIFFCompression uint8
+
+// TIFFCompression
+const (
+	TIFFDeflate TIFFCompression = iota // Adobe Deflate (zlib)
+	TIFFLZW
+	TIFFUncompressed
+)
+
+// TIFFOption TIFF 编码选项
+type TIFFOption struct {
+	Compression TIFFCompression // 压缩方式
+	Predictor   bool            // 水平差分预测, 对照片通常可以提高压缩率
+}
+
+// TIFF tags
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffXResolution     = 282
+	tiffYResolution     = 283
+	tiffResolutionUnit  = 296
+	tiffPredictor       = 317
+	tiffColorMap        = 320
+	tiffExtraSamples    = 338
+)
+
+// TIFF field types
+const (
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+type tiffEntry struct {
+	tag, typ uint16
+	vals     []uint32
+}
+
+// tiffPageData 一页压缩后的像素及 IFD, StripOffsets 在写入时确定
+type tiffPageData struct {
+	data    []byte
+	entries []tiffEntry
+}
+
+// encodeTIFF 编码为大端的单页 TIFF
+func encodeTIFF(w io.Writer, m image.Image, opt *TIFFOption) error {
+	p, err := encodeTIFFPage(m, opt)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(writeTIFF([]*tiffPageData{p}))
+	return err
+}
+
+// writeTIFF 依次写入各页的像素及 IFD, 并链接各页的 IFD
+func writeTIFF(pages []*tiffPageData) []byte {
+	out := append([]byte("MM\x00\x2a"), 0, 0, 0, 0)
+	next := 4 // 指向下一个 IFD 的位置
+	for _, p := range pages {
+		offset := len(out)
+		out = append(out, p.data...)
+		if len(out)&1 == 1 {
+			out = append(out, 0)
+		}
+		for i := range p.entries {
+			if p.entries[i].tag == tiffStripOffsets {
+				p.entries[i].vals = []uint32{uint32(offset)}
+			}
+		}
+		binary.BigEndian.PutUint32(out[next:], uint32(len(out)))
+		out, next = appendIFD(out, p.entries)
+	}
+	return out
+}
+
+// encodeTIFFPage 压缩一页, 全部像素在一个 strip 中; 位深及透明与 PNG 的选择相同
+func encodeTIFFPage(m image.Image, opt *TIFFOption) (*tiffPageData, error) {
+	b := m.Bounds()
+	if b.Empty() {
+		return nil, ErrEmptyImage
+	}
+	if pm, ok := m.(*image.Paletted); ok && !isOpaque(pm) {
+		// 调色板不能带透明
+		dst := image.NewNRGBA(b)
+		draw.Draw(dst, b, m, b.Min, draw.Src)
+		m = dst
+	}
+	ct, depth, bpp := pngColorType(m)
+	if depth == 2 || depth == 4 {
+		depth = 8 // 常见的解码器, 包括 x/image, 只支持 1 或 8 位的调色板
+	}
+	stride := b.Dx() * bpp
+	if depth < 8 {
+		stride = (b.Dx()*depth + 7) / 8
+	}
+	predictor := opt.Predictor && depth >= 8
+
+	var raw bytes.Buffer
+	var dst io.Writer = &raw
+	var zw *zlib.Writer
+	if opt.Compression == TIFFDeflate {
+		zw = zlib.NewWriter(&raw)
+		dst = zw
+	}
+	row := make([]byte, stride)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		pngRow(m, y, ct, depth, row)
+		if predictor {
+			tiffDifference(row, bpp, depth)
+		}
+		if _, err := dst.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	data := raw.Bytes()
+	compression := uint32(8)
+	switch opt.Compression {
+	case TIFFLZW:
+		data, compression = tiffLZW(data), 5
+	case TIFFUncompressed:
+		compression = 1
+	}
+
+	spp := bpp
+	if depth == 16 {
+		spp /= 2
+	}
+	bits := make([]uint32, spp)
+	for i := range bits {
+		bits[i] = uint32(depth)
+	}
+	photometric := uint32(2) // RGB
+	switch ct {
+	case pngGray:
+		photometric = 1 // BlackIsZero
+	case pngPaletted:
+		photometric = 3
+	}
+	entries := []tiffEntry{
+		{tiffImageWidth, tiffLong, []uint32{uint32(b.Dx())}},
+		{tiffImageLength, tiffLong, []uint32{uint32(b.Dy())}},
+		{tiffBitsPerSample, tiffShort, bits},
+		{tiffCompression, tiffShort, []uint32{compression}},
+		{tiffPhotometric, tiffShort, []uint32{photometric}},
+		{tiffStripOffsets, tiffLong, []uint32{0}},
+		{tiffSamplesPerPixel, tiffShort, []uint32{uint32(spp)}},
+		{tiffRowsPerStrip, tiffLong, []uint32{uint32(b.Dy())}},
+		{tiffStripByteCounts, tiffLong, []uint32{uint32(len(data))}},
+		{tiffXResolution, tiffRational, []uint32{72, 1}},
+		{tiffYResolution, tiffRational, []uint32{72, 1}},
+		{tiffResolutionUnit, tiffShort, []uint32{2}}, // inch
+	}
+	if predictor {
+		entries = append(entries, tiffEntry{tiffPredictor, tiffShort, []uint32{2}})
+	}
+	if pm, ok := m.(*image.Paletted); ok {
+		entries = append(entries, tiffEntry{tiffColorMap, tiffShort, tiffColorMapOf(pm.Palette, depth)})
+	}
+	if ct == pngRGBA {
+		entries = append(entries, tiffEntry{tiffExtraSamples, tiffShort, []uint32{2}}) // unassociated alpha
+	}
+	return &tiffPageData{data: data, entries: entries}, nil
+}
+
+// appendIFD 写入 IFD, 放不下的值紧随其后; 返回指向下一个 IFD 的位置
+func appendIFD(out []byte, entries []tiffEntry) ([]byte, int) {
+	extra := uint32(len(out) + 2 + 12*len(entries) + 4)
+	var values []byte
+	out = binary.BigEndian.AppendUint16(out, uint16(len(entries)))
+	for _, e := range entries {
+		var v []byte
+		count := len(e.vals)
+		switch e.typ {
+		case tiffShort:
+			for _, x := range e.vals {
+				v = binary.BigEndian.AppendUint16(v, uint16(x))
+			}
+		case tiffRational:
+			count /= 2
+			fallthrough
+		default:
+			for _, x := range e.vals {
+				v = binary.BigEndian.AppendUint32(v, x)
+			}
+		}
+		out = binary.BigEndian.AppendUint16(out, e.tag)
+		out = binary.BigEndian.AppendUint16(out, e.typ)
+		out = binary.BigEndian.AppendUint32(out, uint32(count))
+		if len(v) <= 4 {
+			out = append(out, v...)
+			out = append(out, make([]byte, 4-len(v))...)
+			continue
+		}
+		out = binary.BigEndian.AppendUint32(out, extra+uint32(len(values)))
+		values = append(values, v...)
+	}
+	next := len(out)
+	out = binary.BigEndian.AppendUint32(out, 0)
+	return append(out, values...), next
+}
+
+// tiffColorMapOf 调色板补齐到 1<<depth 项, 先全部 R, 再 G, 再 B
+func tiffColorMapOf(p color.Palette, depth int) []uint32 {
+	n := 1 << depth
+	cm := make([]uint32, 3*n)
+	for i, c := range p {
+		r, g, b, _ := c.RGBA()
+		cm[i], cm[n+i], cm[2*n+i] = r, g, b
+	}
+	return cm
+}
+
+// tiffDifference 水平差分, 16 位的样本按大端处理
+func tiffDifference(row []byte, bpp, depth int) {
+	if depth == 16 {
+		for i := len(row) - 2; i >= bpp; i -= 2 {
+			v := binary.BigEndian.Uint16(row[i:]) - binary.BigEndian.Uint16(row[i-bpp:])
+			binary.BigEndian.PutUint16(row[i:], v)
+		}
+		return
+	}
+	for i := len(row) - 1; i >= bpp; i-- {
+		row[i] -= row[i-bpp]
+	}
+}
+
+// tiffLZW TIFF 的 LZW 压缩: 高位在前, 码长比标准的 LZW 提前一个码增加
+func tiffLZW(src []byte) []byte {
+	const (
+		clearCode = 256
+		eoiCode   = 257
+		maxCode   = 4094
+	)
+	var out []byte
+	var acc uint64
+	var nbits uint
+	width := uint(9)
+	put := func(code uint32) {
+		acc = acc<<width | uint64(code)
+		nbits += width
+		for nbits >= 8 {
+			nbits -= 8
+			out = append(out, byte(acc>>nbits))
+		}
+	}
+	dict := make(map[uint32]uint32)
+	hi := uint32(eoiCode)
+	// emit 写入一个码, 与解码器相同地推进 hi 及码长
+	emit := func(code uint32) bool {
+		put(code)
+		hi++
+		if hi == maxCode {
+			put(clearCode)
+			clear(dict)
+			width, hi = 9, eoiCode
+			return false
+		}
+		if hi+1 >= 1<<width {
+			width++
+		}
+		return true
+	}
+
+	put(clearCode)
+	if len(src) > 0 {
+		p := uint32(src[0])
+		for _, c := range src[1:] {
+			key := p<<8 | uint32(c)
+			if code, ok := dict[key]; ok {
+				p = code
+				continue
+			}
+			if emit(p) {
+				dict[key] = hi
+			}
+			p = uint32(c)
+		}
+		emit(p)
+	}
+	put(eoiCode)
+	if nbits > 0 {
+		out = append(out, byte(acc<<(8-nbits)))
+	}
+	return out
+}
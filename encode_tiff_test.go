@@ -0,0 +1,136 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+func TestEncodeTIFF(t *testing.T) {
+	alpha := image.NewNRGBA(image.Rect(0, 0, 37, 21))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = uint8(i * 13)
+	}
+	deep := image.NewNRGBA64(image.Rect(0, 0, 9, 7))
+	for i := range deep.Pix {
+		deep.Pix[i] = uint8(i * 29)
+	}
+	gray16 := image.NewGray16(image.Rect(0, 0, 10, 3))
+	for i := range gray16.Pix {
+		gray16.Pix[i] = uint8(i * 7)
+	}
+	pal := image.NewPaletted(image.Rect(0, 0, 13, 5), color.Palette{color.Black, color.White, color.NRGBA{255, 0, 0, 255}})
+	for i := range pal.Pix {
+		pal.Pix[i] = uint8(i % 3)
+	}
+	trans := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Transparent, color.White})
+	trans.Pix[5] = 1
+	images := []image.Image{photo(120, 90), alpha, deep, gray16, pal, trans, alpha.SubImage(image.Rect(3, 2, 20, 9))}
+
+	for _, m := range images {
+		for _, c := range []TIFFCompression{TIFFDeflate, TIFFLZW, TIFFUncompressed} {
+			for _, pred := range []bool{false, true} {
+				var buf bytes.Buffer
+				assert.NoError(t, encodeTIFF(&buf, m, &TIFFOption{Compression: c, Predictor: pred}))
+				got, err := tiff.Decode(&buf)
+				if assert.NoError(t, err, "compression %d predictor %v", c, pred) {
+					samePixels(t, m, translateTo(got, m.Bounds().Min))
+				}
+			}
+		}
+	}
+
+	// LZW 需要多次清空码表
+	big := photo(300, 200)
+	sizes := map[TIFFCompression]int{}
+	for _, c := range []TIFFCompression{TIFFDeflate, TIFFLZW, TIFFUncompressed} {
+		var buf bytes.Buffer
+		assert.NoError(t, encodeTIFF(&buf, big, &TIFFOption{Compression: c, Predictor: true}))
+		sizes[c] = buf.Len()
+		got, err := tiff.Decode(&buf)
+		if assert.NoError(t, err) {
+			assert.Zero(t, meanDiff(big, got))
+		}
+	}
+	assert.Less(t, sizes[TIFFDeflate], sizes[TIFFUncompressed])
+	assert.Less(t, sizes[TIFFLZW], sizes[TIFFUncompressed])
+}
+
+func TestTIFFPages(t *testing.T) {
+	var pages []*tiffPageData
+	for _, w := range []int{30, 20, 10} {
+		p, err := encodeTIFFPage(gradient(w, 8), &TIFFOption{})
+		assert.NoError(t, err)
+		pages = append(pages, p)
+	}
+	data := writeTIFF(pages)
+
+	im, err := Open(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, FormatTIFF, im.Format)
+	assert.Equal(t, ".tif", im.Ext)
+	assert.Equal(t, "image/tiff", im.Mime)
+	assert.Equal(t, 3, im.Pages)
+	assert.Equal(t, 30, int(im.Width))
+
+	for _, lazy := range []bool{false, true} {
+		im, err = OpenWith(bytes.NewReader(data), &ReadOption{Page: 1, Lazy: lazy})
+		assert.NoError(t, err)
+		assert.Equal(t, 20, int(im.Width))
+		var buf bytes.Buffer
+		_, err = im.SaveTo(&buf, &WriteOption{Format: FormatPNG})
+		assert.NoError(t, err)
+		cfg, _, err := image.DecodeConfig(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, 20, cfg.Width)
+	}
+
+	// 多页时不复制原图
+	im, err = OpenWith(bytes.NewReader(data), &ReadOption{Page: 2})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = im.SaveTo(&buf, &WriteOption{TIFF: &TIFFOption{Compression: TIFFUncompressed}})
+	assert.NoError(t, err)
+	cfg, err := tiff.DecodeConfig(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, cfg.Width)
+
+	_, err = OpenWith(bytes.NewReader(data), &ReadOption{Page: 3})
+	assert.Equal(t, ErrPageNotFound, err)
+}
+
+func TestTIFFBadOffset(t *testing.T) {
+	// 第一个 IFD 偏移远超文件末尾
+	for _, hdr := range []string{"II\x2a\x00\xf0\xff\xff\x7f", "MM\x00\x2a\x7f\xff\xff\xf0"} {
+		bomb := append([]byte(hdr), make([]byte, 32)...)
+
+		_, err := Probe(bytes.NewReader(bomb))
+		assert.ErrorIs(t, err, ErrInvalidFormat)
+		_, err = Open(bytes.NewReader(bomb))
+		assert.ErrorIs(t, err, ErrInvalidFormat)
+		_, err = OpenWith(bytes.NewReader(bomb), &ReadOption{Page: 1})
+		assert.ErrorIs(t, err, ErrInvalidFormat)
+		_, err = tiffDecodeConfig(bytes.NewReader(bomb))
+		assert.ErrorIs(t, err, ErrInvalidFormat)
+	}
+}
+
+func TestBMP(t *testing.T) {
+	src := gradient(20, 10)
+	var buf bytes.Buffer
+	_, err := SaveTo(&buf, src, &WriteOption{Format: ".bmp"})
+	assert.NoError(t, err)
+	im, err := Open(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, FormatBMP, im.Format)
+	assert.Equal(t, "image/bmp", im.Mime)
+	got, err := bmp.Decode(&buf)
+	if assert.NoError(t, err) {
+		assert.Zero(t, meanDiff(src, got))
+	}
+}
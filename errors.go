@@ -8,6 +8,16 @@ import (
 var (
 	ErrInvalidFormat   = errors.New("invalid image format")
 	ErrUnsupportFormat = errors.New("unsupported image format")
-	ErrOrigTooSmall    = errors.New("original image too small")
 	ErrEmptyImage      = errors.New("image is empty")
+	ErrImageTooLarge   = errors.New("image too large")
+	ErrInvalidOption   = errors.New("invalid encode option")
+	ErrPageNotFound    = errors.New("page not found")
+	ErrNoCodec         = errors.New("codec not available in this build")
+	ErrOverMaxBytes    = errors.New("cannot fit in max bytes")
+	ErrSizeMismatch    = errors.New("image sizes differ")
+)
+
+var (
+	// Deprecated: 原图小于缩略图尺寸时照常处理, 不再返回此错误
+	ErrOrigTooSmall = errors.New("original image too small")
 )
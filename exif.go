@@ -0,0 +1,334 @@
+package image
+
+import (
+	"encoding/binary"
+	"io"
+	"slices"
+)
+
+// EXIF tags
+const (
+	exifTagOrientation      = 0x0112
+	exifTagArtist           = 0x013b
+	exifTagThumbOffset      = 0x0201
+	exifTagThumbLength      = 0x0202
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagMakerNote        = 0x927c
+	exifTagXPAuthor         = 0x9c9d
+	exifTagInteropIFD       = 0xa005
+	exifTagImageUniqueID    = 0xa420
+	exifTagCameraOwnerName  = 0xa430
+	exifTagBodySerialNumber = 0xa431
+	exifTagLensSerialNumber = 0xa435
+	exifTagCameraSerial     = 0xc62f // DNG
+)
+
+// ExifScrub 需要从 EXIF 中移除的隐私信息
+type ExifScrub uint8
+
+// ExifScrub
+const (
+	ScrubGPS       ExifScrub = 1 << iota // GPS IFD
+	ScrubSerial                          // 机身/镜头序列号, ImageUniqueID
+	ScrubOwner                           // 机主, 作者名字
+	ScrubMakerNote                       // 厂商私有数据
+	ScrubThumbnail                       // IFD1 缩略图
+
+	ScrubNone    ExifScrub = 0
+	ScrubPrivacy           = ScrubGPS | ScrubSerial | ScrubOwner | ScrubMakerNote | ScrubThumbnail
+)
+
+var (
+	exifTypeSize = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4}
+
+	scrubTags = map[ExifScrub][]uint16{
+		ScrubGPS:       {exifTagGPSIFD},
+		ScrubSerial:    {exifTagImageUniqueID, exifTagBodySerialNumber, exifTagLensSerialNumber, exifTagCameraSerial},
+		ScrubOwner:     {exifTagArtist, exifTagXPAuthor, exifTagCameraOwnerName},
+		ScrubMakerNote: {exifTagMakerNote},
+	}
+)
+
+const exifMaxDepth = 4
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+)
+
+// exifByteOrder 解析 TIFF 头
+func exifByteOrder(b []byte) (binary.ByteOrder, bool) {
+	if len(b) < 8 {
+		return nil, false
+	}
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+	if order.Uint16(b[2:]) != 42 {
+		return nil, false
+	}
+	return order, true
+}
+
+// exifOrientationOffset 返回 IFD0 中 Orientation 值的位置, 没有则返回 -1
+func exifOrientationOffset(b []byte) (binary.ByteOrder, int) {
+	order, ok := exifByteOrder(b)
+	if !ok {
+		return nil, -1
+	}
+	off := int(order.Uint32(b[4:]))
+	if off < 8 || off+2 > len(b) {
+		return nil, -1
+	}
+	count := int(order.Uint16(b[off:]))
+	for i := 0; i < count; i++ {
+		p := off + 2 + i*12
+		if p+12 > len(b) {
+			break
+		}
+		// type SHORT(3), count 1, value in first two bytes
+		if order.Uint16(b[p:]) == exifTagOrientation && order.Uint16(b[p+2:]) == 3 {
+			return order, p + 8
+		}
+	}
+	return nil, -1
+}
+
+// exifOrientation 返回 EXIF 中的 Orientation, 没有则返回 0
+func exifOrientation(b []byte) Orientation {
+	order, p := exifOrientationOffset(b)
+	if p < 0 {
+		return 0
+	}
+	o := Orientation(order.Uint16(b[p:]))
+	if o > OrientRotate270 {
+		return 0
+	}
+	return o
+}
+
+// exifSetOrientation 直接改写 EXIF 中的 Orientation
+func exifSetOrientation(b []byte, o Orientation) bool {
+	order, p := exifOrientationOffset(b)
+	if p < 0 {
+		return false
+	}
+	order.PutUint16(b[p:], uint16(o))
+	return true
+}
+
+// ReadOrientation 读取 JPEG 的 EXIF Orientation, 没有则返回 0
+func ReadOrientation(r io.Reader) Orientation {
+	exif, err := readJPEGExif(r)
+	if err != nil || exif == nil {
+		return 0
+	}
+	return exifOrientation(exif)
+}
+
+type exifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+	sub   *exifIFD // ExifIFD, GPS, Interop
+}
+
+type exifIFD struct {
+	entries []exifEntry
+	thumb   []byte // IFD1 中的 JPEG 缩略图
+}
+
+// exifData 解析后的 TIFF 结构, 只处理 IFD0 及其子 IFD 和 IFD1
+type exifData struct {
+	order binary.ByteOrder
+	ifd0  *exifIFD
+	ifd1  *exifIFD
+}
+
+func isSubIFDTag(tag uint16) bool {
+	return tag == exifTagExifIFD || tag == exifTagGPSIFD || tag == exifTagInteropIFD
+}
+
+func parseExif(b []byte) (*exifData, error) {
+	order, ok := exifByteOrder(b)
+	if !ok {
+		return nil, ErrInvalidFormat
+	}
+	ed := &exifData{order: order}
+	var next int
+	var err error
+	ed.ifd0, next, err = ed.parseIFD(b, int(order.Uint32(b[4:])), 0)
+	if err != nil {
+		return nil, err
+	}
+	if next > 0 {
+		// IFD1 损坏时忽略
+		if ifd1, _, err := ed.parseIFD(b, next, exifMaxDepth); err == nil {
+			ed.ifd1 = ifd1
+		}
+	}
+	return ed, nil
+}
+
+func (ed *exifData) parseIFD(b []byte, off, depth int) (*exifIFD, int, error) {
+	order := ed.order
+	if off < 8 || off+2 > len(b) {
+		return nil, 0, ErrInvalidFormat
+	}
+	count := int(order.Uint16(b[off:]))
+	if off+2+count*12+4 > len(b) {
+		return nil, 0, ErrInvalidFormat
+	}
+	ifd := new(exifIFD)
+	var thumbOff, thumbLen int
+	for i := 0; i < count; i++ {
+		p := off + 2 + i*12
+		e := exifEntry{
+			tag:   order.Uint16(b[p:]),
+			typ:   order.Uint16(b[p+2:]),
+			count: order.Uint32(b[p+4:]),
+		}
+		if int(e.typ) >= len(exifTypeSize) || e.typ == 0 {
+			continue // unknown type
+		}
+		size := exifTypeSize[e.typ] * int(e.count)
+		vp := p + 8
+		if size > 4 {
+			vp = int(order.Uint32(b[p+8:]))
+		}
+		if size < 0 || vp+size > len(b) {
+			continue // broken entry
+		}
+		e.value = b[vp : vp+size]
+		if isSubIFDTag(e.tag) && size == 4 {
+			if depth >= exifMaxDepth {
+				continue
+			}
+			sub, _, err := ed.parseIFD(b, int(order.Uint32(e.value)), depth+1)
+			if err != nil {
+				continue
+			}
+			e.sub = sub
+		}
+		switch e.tag {
+		case exifTagThumbOffset:
+			thumbOff = int(order.Uint32(b[p+8:]))
+		case exifTagThumbLength:
+			thumbLen = int(order.Uint32(b[p+8:]))
+		}
+		ifd.entries = append(ifd.entries, e)
+	}
+	if thumbOff > 0 && thumbLen > 0 && thumbOff+thumbLen <= len(b) {
+		ifd.thumb = b[thumbOff : thumbOff+thumbLen]
+	}
+	next := int(order.Uint32(b[off+2+count*12:]))
+	return ifd, next, nil
+}
+
+// remove 删除 IFD 及子 IFD 中的指定标签
+func (ifd *exifIFD) remove(tags ...uint16) {
+	if ifd == nil {
+		return
+	}
+	entries := ifd.entries[:0]
+	for _, e := range ifd.entries {
+		if slices.Contains(tags, e.tag) {
+			continue
+		}
+		e.sub.remove(tags...)
+		entries = append(entries, e)
+	}
+	ifd.entries = entries
+}
+
+func (ed *exifData) scrub(s ExifScrub) {
+	for flag, tags := range scrubTags {
+		if s&flag != 0 {
+			ed.ifd0.remove(tags...)
+		}
+	}
+	if s&ScrubThumbnail != 0 {
+		ed.ifd1 = nil
+	}
+}
+
+// encode 重新排列 TIFF 结构, 值和子 IFD 都放在各自 IFD 之后
+func (ed *exifData) encode() []byte {
+	b := make([]byte, 8, 1024)
+	if ed.order == binary.LittleEndian {
+		copy(b, "II")
+	} else {
+		copy(b, "MM")
+	}
+	ed.order.PutUint16(b[2:], 42)
+	ed.order.PutUint32(b[4:], 8)
+	next := ed.writeIFD(&b, ed.ifd0)
+	if ed.ifd1 != nil {
+		b = align2(b)
+		ed.order.PutUint32(b[next:], uint32(len(b)))
+		ed.writeIFD(&b, ed.ifd1)
+	}
+	return b
+}
+
+// writeIFD 写入 IFD 并返回下一个 IFD 指针的位置
+func (ed *exifData) writeIFD(pb *[]byte, ifd *exifIFD) int {
+	order := ed.order
+	start := len(*pb)
+	n := len(ifd.entries)
+	*pb = append(*pb, make([]byte, 2+n*12+4)...)
+	order.PutUint16((*pb)[start:], uint16(n))
+	for i, e := range ifd.entries {
+		p := start + 2 + i*12
+		order.PutUint16((*pb)[p:], e.tag)
+		order.PutUint16((*pb)[p+2:], e.typ)
+		order.PutUint32((*pb)[p+4:], e.count)
+		switch {
+		case e.sub != nil:
+			*pb = align2(*pb)
+			off := len(*pb)
+			ed.writeIFD(pb, e.sub)
+			order.PutUint32((*pb)[p+8:], uint32(off))
+		case e.tag == exifTagThumbOffset && ifd.thumb != nil:
+			off := len(*pb)
+			*pb = append(*pb, ifd.thumb...)
+			order.PutUint32((*pb)[p+8:], uint32(off))
+		case len(e.value) <= 4:
+			copy((*pb)[p+8:p+12], e.value)
+		default:
+			// MakerNote 中的偏移是相对原位置的, 移动后部分厂商的数据可能无法解析
+			*pb = align2(*pb)
+			off := len(*pb)
+			*pb = append(*pb, e.value...)
+			order.PutUint32((*pb)[p+8:], uint32(off))
+		}
+	}
+	return start + 2 + n*12
+}
+
+func align2(b []byte) []byte {
+	if len(b)&1 == 1 {
+		return append(b, 0)
+	}
+	return b
+}
+
+// ScrubExif 移除 EXIF 中的隐私信息, 并重写 IFD 结构
+func ScrubExif(b []byte, s ExifScrub) ([]byte, error) {
+	if s == ScrubNone {
+		return b, nil
+	}
+	ed, err := parseExif(b)
+	if err != nil {
+		return nil, err
+	}
+	ed.scrub(s)
+	return ed.encode(), nil
+}
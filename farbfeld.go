@@ -0,0 +1,69 @@
+package image
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// farbfeld, 见 https://tools.suckless.org/farbfeld/
+// "farbfeld", 宽, 高, 每像素为大端 16 位的非预乘 RGBA
+
+const farbfeldHeaderSize = 16
+
+func farbfeldDecodeConfig(r io.Reader) (image.Config, error) {
+	var hdr [farbfeldHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return image.Config{}, err
+	}
+	if string(hdr[:8]) != "farbfeld" {
+		return image.Config{}, ErrInvalidFormat
+	}
+	w, h := binary.BigEndian.Uint32(hdr[8:]), binary.BigEndian.Uint32(hdr[12:])
+	if w == 0 || h == 0 || uint64(w)*uint64(h) > 1<<32 {
+		return image.Config{}, ErrInvalidFormat
+	}
+	return image.Config{ColorModel: color.NRGBA64Model, Width: int(w), Height: int(h)}, nil
+}
+
+func farbfeldDecode(r io.Reader) (image.Image, error) {
+	cfg, err := farbfeldDecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	// 像素与 NRGBA64 的内存布局相同; 按实际读到的数据分配, 头部声明的尺寸不可信
+	n := int64(cfg.Width) * int64(cfg.Height) * 8
+	pix, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(pix)) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &image.NRGBA64{Pix: pix, Stride: 8 * cfg.Width, Rect: image.Rect(0, 0, cfg.Width, cfg.Height)}, nil
+}
+
+func encodeFarbfeld(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	src, ok := m.(*image.NRGBA64)
+	if !ok {
+		src = image.NewNRGBA64(b)
+		draw.Draw(src, b, m, b.Min, draw.Src)
+	}
+	bw := bufio.NewWriter(w)
+	hdr := append([]byte("farbfeld"), 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(hdr[8:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(hdr[12:], uint32(b.Dy()))
+	_, _ = bw.Write(hdr)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		off := src.PixOffset(b.Min.X, y)
+		_, _ = bw.Write(src.Pix[off : off+8*b.Dx()])
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,382 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"sync"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/webp"
+)
+
+// Capability 格式的能力
+type Capability uint8
+
+// consts
+const (
+	CapDecode    Capability = 1 << iota // 可以解码, 由 Format.Decode 决定
+	CapEncode                           // 可以编码, 由 Format.Encode 决定
+	CapAlpha                            // 支持透明
+	CapAnimation                        // 支持动画
+	CapMetadata                         // 支持保留 EXIF/ICC/XMP
+)
+
+// Encoder 编码函数, 格式自己的选项从 opt 中取得, 见 EncoderOf
+type Encoder func(w io.Writer, m image.Image, opt *WriteOption) error
+
+// Format 一种图像格式
+type Format struct {
+	Name  string   // 格式名, 与 image.Decode 返回的相同, 如 "jpeg"
+	Exts  []string // 扩展名, 不含点, 第一个为默认
+	Mime  string   // MIME 类型
+	Magic string   // 文件头, ? 匹配任意字节, 与 image.RegisterFormat 相同
+
+	Decode       func(io.Reader) (image.Image, error)
+	DecodeConfig func(io.Reader) (image.Config, error)
+	Encode       Encoder
+
+	Caps Capability // CapDecode 及 CapEncode 以外的能力
+}
+
+// Has 是否具有全部的能力 c
+func (f *Format) Has(c Capability) bool {
+	caps := f.Caps &^ (CapDecode | CapEncode)
+	if f.Decode != nil {
+		caps |= CapDecode
+	}
+	if f.Encode != nil {
+		caps |= CapEncode
+	}
+	return caps&c == c
+}
+
+// Ext 默认的扩展名, 含点
+func (f *Format) Ext() string {
+	if len(f.Exts) == 0 {
+		return "." + f.Name
+	}
+	return "." + f.Exts[0]
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]*Format{}
+	formatExt = map[string]string{} // 扩展名到格式名
+)
+
+// RegisterFormat 注册或替换一种格式; 有 Decode 及 Magic 时同时注册到 image 包, 使 Open 可以识别
+func RegisterFormat(f Format) {
+	registerFormat(f)
+	if f.Decode != nil && f.DecodeConfig != nil && f.Magic != "" {
+		image.RegisterFormat(f.Name, f.Magic, f.Decode, f.DecodeConfig)
+	}
+}
+
+func registerFormat(f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if old, ok := formats[f.Name]; ok {
+		for _, ext := range old.Exts {
+			delete(formatExt, ext)
+		}
+	}
+	formats[f.Name] = &f
+	for _, ext := range f.Exts {
+		formatExt[ext] = f.Name
+	}
+}
+
+// LookupFormat 按格式名或扩展名查找格式
+func LookupFormat(name string) (Format, bool) {
+	if f := lookupFormat(name); f != nil {
+		return *f, true
+	}
+	return Format{}, false
+}
+
+func lookupFormat(name string) *Format {
+	if name != "" && name[0] == '.' {
+		name = name[1:]
+	}
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	if f, ok := formats[name]; ok {
+		return f
+	}
+	if n, ok := formatExt[name]; ok {
+		return formats[n]
+	}
+	return nil
+}
+
+// Formats 返回具有能力 c 的全部格式, 按名称排序; c 为 0 时返回全部
+func Formats(c Capability) []Format {
+	formatsMu.RLock()
+	out := make([]Format, 0, len(formats))
+	for _, f := range formats {
+		if f.Has(c) {
+			out = append(out, *f)
+		}
+	}
+	formatsMu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// CanDecode 当前构建能否解码该格式
+func CanDecode(name string) bool {
+	f := lookupFormat(name)
+	return f != nil && f.Has(CapDecode)
+}
+
+// CanEncode 当前构建能否编码该格式
+func CanEncode(name string) bool {
+	f := lookupFormat(name)
+	return f != nil && f.Has(CapEncode)
+}
+
+// outputFormat 未指定输出格式时使用原图的格式, 原格式不能编码时 (如 HEIC) 使用 JPEG
+func outputFormat(format string) string {
+	if CanEncode(format) {
+		return format
+	}
+	return FormatJPEG
+}
+
+// EncoderOf 把带类型选项的编码函数包装为 Encoder, 选项为 WriteOption.Options[name] 中的 *O,
+// 内置格式未设置时使用 WriteOption 中对应的字段, 如 JPEG; 都未设置时为 nil
+func EncoderOf[O any](name string, fn func(w io.Writer, m image.Image, quality uint8, o *O) error) Encoder {
+	return func(w io.Writer, m image.Image, opt *WriteOption) error {
+		o, err := optionOf[O](opt, name)
+		if err != nil {
+			return err
+		}
+		return fn(w, m, opt.Quality, o)
+	}
+}
+
+// optionOf 格式 name 的编码选项, 类型不是 *O 时返回 ErrInvalidOption
+func optionOf[O any](opt *WriteOption, name string) (*O, error) {
+	v, ok := opt.Options[name]
+	if !ok {
+		v = opt.builtinOption(name)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	o, ok := v.(*O)
+	if !ok {
+		return nil, ErrInvalidOption
+	}
+	return o, nil
+}
+
+// builtinOption 内置格式在 WriteOption 中的选项字段, 未设置时为 nil
+func (o *WriteOption) builtinOption(name string) any {
+	switch {
+	case name == FormatJPEG && o.JPEG != nil:
+		return o.JPEG
+	case name == FormatPNG && o.PNG != nil:
+		return o.PNG
+	case name == FormatGIF && o.GIF != nil:
+		return o.GIF
+	case name == FormatWEBP && o.WebP != nil:
+		return o.WebP
+	case name == FormatTIFF && o.TIFF != nil:
+		return o.TIFF
+	case name == FormatAVIF && o.AVIF != nil:
+		return o.AVIF
+	}
+	return nil
+}
+
+func init() {
+	registerFormat(Format{
+		Name: FormatJPEG, Exts: []string{"jpg", "jpeg", "jpe"}, Mime: "image/jpeg", Magic: "\xff\xd8",
+		Decode: jpeg.Decode, DecodeConfig: jpeg.DecodeConfig, Encode: EncoderOf(FormatJPEG, encodeJPEGWith),
+		Caps: CapMetadata,
+	})
+	registerFormat(Format{
+		Name: FormatPNG, Exts: []string{"png"}, Mime: "image/png", Magic: "\x89PNG\r\n\x1a\n",
+		Decode: png.Decode, DecodeConfig: png.DecodeConfig, Encode: EncoderOf(FormatPNG, encodePNGWith),
+		Caps: CapAlpha | CapMetadata,
+	})
+	registerFormat(Format{
+		Name: FormatGIF, Exts: []string{"gif"}, Mime: "image/gif", Magic: "GIF8?a",
+		Decode: gif.Decode, DecodeConfig: gif.DecodeConfig, Encode: EncoderOf(FormatGIF, encodeGIFWith),
+		Caps: CapAlpha | CapAnimation,
+	})
+	registerFormat(Format{
+		Name: FormatWEBP, Exts: []string{"webp"}, Mime: "image/webp", Magic: "RIFF????WEBPVP8",
+		Decode: webp.Decode, DecodeConfig: webp.DecodeConfig, Encode: EncoderOf(FormatWEBP, encodeWebPWith),
+		Caps: CapAlpha | CapAnimation | CapMetadata,
+	})
+	registerFormat(Format{
+		Name: FormatTIFF, Exts: []string{"tif", "tiff"}, Mime: "image/tiff", Magic: "MM\x00\x2a",
+		Decode: tiffDecode, DecodeConfig: tiffDecodeConfig, Encode: EncoderOf(FormatTIFF, encodeTIFFWith),
+		Caps: CapAlpha,
+	})
+	registerFormat(Format{
+		Name: FormatBMP, Exts: []string{"bmp"}, Mime: "image/bmp", Magic: "BM????\x00\x00\x00\x00",
+		Decode: bmp.Decode, DecodeConfig: bmp.DecodeConfig, Encode: encodeBMPWith,
+		Caps: CapAlpha,
+	})
+
+	// 以下为本包实现的编解码器, 需要注册到 image 包
+	RegisterFormat(Format{
+		Name: FormatQOI, Exts: []string{"qoi"}, Mime: "image/qoi", Magic: "qoif",
+		Decode: qoiDecode, DecodeConfig: qoiDecodeConfig,
+		Encode: func(w io.Writer, m image.Image, _ *WriteOption) error { return encodeQOI(w, m) },
+		Caps:   CapAlpha,
+	})
+	RegisterFormat(Format{
+		Name: FormatFarbfeld, Exts: []string{"ff"}, Mime: "image/x-farbfeld", Magic: "farbfeld",
+		Decode: farbfeldDecode, DecodeConfig: farbfeldDecodeConfig,
+		Encode: func(w io.Writer, m image.Image, _ *WriteOption) error { return encodeFarbfeld(w, m) },
+		Caps:   CapAlpha,
+	})
+	RegisterFormat(Format{
+		Name: FormatPBM, Exts: []string{"pbm"}, Mime: "image/x-portable-bitmap", Magic: "P4",
+		Decode: pnmDecode, DecodeConfig: pnmDecodeConfig,
+		Encode: func(w io.Writer, m image.Image, _ *WriteOption) error { return encodePBM(w, m) },
+	})
+	RegisterFormat(Format{
+		Name: FormatPGM, Exts: []string{"pgm"}, Mime: "image/x-portable-graymap", Magic: "P5",
+		Decode: pnmDecode, DecodeConfig: pnmDecodeConfig,
+		Encode: func(w io.Writer, m image.Image, _ *WriteOption) error { return encodePNM(w, m, FormatPGM) },
+	})
+	RegisterFormat(Format{
+		Name: FormatPPM, Exts: []string{"ppm", "pnm"}, Mime: "image/x-portable-pixmap", Magic: "P6",
+		Decode: pnmDecode, DecodeConfig: pnmDecodeConfig,
+		Encode: func(w io.Writer, m image.Image, _ *WriteOption) error { return encodePNM(w, m, FormatPPM) },
+	})
+	RegisterFormat(Format{
+		Name: FormatPAM, Exts: []string{"pam"}, Mime: "image/x-portable-arbitrarymap", Magic: "P7",
+		Decode: pnmDecode, DecodeConfig: pnmDecodeConfig,
+		Encode: func(w io.Writer, m image.Image, _ *WriteOption) error { return encodePNM(w, m, FormatPAM) },
+		Caps:   CapAlpha,
+	})
+	// 文本格式的 PNM
+	for name, magic := range map[string]string{FormatPBM: "P1", FormatPGM: "P2", FormatPPM: "P3"} {
+		image.RegisterFormat(name, magic, pnmDecode, pnmDecodeConfig)
+	}
+	// TGA 没有文件头标识, 见 tgaMagics
+	magics := tgaMagics()
+	RegisterFormat(Format{
+		Name: FormatTGA, Exts: []string{"tga", "tpic"}, Mime: "image/x-tga", Magic: magics[0],
+		Decode: tgaDecode, DecodeConfig: tgaDecodeConfig,
+		Encode: func(w io.Writer, m image.Image, _ *WriteOption) error { return encodeTGA(w, m) },
+		Caps:   CapAlpha,
+	})
+	for _, magic := range magics[1:] {
+		image.RegisterFormat(FormatTGA, magic, tgaDecode, tgaDecodeConfig)
+	}
+
+	// 没有 libavif 时仍可识别 AVIF 并读取属性, 解码返回 ErrNoCodec
+	avif := Format{
+		Name: FormatAVIF, Exts: []string{"avif"}, Mime: "image/avif", Magic: "????ftypavif",
+		DecodeConfig: avifDecodeConfig, Caps: CapAlpha,
+	}
+	if AVIFCodec {
+		avif.Decode, avif.Encode = avifDecode, EncoderOf(FormatAVIF, encodeAVIFWith)
+	}
+	registerFormat(avif)
+	for _, magic := range []string{"????ftypavif", "????ftypavis"} {
+		image.RegisterFormat(FormatAVIF, magic, avifDecode, avifDecodeConfig)
+	}
+
+	// HEIC 只能解码, 没有 libheif 时同 AVIF
+	heic := Format{
+		Name: FormatHEIC, Exts: []string{"heic", "heif", "hif"}, Mime: "image/heic", Magic: "????ftypheic",
+		DecodeConfig: heicDecodeConfig, Caps: CapAlpha,
+	}
+	if HEICCodec {
+		heic.Decode = heicDecode
+	}
+	registerFormat(heic)
+	for _, brand := range heicBrands {
+		image.RegisterFormat(FormatHEIC, "????ftyp"+brand, heicDecode, heicDecodeConfig)
+	}
+	// 通用的 brand 可能是 AVIF 或 HEIC, 按主图的编码分派
+	for _, brand := range []string{"mif1", "msf1"} {
+		image.RegisterFormat(formatMIF, "????ftyp"+brand, mifDecode, mifDecodeConfig)
+	}
+}
+
+// decodeConfig 与 image.DecodeConfig 相同, 通用 brand 的 HEIF 返回实际的格式;
+// TIFF 先检查 IFD 偏移, 越界的偏移会使 tiff.DecodeConfig 按偏移分配缓冲
+func decodeConfig(r io.Reader) (image.Config, string, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(4); isTIFF(magic) {
+		cfg, err := tiffDecodeConfig(br)
+		return cfg, FormatTIFF, err
+	}
+	var head bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(br, &head))
+	if err == nil && format == formatMIF {
+		format = mifFormat(head.Bytes())
+	}
+	return cfg, format, err
+}
+
+func encodeJPEGWith(w io.Writer, m image.Image, quality uint8, o *JPEGOption) error {
+	qlt := int(quality)
+	if qlt == 0 {
+		qlt = MinJPEGQuality
+	}
+	if o != nil {
+		return encodeJPEG(w, m, qlt, o)
+	}
+	return jpeg.Encode(w, m, &jpeg.Options{Quality: qlt})
+}
+
+func encodePNGWith(w io.Writer, m image.Image, _ uint8, o *PNGOption) error {
+	if o != nil {
+		return encodePNG(w, m, o)
+	}
+	return png.Encode(w, m)
+}
+
+func encodeGIFWith(w io.Writer, m image.Image, _ uint8, o *GIFOption) error {
+	if o != nil {
+		return gif.Encode(w, o.quantize(m), nil)
+	}
+	return gif.Encode(w, m, &gif.Options{
+		NumColors: 256,
+		Quantizer: nil,
+		Drawer:    nil,
+	})
+}
+
+func encodeTIFFWith(w io.Writer, m image.Image, _ uint8, o *TIFFOption) error {
+	if o == nil {
+		o = new(TIFFOption)
+	}
+	return encodeTIFF(w, m, o)
+}
+
+func encodeBMPWith(w io.Writer, m image.Image, opt *WriteOption) error {
+	return bmp.Encode(w, m)
+}
+
+func encodeWebPWith(w io.Writer, m image.Image, quality uint8, o *WebPOption) error {
+	qlt := int(quality)
+	if qlt == 0 {
+		qlt = MinWebpQuality
+	}
+	return webpEncode(w, m, float32(qlt), o)
+}
+
+// webpQuality WebP 的质量, 0 为 MinWebpQuality
+func (o *WriteOption) webpQuality() int {
+	if o.Quality == 0 {
+		return MinWebpQuality
+	}
+	return int(o.Quality)
+}
@@ -0,0 +1,161 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// toy 测试用的灰度格式: "TOY1", 宽, 高, 像素
+type toyOption struct {
+	Invert bool
+}
+
+func toyEncode(w io.Writer, m image.Image, quality uint8, o *toyOption) error {
+	b := m.Bounds()
+	if b.Dx() > 255 || b.Dy() > 255 {
+		return ErrImageTooLarge
+	}
+	out := []byte{'T', 'O', 'Y', '1', uint8(b.Dx()), uint8(b.Dy())}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			v := color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y
+			if o != nil && o.Invert {
+				v = 255 - v
+			}
+			out = append(out, v)
+		}
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+func toyDecodeConfig(r io.Reader) (image.Config, error) {
+	var hdr [6]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.GrayModel, Width: int(hdr[4]), Height: int(hdr[5])}, nil
+}
+
+func toyDecode(r io.Reader) (image.Image, error) {
+	cfg, err := toyDecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	m := image.NewGray(image.Rect(0, 0, cfg.Width, cfg.Height))
+	if _, err = io.ReadFull(r, m.Pix); err != nil {
+		return nil, errors.Join(ErrInvalidFormat, err)
+	}
+	return m, nil
+}
+
+func TestRegisterFormat(t *testing.T) {
+	f, ok := LookupFormat(".jpg")
+	assert.True(t, ok)
+	assert.Equal(t, FormatJPEG, f.Name)
+	assert.Equal(t, ".jpg", Format2Ext(FormatJPEG))
+	assert.Equal(t, FormatJPEG, PatchFormat("jpe"))
+	assert.True(t, CanDecode("webp"))
+	assert.True(t, CanEncode("webp"))
+	assert.False(t, CanEncode("toy"))
+	var names []string
+	for _, f := range Formats(CapAnimation | CapEncode) {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{FormatGIF, FormatWEBP}, names)
+
+	RegisterFormat(Format{
+		Name: "toy", Exts: []string{"toy", "ty"}, Mime: "image/x-toy", Magic: "TOY1",
+		Decode: toyDecode, DecodeConfig: toyDecodeConfig, Encode: EncoderOf("toy", toyEncode),
+	})
+	assert.True(t, CanEncode(".ty"))
+	assert.Equal(t, "toy", PatchFormat("ty"))
+
+	src := gradient(20, 10)
+	var buf bytes.Buffer
+	_, err := SaveTo(&buf, src, &WriteOption{Format: "ty"})
+	assert.NoError(t, err)
+	assert.Equal(t, 6+200, buf.Len())
+
+	im, err := Open(bytes.NewReader(buf.Bytes()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "toy", im.Format)
+		assert.Equal(t, ".toy", im.Ext)
+		assert.Equal(t, "image/x-toy", im.Mime)
+		assert.Equal(t, 20, int(im.Width))
+	}
+
+	var inv bytes.Buffer
+	_, err = SaveTo(&inv, src, &WriteOption{Format: "toy", Options: map[string]any{"toy": &toyOption{Invert: true}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 255-buf.Bytes()[6], inv.Bytes()[6])
+	_, err = SaveTo(&inv, src, &WriteOption{Format: "toy", Options: map[string]any{"toy": toyOption{}}})
+	assert.Equal(t, ErrInvalidOption, err)
+	_, err = SaveTo(&inv, src, &WriteOption{Format: "bmp8"})
+	assert.Equal(t, ErrUnsupportFormat, err)
+
+	// 重新注册时替换原有的扩展名
+	RegisterFormat(Format{Name: "toy", Exts: []string{"toy"}, Mime: "image/x-toy"})
+	assert.False(t, CanEncode("toy"))
+	_, ok = LookupFormat("ty")
+	assert.False(t, ok)
+}
+
+func TestPureGoCodecs(t *testing.T) {
+	cases := []struct {
+		ext, format, mime string
+	}{
+		{".qoi", FormatQOI, "image/qoi"},
+		{".ff", FormatFarbfeld, "image/x-farbfeld"},
+		{".pbm", FormatPBM, "image/x-portable-bitmap"},
+		{".pgm", FormatPGM, "image/x-portable-graymap"},
+		{".pnm", FormatPPM, "image/x-portable-pixmap"},
+		{".pam", FormatPAM, "image/x-portable-arbitrarymap"},
+		{".tga", FormatTGA, "image/x-tga"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		_, err := SaveTo(&buf, photo(60, 40), &WriteOption{Format: c.ext})
+		assert.NoError(t, err, c.ext)
+
+		im, err := Open(bytes.NewReader(buf.Bytes()))
+		if !assert.NoError(t, err, c.ext) {
+			continue
+		}
+		assert.Equal(t, c.format, im.Format)
+		assert.Equal(t, "."+lookupFormat(c.format).Exts[0], im.Ext)
+		assert.Equal(t, c.mime, im.Mime)
+		assert.Equal(t, 60, int(im.Width))
+
+		var out bytes.Buffer
+		_, err = Thumbnail(bytes.NewReader(buf.Bytes()), &out, &ThumbOption{Width: 30, Height: 20, IsFit: true})
+		if assert.NoError(t, err, c.ext) {
+			cfg, name, err := image.DecodeConfig(&out)
+			assert.NoError(t, err)
+			assert.Equal(t, c.format, name)
+			assert.Equal(t, 30, cfg.Width)
+		}
+	}
+}
+
+func TestBuiltinOptions(t *testing.T) {
+	src := photo(40, 30)
+	// 内置格式也可以通过 Options 设置, 优先于 WriteOption 中的字段
+	var buf bytes.Buffer
+	_, err := SaveTo(&buf, src, &WriteOption{Format: FormatJPEG, Options: map[string]any{FormatJPEG: &JPEGOption{Progressive: true}}})
+	assert.NoError(t, err)
+	assert.True(t, hasMarker(buf.Bytes(), markerSOF2))
+	buf.Reset()
+	_, err = SaveTo(&buf, src, &WriteOption{Format: FormatJPEG, JPEG: &JPEGOption{Progressive: true},
+		Options: map[string]any{FormatJPEG: &JPEGOption{}}})
+	assert.NoError(t, err)
+	assert.False(t, hasMarker(buf.Bytes(), markerSOF2))
+	_, err = SaveTo(&buf, src, &WriteOption{Format: FormatPNG, Options: map[string]any{FormatPNG: &JPEGOption{}}})
+	assert.Equal(t, ErrInvalidOption, err)
+}
@@ -5,7 +5,6 @@ go 1.23.0
 toolchain go1.24.1
 
 require (
-	github.com/chai2010/webp v1.4.0
 	github.com/liut/jpegquality v0.0.0-20240710065817-3f50304d6fdd
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/stretchr/testify v1.10.0
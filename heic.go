@@ -0,0 +1,32 @@
+package image
+
+import (
+	"image"
+	"io"
+)
+
+// HEIC 的解码使用 libheif, 需要 cgo 及 libheif 标签 (go build -tags libheif);
+// 否则只能读取属性及元数据, 解码返回 ErrNoCodec
+
+// heicBrands HEVC 编码的 HEIF 的 brand, 通用的 mif1, msf1 见 heifKind
+var heicBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx"}
+
+// readHEIC 读取 HEIC 的属性, 主图须为 hvc1 或 grid
+func readHEIC(r io.Reader) (*heifInfo, error) {
+	h, err := readHEIF(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.kind() != FormatHEIC || (h.codec != "hvc1" && h.codec != "grid") {
+		return nil, ErrInvalidFormat
+	}
+	return h, nil
+}
+
+func heicDecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHEIC(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return h.config(), nil
+}
@@ -0,0 +1,81 @@
+package image
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// heicFile 构造只有容器的 HEIC: 缩略图 1 (8x6), 主图 2 (64x48, 顺时针旋转 90°),
+// Exif 3 在 mdat 中, XMP 4 在 idat 中
+func heicFile() []byte {
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`)
+	meta := func(exifOffset uint32) []byte {
+		return fullBox("meta", 0, 0,
+			fullBox("hdlr", 0, 0, u32(0), []byte("pict"), u32(0, 0, 0), []byte{0}),
+			fullBox("pitm", 0, 0, u16(2)),
+			fullBox("iloc", 1, 0, u16(0x4400, 2),
+				u16(3, 0, 0, 1), u32(exifOffset, uint32(len(exif)+4)),
+				u16(4, 1, 0, 1), u32(0, uint32(len(xmp)))),
+			fullBox("iinf", 0, 0, u16(4),
+				fullBox("infe", 2, 0, u16(1, 0), []byte("hvc1\x00")),
+				fullBox("infe", 2, 0, u16(2, 0), []byte("grid\x00")),
+				fullBox("infe", 2, 0, u16(3, 0), []byte("Exif\x00")),
+				fullBox("infe", 2, 0, u16(4, 0), []byte("mime\x00application/rdf+xml\x00")),
+			),
+			fullBox("iref", 0, 0, box("thmb", u16(1, 1, 2)), box("cdsc", u16(3, 1, 2))),
+			box("idat", xmp),
+			box("iprp",
+				box("ipco",
+					fullBox("ispe", 0, 0, u32(8, 6)),
+					fullBox("ispe", 0, 0, u32(64, 48)),
+					box("irot", []byte{3}),
+					box("colr", []byte("prof"), []byte("icc-profile")),
+				),
+				fullBox("ipma", 0, 0, u32(2), u16(1), []byte{1, 0x81}, u16(2), []byte{3, 2, 0x83, 4}),
+			),
+		)
+	}
+	ftyp := box("ftyp", []byte("heic"), u32(0), []byte("mif1heic"))
+	off := uint32(len(ftyp) + len(meta(0)) + 8)
+	return bytes.Join([][]byte{ftyp, meta(off), box("mdat", u32(6), exif)}, nil)
+}
+
+func TestHEIC(t *testing.T) {
+	data := heicFile()
+	h, err := readHEIC(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "grid", h.codec)
+		assert.Equal(t, 64, h.width)
+		assert.Equal(t, []Orientation{OrientRotate90}, h.transforms)
+	}
+	_, err = readHEIC(bytes.NewReader(heifFile("avif", "av01", "", false)))
+	assert.Equal(t, ErrInvalidFormat, err)
+
+	im, err := OpenWith(bytes.NewReader(data), &ReadOption{Lazy: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatHEIC, im.Format)
+		assert.Equal(t, ".heic", im.Ext)
+		assert.Equal(t, "image/heic", im.Mime)
+		assert.Equal(t, 48, int(im.Width))
+		assert.Equal(t, 64, int(im.Height))
+	}
+
+	// 方向以 irot 为准, EXIF 中的 Orientation 置为 1
+	md, err := ReadMetadata(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, OrientNormal, exifOrientation(md.Exif))
+		assert.Equal(t, `<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`, string(md.XMP))
+		assert.Equal(t, "icc-profile", string(md.ICC))
+	}
+
+	assert.Equal(t, HEICCodec, CanDecode(FormatHEIC))
+	assert.False(t, CanEncode(FormatHEIC))
+	assert.Equal(t, FormatJPEG, outputFormat(FormatHEIC))
+	if !HEICCodec {
+		_, err = Open(bytes.NewReader(data))
+		assert.Equal(t, ErrNoCodec, err)
+	}
+}
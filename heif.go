@@ -0,0 +1,570 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+)
+
+// HEIF (ISO/IEC 23008-12) 容器, AVIF 及 HEIC 共用; 只读取主图的属性, 不解码像素
+
+const heifMaxMeta = 16 << 20 // meta box 的最大长度
+
+// heifInfo 从容器中读取的主图属性
+type heifInfo struct {
+	brand  string   // major brand
+	brands []string // compatible brands
+	codec  string   // 主图的类型, 如 av01, hvc1, grid
+
+	width, height int           // ispe, 未旋转的尺寸
+	depth         int           // 每通道的位数, 来自 pixi, 默认 8
+	alpha         bool          // 有 alpha 辅助图
+	transforms    []Orientation // irot 及 imir, 按关联的顺序
+
+	icc  []byte // colr 中的 ICC profile
+	exif uint32 // 描述主图的 Exif item, 0 为没有
+	xmp  uint32 // 描述主图的 XMP item, 0 为没有
+
+	locs map[uint32]heifLocation // iloc
+	idat []byte
+}
+
+// heifLocation item 数据的位置
+type heifLocation struct {
+	method  uint32 // 0 为文件中的偏移, 1 为 idat 中的偏移
+	extents [][2]uint64
+}
+
+// hasBrand major 或 compatible brands 中是否有 b
+func (h *heifInfo) hasBrand(b ...string) bool {
+	for _, s := range b {
+		if h.brand == s {
+			return true
+		}
+		for _, c := range h.brands {
+			if c == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// kind 按主图的编码区分 AVIF 及 HEIC, grid 按 brand 区分; 都不是时为空
+func (h *heifInfo) kind() string {
+	switch {
+	case h.codec == "av01":
+		return FormatAVIF
+	case h.codec == "hvc1":
+		return FormatHEIC
+	case h.hasBrand("avif", "avis"):
+		return FormatAVIF
+	case h.hasBrand(heicBrands...):
+		return FormatHEIC
+	}
+	return ""
+}
+
+// config 解码后的像素格式及显示的尺寸
+func (h *heifInfo) config() image.Config {
+	cfg := image.Config{ColorModel: color.NRGBAModel}
+	if h.depth > 8 {
+		cfg.ColorModel = color.NRGBA64Model
+	}
+	cfg.Width, cfg.Height = h.size()
+	return cfg
+}
+
+// size 显示的尺寸, 旋转 90° 时交换宽高
+func (h *heifInfo) size() (int, int) {
+	swapped := false
+	for _, o := range h.transforms {
+		swapped = swapped != o.Swapped()
+	}
+	if swapped {
+		return h.height, h.width
+	}
+	return h.width, h.height
+}
+
+// orient 按顺序应用 irot 及 imir
+func (h *heifInfo) orient(m image.Image) image.Image {
+	for _, o := range h.transforms {
+		m = Orient(m, o)
+	}
+	return m
+}
+
+type heifBox struct {
+	typ  string
+	data []byte
+}
+
+// readHEIFBox 读取一个 box, 类型不是 want 时跳过内容; 长度超过 max 时返回 ErrImageTooLarge
+func readHEIFBox(br *bufio.Reader, max int64, want string) (*heifBox, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(hdr[:]))
+	typ := string(hdr[4:])
+	skip := typ != want
+	hl := int64(8)
+	switch size {
+	case 0: // 到文件结尾
+		if skip {
+			return nil, io.EOF
+		}
+		size = max + hl + 1
+	case 1:
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			return nil, err
+		}
+		size, hl = int64(binary.BigEndian.Uint64(hdr[:])), 16
+	}
+	if size < hl {
+		return nil, ErrInvalidFormat
+	}
+	n := size - hl
+	if skip {
+		_, err := io.CopyN(io.Discard, br, n)
+		return &heifBox{typ: typ}, err
+	}
+	if n > max {
+		return nil, ErrImageTooLarge
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, err
+	}
+	return &heifBox{typ: typ, data: data}, nil
+}
+
+// heifChildren 解析 data 中连续的子 box
+func heifChildren(data []byte) ([]heifBox, error) {
+	var out []heifBox
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, ErrInvalidFormat
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		hl := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, ErrInvalidFormat
+			}
+			size, hl = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < hl || size > uint64(len(data)) {
+			return nil, ErrInvalidFormat
+		}
+		out = append(out, heifBox{typ: typ, data: data[hl:size]})
+		data = data[size:]
+	}
+	return out, nil
+}
+
+// heifReader 读取 box 内容中的整数, 越界时记录错误并返回 0
+type heifReader struct {
+	data []byte
+	err  error
+}
+
+func (r *heifReader) next(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = ErrInvalidFormat
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *heifReader) u8() uint32  { return uint32(r.next(1)[0]) }
+func (r *heifReader) u16() uint32 { return uint32(binary.BigEndian.Uint16(r.next(2))) }
+func (r *heifReader) u32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+
+// id 版本 0 时为 16 位, 否则为 32 位
+func (r *heifReader) id(version uint32) uint32 {
+	if version == 0 {
+		return r.u16()
+	}
+	return r.u32()
+}
+
+// full 读取 FullBox 的版本及标志
+func (r *heifReader) full() (version, flags uint32) {
+	v := r.u32()
+	return v >> 24, v & 0xffffff
+}
+
+// readHEIF 读取 ftyp 及 meta, 返回主图的属性
+func readHEIF(r io.Reader) (*heifInfo, error) {
+	br := bufio.NewReader(r)
+	ftyp, err := readHEIFBox(br, 4096, "ftyp")
+	if err != nil {
+		return nil, err
+	}
+	if ftyp.typ != "ftyp" || len(ftyp.data) < 8 {
+		return nil, ErrInvalidFormat
+	}
+	h := &heifInfo{brand: string(ftyp.data[:4]), depth: 8}
+	for b := ftyp.data[8:]; len(b) >= 4; b = b[4:] {
+		h.brands = append(h.brands, string(b[:4]))
+	}
+	for {
+		box, err := readHEIFBox(br, heifMaxMeta, "meta")
+		if err == io.EOF {
+			return nil, ErrInvalidFormat
+		}
+		if err != nil {
+			return nil, err
+		}
+		if box.typ == "meta" {
+			return h, h.readMeta(box.data)
+		}
+	}
+}
+
+// readMeta 解析 meta box 中的 pitm, iinf, iref, iloc, idat 及 iprp
+func (h *heifInfo) readMeta(data []byte) error {
+	if len(data) < 4 {
+		return ErrInvalidFormat
+	}
+	boxes, err := heifChildren(data[4:])
+	if err != nil {
+		return err
+	}
+	var primary uint32
+	types := map[uint32]string{}
+	mimes := map[uint32]string{}
+	auxl := map[uint32][]uint32{} // 辅助图 -> 主图
+	cdsc := map[uint32][]uint32{} // 元数据 -> 所描述的图
+	var ipco []heifBox
+	props := map[uint32][]int{} // item -> ipco 中的序号, 从 0 开始
+	for _, b := range boxes {
+		r := &heifReader{data: b.data}
+		switch b.typ {
+		case "pitm":
+			v, _ := r.full()
+			primary = r.id(v)
+		case "iinf":
+			v, _ := r.full()
+			r.id(v)
+			if r.err != nil {
+				return r.err
+			}
+			entries, err := heifChildren(r.data)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if e.typ != "infe" {
+					continue
+				}
+				er := &heifReader{data: e.data}
+				ev, _ := er.full()
+				if ev < 2 {
+					continue
+				}
+				id := er.id(ev - 2)
+				er.u16() // item_protection_index
+				typ := string(er.next(4))
+				if er.err == nil {
+					types[id] = typ
+				}
+				if typ == "mime" {
+					// item_name 之后为 content_type
+					if _, rest, ok := bytes.Cut(er.data, []byte{0}); ok {
+						ct, _, _ := bytes.Cut(rest, []byte{0})
+						mimes[id] = string(ct)
+					}
+				}
+			}
+		case "iref":
+			v, _ := r.full()
+			if r.err != nil {
+				return r.err
+			}
+			refs, err := heifChildren(r.data)
+			if err != nil {
+				return err
+			}
+			for _, ref := range refs {
+				rr := &heifReader{data: ref.data}
+				from := rr.id(v)
+				n := rr.u16()
+				for i := uint32(0); i < n && rr.err == nil; i++ {
+					to := rr.id(v)
+					switch ref.typ {
+					case "auxl":
+						auxl[from] = append(auxl[from], to)
+					case "cdsc":
+						cdsc[from] = append(cdsc[from], to)
+					}
+				}
+			}
+		case "iloc":
+			if h.locs, err = readILOC(b.data); err != nil {
+				return err
+			}
+		case "idat":
+			h.idat = b.data
+		case "iprp":
+			children, err := heifChildren(b.data)
+			if err != nil {
+				return err
+			}
+			for _, c := range children {
+				switch c.typ {
+				case "ipco":
+					if ipco, err = heifChildren(c.data); err != nil {
+						return err
+					}
+				case "ipma":
+					if err = readIPMA(c.data, props); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+
+	h.codec = types[primary]
+	if h.codec == "" {
+		return ErrInvalidFormat
+	}
+	for _, i := range props[primary] {
+		if i >= len(ipco) {
+			continue
+		}
+		p := ipco[i]
+		r := &heifReader{data: p.data}
+		switch p.typ {
+		case "ispe":
+			r.full()
+			h.width, h.height = int(r.u32()), int(r.u32())
+		case "pixi":
+			r.full()
+			if n := r.u8(); n > 0 {
+				h.depth = int(r.u8())
+			}
+		case "irot":
+			// 逆时针旋转 90° 的次数
+			switch r.u8() & 3 {
+			case 1:
+				h.transforms = append(h.transforms, OrientRotate270)
+			case 2:
+				h.transforms = append(h.transforms, OrientRotate180)
+			case 3:
+				h.transforms = append(h.transforms, OrientRotate90)
+			}
+		case "imir":
+			// 0 为沿垂直轴镜像 (左右翻转), 1 为沿水平轴镜像
+			if r.u8()&1 == 0 {
+				h.transforms = append(h.transforms, OrientFlipH)
+			} else {
+				h.transforms = append(h.transforms, OrientFlipV)
+			}
+		case "colr":
+			if typ := string(r.next(4)); typ == "prof" || typ == "rICC" {
+				h.icc = r.data
+			}
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	if h.width <= 0 || h.height <= 0 {
+		return ErrInvalidFormat
+	}
+
+	// 没有 cdsc 引用的元数据视为描述整个文件
+	for id, typ := range types {
+		if refs, ok := cdsc[id]; ok && !containsID(refs, primary) {
+			continue
+		}
+		switch {
+		case typ == "Exif" && (h.exif == 0 || id < h.exif):
+			h.exif = id
+		case typ == "mime" && mimes[id] == "application/rdf+xml" && (h.xmp == 0 || id < h.xmp):
+			h.xmp = id
+		}
+	}
+
+	for aux, to := range auxl {
+		if !containsID(to, primary) {
+			continue
+		}
+		for _, i := range props[aux] {
+			if i < len(ipco) && ipco[i].typ == "auxC" && len(ipco[i].data) > 4 {
+				urn, _, _ := bytes.Cut(ipco[i].data[4:], []byte{0})
+				switch string(urn) {
+				case "urn:mpeg:mpegB:cicp:systems:auxiliary:alpha", "urn:mpeg:hevc:2015:auxid:1":
+					h.alpha = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readIPMA 读取 item 与属性的关联
+func readIPMA(data []byte, props map[uint32][]int) error {
+	r := &heifReader{data: data}
+	v, flags := r.full()
+	n := r.u32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		id := r.id(v)
+		count := r.u8()
+		for j := uint32(0); j < count && r.err == nil; j++ {
+			var idx uint32
+			if flags&1 != 0 {
+				idx = r.u16() & 0x7fff
+			} else {
+				idx = r.u8() & 0x7f
+			}
+			if idx > 0 { // 0 表示没有属性
+				props[id] = append(props[id], int(idx-1))
+			}
+		}
+	}
+	return r.err
+}
+
+func containsID(ids []uint32, id uint32) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// readILOC 读取 item 的位置
+func readILOC(data []byte) (map[uint32]heifLocation, error) {
+	r := &heifReader{data: data}
+	v, _ := r.full()
+	sizes := r.u16()
+	offSize, lenSize, baseSize := int(sizes>>12), int(sizes>>8&15), int(sizes>>4&15)
+	idxSize := 0
+	if v == 1 || v == 2 {
+		idxSize = int(sizes & 15)
+	}
+	readN := func(n int) uint64 {
+		var x uint64
+		for _, c := range r.next(n) {
+			x = x<<8 | uint64(c)
+		}
+		return x
+	}
+	var n uint32
+	if v < 2 {
+		n = r.u16()
+	} else {
+		n = r.u32()
+	}
+	locs := make(map[uint32]heifLocation, n)
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		var id uint32
+		if v < 2 {
+			id = r.u16()
+		} else {
+			id = r.u32()
+		}
+		var loc heifLocation
+		if v == 1 || v == 2 {
+			loc.method = r.u16() & 15
+		}
+		r.u16() // data_reference_index
+		base := readN(baseSize)
+		count := r.u16()
+		for j := uint32(0); j < count && r.err == nil; j++ {
+			readN(idxSize)
+			off := readN(offSize)
+			loc.extents = append(loc.extents, [2]uint64{base + off, readN(lenSize)})
+		}
+		locs[id] = loc
+	}
+	return locs, r.err
+}
+
+// itemData 读取 item 的数据, file 为整个文件
+func (h *heifInfo) itemData(file []byte, id uint32) ([]byte, error) {
+	loc, ok := h.locs[id]
+	if !ok {
+		return nil, ErrInvalidFormat
+	}
+	src := file
+	switch loc.method {
+	case 0:
+	case 1:
+		src = h.idat
+	default:
+		return nil, ErrUnsupportFormat
+	}
+	var out []byte
+	for _, e := range loc.extents {
+		off, n := e[0], e[1]
+		if n == 0 { // 到结尾
+			n = uint64(len(src)) - min(off, uint64(len(src)))
+		}
+		if off > uint64(len(src)) || n > uint64(len(src))-off {
+			return nil, ErrInvalidFormat
+		}
+		out = append(out, src[off:off+n]...)
+	}
+	return out, nil
+}
+
+// formatMIF 通用 brand (mif1, msf1) 的 HEIF 在 image.RegisterFormat 中的名称,
+// 由 decodeConfig 按主图的编码换为 FormatAVIF 或 FormatHEIC
+const formatMIF = "mif1"
+
+func mifDecode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := readHEIF(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	switch h.kind() {
+	case FormatAVIF:
+		return avifDecode(bytes.NewReader(data))
+	case FormatHEIC:
+		return heicDecode(bytes.NewReader(data))
+	}
+	return nil, ErrInvalidFormat
+}
+
+func mifDecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHEIF(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if h.kind() == "" {
+		return image.Config{}, ErrInvalidFormat
+	}
+	return h.config(), nil
+}
+
+// mifFormat 通用 brand 的 HEIF 的实际格式, head 须含 meta box
+func mifFormat(head []byte) string {
+	h, err := readHEIF(bytes.NewReader(head))
+	if err != nil || h.kind() == "" {
+		return formatMIF
+	}
+	return h.kind()
+}
@@ -0,0 +1,144 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// box 按 ISOBMFF 拼接一个 box
+func box(typ string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// fullBox 带版本及标志的 box
+func fullBox(typ string, version uint8, flags uint32, data ...[]byte) []byte {
+	vf := binary.BigEndian.AppendUint32(nil, uint32(version)<<24|flags)
+	return box(typ, append([][]byte{vf}, data...)...)
+}
+
+func u16(v ...uint16) []byte {
+	var out []byte
+	for _, x := range v {
+		out = binary.BigEndian.AppendUint16(out, x)
+	}
+	return out
+}
+
+func u32(v ...uint32) []byte {
+	var out []byte
+	for _, x := range v {
+		out = binary.BigEndian.AppendUint32(out, x)
+	}
+	return out
+}
+
+// heifFile 构造只有容器的 HEIF 文件, 主图为 1, 尺寸 40x30, 10 位, 逆时针旋转 90°,
+// 图 2 为其 alpha 辅助图
+func heifFile(brand, codec, alphaURN string, mdatFirst bool) []byte {
+	infe := func(id uint16) []byte { return fullBox("infe", 2, 0, u16(id, 0), []byte(codec)) }
+	meta := fullBox("meta", 0, 0,
+		fullBox("hdlr", 0, 0, u32(0), []byte("pict"), u32(0, 0, 0), []byte{0}),
+		fullBox("pitm", 0, 0, u16(1)),
+		fullBox("iinf", 0, 0, u16(2), infe(1), infe(2)),
+		fullBox("iref", 0, 0, box("auxl", u16(2, 1, 1))),
+		box("iprp",
+			box("ipco",
+				fullBox("ispe", 0, 0, u32(40, 30)),
+				fullBox("pixi", 0, 0, []byte{3, 10, 10, 10}),
+				box("irot", []byte{1}),
+				fullBox("auxC", 0, 0, []byte(alphaURN), []byte{0}),
+			),
+			fullBox("ipma", 0, 0, u32(2), u16(1), []byte{3, 1, 0x82, 0x83}, u16(2), []byte{2, 1, 0x84}),
+		),
+	)
+	ftyp := box("ftyp", []byte(brand), u32(0), []byte("mif1miaf"+brand))
+	mdat := box("mdat", make([]byte, 100))
+	if mdatFirst {
+		return bytes.Join([][]byte{ftyp, mdat, meta}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, meta, mdat}, nil)
+}
+
+func TestReadHEIF(t *testing.T) {
+	for _, mdatFirst := range []bool{false, true} {
+		h, err := readHEIF(bytes.NewReader(heifFile("avif", "av01", "urn:mpeg:mpegB:cicp:systems:auxiliary:alpha", mdatFirst)))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "avif", h.brand)
+			assert.True(t, h.hasBrand("miaf"))
+			assert.Equal(t, "av01", h.codec)
+			assert.Equal(t, 40, h.width)
+			assert.Equal(t, 10, h.depth)
+			assert.True(t, h.alpha)
+			assert.Equal(t, []Orientation{OrientRotate270}, h.transforms)
+			w, hh := h.size()
+			assert.Equal(t, [2]int{30, 40}, [2]int{w, hh})
+		}
+	}
+
+	h, err := readHEIF(bytes.NewReader(heifFile("heic", "hvc1", "other", false)))
+	if assert.NoError(t, err) {
+		assert.False(t, h.alpha)
+	}
+
+	data := heifFile("avif", "av01", "", false)
+	_, err = readHEIF(bytes.NewReader(data[:len(data)-120]))
+	assert.Error(t, err)
+	_, err = readHEIF(bytes.NewReader(data[:40]))
+	assert.Error(t, err)
+}
+
+func TestAVIF(t *testing.T) {
+	data := heifFile("avif", "av01", "urn:mpeg:mpegB:cicp:systems:auxiliary:alpha", false)
+	cfg, err := avifDecodeConfig(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 30, cfg.Width)
+		assert.Equal(t, 40, cfg.Height)
+		assert.Equal(t, color.NRGBA64Model, cfg.ColorModel)
+	}
+	_, err = avifDecodeConfig(bytes.NewReader(heifFile("heic", "hvc1", "", false)))
+	assert.Equal(t, ErrInvalidFormat, err)
+
+	im, err := OpenWith(bytes.NewReader(data), &ReadOption{Lazy: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatAVIF, im.Format)
+		assert.Equal(t, ".avif", im.Ext)
+		assert.Equal(t, "image/avif", im.Mime)
+		assert.Equal(t, 30, int(im.Width))
+		assert.Equal(t, 16, int(im.BitDepth))
+	}
+
+	assert.Equal(t, AVIFCodec, CanDecode(FormatAVIF))
+	assert.Equal(t, AVIFCodec, CanEncode(FormatAVIF))
+	if !AVIFCodec {
+		_, err = Open(bytes.NewReader(data))
+		assert.Equal(t, ErrNoCodec, err)
+		_, err := SaveTo(new(bytes.Buffer), gradient(8, 8), &WriteOption{Format: FormatAVIF})
+		assert.Equal(t, ErrUnsupportFormat, err)
+	}
+}
+
+func TestGenericHEIFBrand(t *testing.T) {
+	for codec, format := range map[string]string{"av01": FormatAVIF, "hvc1": FormatHEIC} {
+		for _, brand := range []string{"mif1", "msf1"} {
+			data := heifFile(brand, codec, "", false)
+			im, err := OpenWith(bytes.NewReader(data), &ReadOption{Lazy: true})
+			if assert.NoError(t, err, brand+"/"+codec) {
+				assert.Equal(t, format, im.Format)
+				assert.Equal(t, lookupFormat(format).Ext(), im.Ext)
+				assert.Equal(t, 30, int(im.Width))
+			}
+			attr, err := Probe(bytes.NewReader(data))
+			if assert.NoError(t, err) {
+				assert.Equal(t, lookupFormat(format).Mime, attr.Mime)
+			}
+		}
+	}
+	_, err := mifDecodeConfig(bytes.NewReader(heifFile("mif1", "jpeg", "", false)))
+	assert.Equal(t, ErrInvalidFormat, err)
+}
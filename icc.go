@@ -0,0 +1,510 @@
+package image
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"math"
+	"sync"
+)
+
+// ICC profile 中用到的签名
+const (
+	iccHeaderSize = 128
+	iccMagic      = "acsp"
+	iccSpaceRGB   = "RGB "
+	iccSpaceGray  = "GRAY"
+	iccSpaceCMYK  = "CMYK"
+	iccPCSXYZ     = "XYZ "
+	iccPCSLab     = "Lab "
+)
+
+// sRGB 的原色, 已适配到 D50, 列依次为 R, G, B
+var srgbD50 = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// srgbInverse D50 的 XYZ 到线性 sRGB
+var srgbInverse = inverse3(srgbD50)
+
+// sRGB 的传递函数, 参数曲线类型 3
+var srgbParams = []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045}
+
+// iccCurve 传递函数 (TRC), 把编码值映射为线性值
+type iccCurve struct {
+	table  []uint16  // curv 查找表
+	gamma  float64   // curv 只有一个值时
+	fn     uint16    // para 类型
+	params []float64 // para 参数
+	para   bool
+}
+
+func (c *iccCurve) eval(x float64) float64 {
+	switch {
+	case c.para:
+		return evalPara(c.fn, c.params, x)
+	case c.table != nil:
+		n := len(c.table) - 1
+		p := x * float64(n)
+		i := int(p)
+		if i >= n {
+			return float64(c.table[n]) / 65535
+		}
+		f := p - float64(i)
+		return (float64(c.table[i])*(1-f) + float64(c.table[i+1])*f) / 65535
+	default:
+		return math.Pow(x, c.gamma)
+	}
+}
+
+// evalPara 参数曲线, 见 ICC.1 parametricCurveType
+func evalPara(fn uint16, p []float64, x float64) float64 {
+	g := p[0]
+	switch fn {
+	case 1:
+		if x >= -p[2]/p[1] {
+			return math.Pow(p[1]*x+p[2], g)
+		}
+		return 0
+	case 2:
+		if x >= -p[2]/p[1] {
+			return math.Pow(p[1]*x+p[2], g) + p[3]
+		}
+		return p[3]
+	case 3:
+		if x >= p[4] {
+			return math.Pow(p[1]*x+p[2], g)
+		}
+		return p[3] * x
+	case 4:
+		if x >= p[4] {
+			return math.Pow(p[1]*x+p[2], g) + p[5]
+		}
+		return p[3]*x + p[6]
+	default:
+		return math.Pow(x, g)
+	}
+}
+
+// iccProfile 只支持 matrix/TRC 的 RGB 及灰度 profile
+type iccProfile struct {
+	gray   bool
+	matrix [3][3]float64 // 线性 RGB 到 PCS XYZ (D50)
+	trc    [3]*iccCurve
+}
+
+// iccTags 检查 profile 头部并返回各 tag 的数据
+func iccTags(b []byte) (map[string][]byte, error) {
+	if len(b) < iccHeaderSize+4 || string(b[36:40]) != iccMagic {
+		return nil, ErrInvalidFormat
+	}
+	n := int(binary.BigEndian.Uint32(b[iccHeaderSize:]))
+	if len(b) < iccHeaderSize+4+n*12 {
+		return nil, ErrInvalidFormat
+	}
+	tags := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		e := b[iccHeaderSize+4+i*12:]
+		off, size := binary.BigEndian.Uint32(e[4:]), binary.BigEndian.Uint32(e[8:])
+		if uint64(off)+uint64(size) > uint64(len(b)) || size < 8 {
+			return nil, ErrInvalidFormat
+		}
+		tags[string(e[:4])] = b[off : off+size]
+	}
+	return tags, nil
+}
+
+// iccColorSpace 返回 profile 的数据颜色空间, 如 "RGB ", "CMYK"
+func iccColorSpace(b []byte) string {
+	if len(b) < iccHeaderSize || string(b[36:40]) != iccMagic {
+		return ""
+	}
+	return string(b[16:20])
+}
+
+// parseICC 解析 ICC profile, 不支持的 profile 返回 ErrUnsupportFormat
+func parseICC(b []byte) (*iccProfile, error) {
+	tags, err := iccTags(b)
+	if err != nil {
+		return nil, err
+	}
+	if string(b[20:24]) != iccPCSXYZ {
+		return nil, ErrUnsupportFormat
+	}
+
+	p := new(iccProfile)
+	switch string(b[16:20]) {
+	case iccSpaceGray:
+		p.gray = true
+		if p.trc[0], err = parseCurve(tags["kTRC"]); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case iccSpaceRGB:
+	default:
+		return nil, ErrUnsupportFormat
+	}
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, err := parseXYZ(tags[sig])
+		if err != nil {
+			return nil, err
+		}
+		for j := range xyz {
+			p.matrix[j][i] = xyz[j]
+		}
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		if p.trc[i], err = parseCurve(tags[sig]); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func parseXYZ(b []byte) (xyz [3]float64, err error) {
+	if len(b) < 20 || string(b[:4]) != "XYZ " {
+		return xyz, ErrUnsupportFormat
+	}
+	for i := range xyz {
+		xyz[i] = s15Fixed16(b[8+i*4:])
+	}
+	return
+}
+
+func parseCurve(b []byte) (*iccCurve, error) {
+	if len(b) < 12 {
+		return nil, ErrUnsupportFormat
+	}
+	switch string(b[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		if len(b) < 12+n*2 {
+			return nil, ErrInvalidFormat
+		}
+		switch n {
+		case 0:
+			return &iccCurve{gamma: 1}, nil
+		case 1:
+			return &iccCurve{gamma: float64(binary.BigEndian.Uint16(b[12:])) / 256}, nil
+		}
+		c := &iccCurve{table: make([]uint16, n)}
+		for i := range c.table {
+			c.table[i] = binary.BigEndian.Uint16(b[12+i*2:])
+		}
+		return c, nil
+	case "para":
+		fn := binary.BigEndian.Uint16(b[8:])
+		np := [...]int{1, 3, 4, 5, 7}
+		if fn >= uint16(len(np)) || len(b) < 12+np[fn]*4 {
+			return nil, ErrUnsupportFormat
+		}
+		c := &iccCurve{para: true, fn: fn, params: make([]float64, np[fn])}
+		for i := range c.params {
+			c.params[i] = s15Fixed16(b[12+i*4:])
+		}
+		return c, nil
+	}
+	return nil, ErrUnsupportFormat
+}
+
+// isSRGB 与 sRGB 足够接近时不需要转换
+func (p *iccProfile) isSRGB() bool {
+	if p.gray {
+		return false
+	}
+	for i := range p.matrix {
+		for j := range p.matrix[i] {
+			if math.Abs(p.matrix[i][j]-srgbD50[i][j]) > 0.002 {
+				return false
+			}
+		}
+	}
+	for _, c := range p.trc {
+		for i := 0; i <= 32; i++ {
+			x := float64(i) / 32
+			if math.Abs(c.eval(x)-evalPara(3, srgbParams, x)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// srgbEncode 线性值到 sRGB 编码值
+func srgbEncode(v float64) float64 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 1:
+		return 1
+	case v <= 0.0031308:
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// inverse3 3x3 矩阵求逆
+func inverse3(m [3][3]float64) (r [3][3]float64) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// 伴随矩阵的转置
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			r[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return
+}
+
+func mul3(a, b [3][3]float64) (r [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = a[i][0]*b[0][j] + a[i][1]*b[1][j] + a[i][2]*b[2][j]
+		}
+	}
+	return
+}
+
+const srgbLUTSize = 1 << 14
+
+var (
+	srgbLUTOnce sync.Once
+	srgbLUT     []uint8 // 线性值到 8 位 sRGB
+)
+
+func srgbEncode8(v float32) uint8 {
+	srgbLUTOnce.Do(func() {
+		srgbLUT = make([]uint8, srgbLUTSize+1)
+		for i := range srgbLUT {
+			srgbLUT[i] = uint8(srgbEncode(float64(i)/srgbLUTSize)*255 + 0.5)
+		}
+	})
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 1:
+		return 255
+	}
+	return srgbLUT[int(v*srgbLUTSize+0.5)]
+}
+
+// iccTransform 把 profile 空间的像素转换为 sRGB
+type iccTransform struct {
+	gray   bool
+	matrix [3][3]float32
+	lin8   [3][256]float32
+	trc    [3]*iccCurve
+}
+
+// newSRGBTransform 不支持或已是 sRGB 的 profile 返回 nil
+func newSRGBTransform(icc []byte) *iccTransform {
+	if len(icc) == 0 {
+		return nil
+	}
+	p, err := parseICC(icc)
+	if err != nil || p.isSRGB() {
+		return nil
+	}
+	if p.gray {
+		p.trc[1], p.trc[2] = p.trc[0], p.trc[0]
+	}
+	t := &iccTransform{gray: p.gray, trc: p.trc}
+	if !p.gray {
+		m := mul3(srgbInverse, p.matrix)
+		for i := range m {
+			for j := range m[i] {
+				t.matrix[i][j] = float32(m[i][j])
+			}
+		}
+	}
+	for c := range t.lin8 {
+		for i := range t.lin8[c] {
+			t.lin8[c][i] = float32(p.trc[c].eval(float64(i) / 255))
+		}
+	}
+	return t
+}
+
+func (t *iccTransform) linear(r, g, b float32) (float32, float32, float32) {
+	if t.gray {
+		return r, g, b
+	}
+	m := &t.matrix
+	return m[0][0]*r + m[0][1]*g + m[0][2]*b,
+		m[1][0]*r + m[1][1]*g + m[1][2]*b,
+		m[2][0]*r + m[2][1]*g + m[2][2]*b
+}
+
+// convert8 转换 RGBA 或 NRGBA 的像素, 跳过 alpha
+func (t *iccTransform) convert8(pix []uint8) {
+	for i := 0; i+3 < len(pix); i += 4 {
+		r, g, b := t.linear(t.lin8[0][pix[i]], t.lin8[1][pix[i+1]], t.lin8[2][pix[i+2]])
+		pix[i], pix[i+1], pix[i+2] = srgbEncode8(r), srgbEncode8(g), srgbEncode8(b)
+	}
+}
+
+// convert16 转换 NRGBA64 的像素
+func (t *iccTransform) convert16(pix []uint8) {
+	for i := 0; i+7 < len(pix); i += 8 {
+		var v [3]float32
+		for c := range v {
+			v[c] = float32(t.trc[c].eval(float64(binary.BigEndian.Uint16(pix[i+c*2:])) / 0xffff))
+		}
+		r, g, b := t.linear(v[0], v[1], v[2])
+		for c, x := range []float32{r, g, b} {
+			binary.BigEndian.PutUint16(pix[i+c*2:], uint16(srgbEncode(float64(x))*0xffff+0.5))
+		}
+	}
+}
+
+// apply 返回转换后的新图像
+func (t *iccTransform) apply(m image.Image) image.Image {
+	b := m.Bounds()
+	switch m := m.(type) {
+	case *image.Gray:
+		if t.gray {
+			dst := image.NewGray(b)
+			for i, v := range m.Pix {
+				dst.Pix[i] = srgbEncode8(t.lin8[0][v])
+			}
+			return dst
+		}
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		dst := image.NewNRGBA64(b)
+		draw.Draw(dst, b, m, b.Min, draw.Src)
+		t.convert16(dst.Pix)
+		return dst
+	}
+	if isOpaque(m) {
+		dst := image.NewRGBA(b)
+		draw.Draw(dst, b, m, b.Min, draw.Src)
+		t.convert8(dst.Pix)
+		return dst
+	}
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	t.convert8(dst.Pix)
+	return dst
+}
+
+// toSRGB 按 ICC profile 把图像及动画的各帧转换为 sRGB, profile 不支持或已是 sRGB 时返回 false
+func toSRGB(icc []byte, m image.Image, anim *Animation) (image.Image, bool) {
+	t := newSRGBTransform(icc)
+	if t == nil {
+		return m, false
+	}
+	if anim != nil {
+		for i := range anim.Frames {
+			anim.Frames[i].Image = t.apply(anim.Frames[i].Image)
+		}
+		return anim.First(), true
+	}
+	return t.apply(m), true
+}
+
+var (
+	srgbProfileOnce sync.Once
+	srgbProfile     []byte
+)
+
+// SRGBProfile 返回精简的 sRGB ICC profile (v4, matrix/TRC)
+func SRGBProfile() []byte {
+	srgbProfileOnce.Do(func() {
+		srgbProfile = buildICC("sRGB", srgbD50, srgbParams)
+	})
+	return append([]byte(nil), srgbProfile...)
+}
+
+// buildICC 生成 v4 的显示器 profile, 三个通道使用同样的参数曲线
+func buildICC(desc string, matrix [3][3]float64, params []float64) []byte {
+	fixed := func(out []byte, vs ...float64) []byte {
+		for _, v := range vs {
+			out = binary.BigEndian.AppendUint32(out, uint32(int32(math.Round(v*65536))))
+		}
+		return out
+	}
+	mluc := func(s string) []byte {
+		out := append([]byte("mluc"), 0, 0, 0, 0)
+		out = binary.BigEndian.AppendUint32(out, 1)
+		out = binary.BigEndian.AppendUint32(out, 12)
+		out = append(out, "enUS"...)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(s)*2))
+		out = binary.BigEndian.AppendUint32(out, 28)
+		for _, r := range s {
+			out = binary.BigEndian.AppendUint16(out, uint16(r))
+		}
+		return out
+	}
+	xyz := func(vs ...float64) []byte {
+		return fixed(append([]byte("XYZ "), 0, 0, 0, 0), vs...)
+	}
+	para := append([]byte("para"), 0, 0, 0, 0, 0, 3, 0, 0)
+	para = fixed(para, params...)
+	// Bradford D65 到 D50
+	chad := fixed(append([]byte("sf32"), 0, 0, 0, 0),
+		1.0478112, 0.0228866, -0.0502170,
+		0.0295424, 0.9904844, -0.0170491,
+		-0.0092345, 0.0150436, 0.7521316)
+
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	tags := []tag{
+		{"desc", mluc(desc)},
+		{"cprt", mluc("No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"chad", chad},
+		{"rXYZ", xyz(matrix[0][0], matrix[1][0], matrix[2][0])},
+		{"gXYZ", xyz(matrix[0][1], matrix[1][1], matrix[2][1])},
+		{"bXYZ", xyz(matrix[0][2], matrix[1][2], matrix[2][2])},
+		{"rTRC", para},
+		{"gTRC", para},
+		{"bTRC", para},
+	}
+
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	offset := iccHeaderSize + 4 + len(tags)*12
+	var trcOff int
+	for _, t := range tags {
+		off := offset + len(data)
+		if t.sig[1:] == "TRC" && trcOff > 0 { // 共用同一条曲线
+			off = trcOff
+		} else {
+			if t.sig[1:] == "TRC" {
+				trcOff = off
+			}
+			data = append(data, t.data...)
+			for len(data)%4 != 0 {
+				data = append(data, 0)
+			}
+		}
+		table = append(table, t.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(off))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(t.data)))
+	}
+
+	hdr := make([]byte, iccHeaderSize)
+	binary.BigEndian.PutUint32(hdr, uint32(iccHeaderSize+len(table)+len(data)))
+	binary.BigEndian.PutUint32(hdr[8:], 0x04300000)
+	copy(hdr[12:], "mntr")
+	copy(hdr[16:], iccSpaceRGB)
+	copy(hdr[20:], iccPCSXYZ)
+	binary.BigEndian.PutUint16(hdr[24:], 2024) // 日期
+	binary.BigEndian.PutUint16(hdr[26:], 1)
+	binary.BigEndian.PutUint16(hdr[28:], 1)
+	copy(hdr[36:], iccMagic)
+	copy(hdr[68:], fixed(nil, 0.9642, 1, 0.8249)) // PCS illuminant
+	out := append(hdr, table...)
+	return append(out, data...)
+}
@@ -0,0 +1,113 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Display P3 的原色, 已适配到 D50
+var p3D50 = [3][3]float64{
+	{0.5151187, 0.2919778, 0.1571340},
+	{0.2411892, 0.6922441, 0.0665668},
+	{-0.0010505, 0.0418791, 0.7840713},
+}
+
+// p3PNG a 8x8 png filled with c, tagged Display P3
+func p3PNG(t *testing.T, c color.Color) []byte {
+	m := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < 64; i++ {
+		m.Set(i%8, i/8, c)
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, m)
+	assert.NoError(t, err)
+	data, err := embedPNGMeta(buf.Bytes(), &Metadata{ICC: buildICC("Display P3", p3D50, srgbParams)})
+	assert.NoError(t, err)
+	return data
+}
+
+func TestICCProfile(t *testing.T) {
+	p, err := parseICC(SRGBProfile())
+	assert.NoError(t, err)
+	assert.True(t, p.isSRGB())
+	assert.Nil(t, newSRGBTransform(SRGBProfile()))
+
+	p, err = parseICC(buildICC("Display P3", p3D50, srgbParams))
+	assert.NoError(t, err)
+	assert.False(t, p.isSRGB())
+	assert.InDelta(t, 0.5151187, p.matrix[0][0], 0.0001)
+
+	_, err = parseICC([]byte("icc-icc-icc-"))
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+
+	m := inverse3(srgbD50)
+	m = mul3(m, srgbD50)
+	for i := range m {
+		for j := range m[i] {
+			if i == j {
+				assert.InDelta(t, 1, m[i][j], 1e-9)
+			} else {
+				assert.InDelta(t, 0, m[i][j], 1e-9)
+			}
+		}
+	}
+}
+
+func TestToSRGB(t *testing.T) {
+	data := p3PNG(t, color.NRGBA{200, 100, 50, 255})
+
+	im, err := Open(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, color.NRGBA{200, 100, 50, 255}, color.NRGBAModel.Convert(im.m.At(1, 1)))
+
+	im, err = OpenWith(bytes.NewReader(data), &ReadOption{ToSRGB: true})
+	assert.NoError(t, err)
+	c := color.NRGBAModel.Convert(im.m.At(1, 1)).(color.NRGBA)
+	assert.InDelta(t, 215, int(c.R), 1)
+	assert.InDelta(t, 93, int(c.G), 1)
+	assert.InDelta(t, 31, int(c.B), 1)
+
+	// 原 profile 已不适用
+	var buf bytes.Buffer
+	_, err = im.SaveTo(&buf, &WriteOption{Format: FormatPNG, KeepMeta: MetaAll})
+	assert.NoError(t, err)
+	md, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Nil(t, md.ICC)
+
+	buf.Reset()
+	_, err = im.SaveTo(&buf, &WriteOption{Format: FormatJPEG, EmbedSRGB: true})
+	assert.NoError(t, err)
+	md, err = ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, SRGBProfile(), md.ICC)
+
+	buf.Reset()
+	topt := &ThumbOption{Width: 4, Height: 4, IsFit: true}
+	topt.ToSRGB = true
+	topt.KeepMeta = MetaAll
+	_, err = Thumbnail(bytes.NewReader(data), &buf, topt)
+	assert.NoError(t, err)
+	md, err = ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Nil(t, md.ICC)
+	out, err := png.Decode(&buf)
+	assert.NoError(t, err)
+	c = color.NRGBAModel.Convert(out.At(1, 1)).(color.NRGBA)
+	assert.InDelta(t, 215, int(c.R), 1)
+
+	// 未转换时保留原 profile
+	buf.Reset()
+	topt = &ThumbOption{Width: 4, Height: 4, IsFit: true}
+	topt.KeepMeta = MetaAll
+	_, err = Thumbnail(bytes.NewReader(data), &buf, topt)
+	assert.NoError(t, err)
+	md, err = ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.NotNil(t, md.ICC)
+}
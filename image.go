@@ -3,9 +3,8 @@ package image
 import (
 	"bytes"
 	"image"
-	"image/gif"
+	"image/color"
 	"image/jpeg"
-	"image/png"
 	"io"
 	"log/slog"
 
@@ -16,6 +15,7 @@ import (
 const (
 	MinJPEGQuality = jpeg.DefaultQuality // 75
 	MinWebpQuality = 80
+	MinAVIFQuality = 60
 )
 
 // consts
@@ -24,15 +24,18 @@ const (
 	FormatJPEG = "jpeg"
 	FormatPNG  = "png"
 	FormatWEBP = "webp"
-)
+	FormatTIFF = "tiff"
+	FormatBMP  = "bmp"
+	FormatQOI  = "qoi"
+	FormatPBM  = "pbm"
+	FormatPGM  = "pgm"
+	FormatPPM  = "ppm"
+	FormatPAM  = "pam"
+	FormatTGA  = "tga"
+	FormatAVIF = "avif"
+	FormatHEIC = "heic"
 
-var (
-	mtypes = map[string]string{
-		FormatGIF:  "image/gif",
-		FormatJPEG: "image/jpeg",
-		FormatPNG:  "image/png",
-		FormatWEBP: "image/webp",
-	}
+	FormatFarbfeld = "farbfeld"
 )
 
 // Imager ...
@@ -47,49 +50,189 @@ type Image struct {
 	Format string
 	m      image.Image
 	rs     io.ReadSeeker
-	rn     int // read length
+	rn     int         // read length
+	orient Orientation // applied orientation
+	meta   *Metadata
+	ropt   *ReadOption
+	anim   *Animation
+	srgb   bool // 已按 ICC profile 转换为 sRGB
+}
+
+// ReadOption 读取选项
+type ReadOption struct {
+	AutoOrient bool    // 按 EXIF Orientation 自动旋转
+	Lazy       bool    // 只读取属性, 首次 SaveTo/ThumbnailTo 时才解码像素
+	ToSRGB     bool    // 按内嵌的 ICC profile 把像素转换为 sRGB
+	Limits     *Limits // 解码限制, 为 nil 时使用 DefaultLimits
+	Page       int     // 多页 TIFF 读取的页, 从 0 开始
 }
 
 // Open ...
 func Open(rs io.ReadSeeker) (*Image, error) {
+	return OpenWith(rs, nil)
+}
+
+// OpenWith open an image with read option
+func OpenWith(rs io.ReadSeeker, ropt *ReadOption) (*Image, error) {
+	if ropt == nil {
+		ropt = new(ReadOption)
+	}
+	if ropt.Lazy {
+		return probe(rs, ropt)
+	}
 
 	cw := new(CountWriter)
-	m, format, err := image.Decode(io.TeeReader(rs, cw))
+	m, anim, format, err := decodeFrames(io.TeeReader(rs, cw), ropt, true)
 	if err != nil {
 		return nil, err
 	}
+	model := m.ColorModel()
+	var orient Orientation
+	if format == FormatJPEG && ropt.AutoOrient {
+		_, _ = rs.Seek(0, 0)
+		if orient = ReadOrientation(rs); orient > OrientNormal {
+			m = Orient(m, orient)
+		}
+	}
 	im, err := NewFromImage(m, cw.Len(), format)
 	if err != nil {
 		return nil, err
 	}
 	im.rs = rs
-	if format == FormatJPEG {
-		jr, err := jpegquality.New(rs)
+	im.orient = orient
+	im.ropt = ropt
+	im.setAnimation(anim)
+	im.readColorModel(model)
+	im.toSRGB()
+	im.readPages()
+	if err = im.readQuality(); err != nil {
+		return nil, err
+	}
+	return im, nil
+}
+
+// readQuality 读取 JPEG 的原始质量
+func (im *Image) readQuality() error {
+	if im.Format == FormatJPEG {
+		jr, err := jpegquality.New(im.rs)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		im.Quality = uint8(jr.Quality())
 	}
-	return im, nil
+	return nil
+}
+
+// setAnimation 记录动画及其帧数
+func (im *Image) setAnimation(anim *Animation) {
+	im.anim = anim
+	if anim != nil {
+		im.Frames = len(anim.Frames)
+		im.Animated = true
+	}
+}
+
+// readColorModel 记录原图的颜色空间及位深
+func (im *Image) readColorModel(model color.Model) {
+	im.BitDepth = 8
+	switch model {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		im.BitDepth = 16
+	}
+	if im.Format == FormatJPEG && im.rs != nil {
+		_, _ = im.rs.Seek(0, 0)
+		im.ColorSpace = jpegColorSpace(im.rs)
+		return
+	}
+	im.ColorSpace = colorSpaceOf(model)
+}
+
+// isCMYK 原图是否为 CMYK, 解码时已转换为 RGB
+func (im *Image) isCMYK() bool {
+	return im.ColorSpace == ColorSpaceCMYK || im.ColorSpace == ColorSpaceYCCK
+}
+
+// toSRGB 按选项把像素转换为 sRGB
+func (im *Image) toSRGB() {
+	if im.ropt != nil && im.ropt.ToSRGB {
+		im.m, im.srgb = toSRGB(im.Metadata().ICC, im.m, im.anim)
+	}
+}
+
+// Animation 返回动画, 不是动画时为 nil
+func (im *Image) Animation() *Animation {
+	return im.anim
+}
+
+// decodeWith decode an image from reader with read option, all for all frames of animation,
+// srgb reports whether the pixels are converted to sRGB
+func decodeWith(r io.Reader, ropt *ReadOption, all bool) (m image.Image, anim *Animation, format string, srgb bool, err error) {
+	if ropt == nil || (!ropt.AutoOrient && !ropt.ToSRGB) {
+		m, anim, format, err = decodeFrames(r, ropt, all)
+		return
+	}
+	var buf bytes.Buffer
+	m, anim, format, err = decodeFrames(io.TeeReader(r, &buf), ropt, all)
+	if err != nil {
+		return
+	}
+	if format == FormatJPEG && ropt.AutoOrient {
+		if o := ReadOrientation(bytes.NewReader(buf.Bytes())); o > OrientNormal {
+			m = Orient(m, o)
+		}
+	}
+	if ropt.ToSRGB {
+		if md, e := readMetadata(&buf, int64(buf.Len())); e == nil {
+			m, srgb = toSRGB(md.ICC, m, anim)
+		}
+	}
+	return
 }
 
 func NewFromImage(m image.Image, size int, format string) (*Image, error) {
 	pt := m.Bounds().Max
-	attr := NewAttr(uint(pt.X), uint(pt.Y), format)
-	if mt, ok := mtypes[format]; ok {
-		attr.Mime = mt
-	}
-	attr.Size = uint32(size)
 	return &Image{
-		m: m, Attr: attr, Format: format, rn: size,
+		m: m, Attr: newAttrWith(uint(pt.X), uint(pt.Y), format, size), Format: format, rn: size,
 	}, nil
 }
 
+func newAttrWith(w, h uint, format string, size int) *Attr {
+	attr := NewAttr(w, h, format)
+	if f := lookupFormat(format); f != nil {
+		attr.Mime = f.Mime
+	}
+	attr.Size = uint32(size)
+	return attr
+}
+
 // WriteOption ...
 type WriteOption struct {
 	Format  string
 	Quality uint8
 
+	KeepMeta MetaFlag  // 需要保留的元数据
+	Scrub    ExifScrub // 需要从 EXIF 中移除的隐私信息
+	Metadata *Metadata // 元数据来源, Image 默认为原图的元数据
+
+	EmbedSRGB bool // 写入 sRGB ICC profile, 替换原有的 profile
+
+	JPEG *JPEGOption // JPEG 编码选项, 为 nil 时使用标准库的编码器
+	PNG  *PNGOption  // PNG 编码选项, 为 nil 时使用标准库的编码器
+	GIF  *GIFOption  // GIF 量化选项, 为 nil 时使用 Plan9 调色板及抖动
+	WebP *WebPOption // WebP 编码选项
+	TIFF *TIFFOption // TIFF 编码选项, 为 nil 时使用 Deflate 压缩
+	AVIF *AVIFOption // AVIF 编码选项
+
+	Options map[string]any // 各格式的编码选项, 键为格式名, 内置格式优先于以上的字段, 见 EncoderOf
+
+	MaxBytes    int     // 输出的最大字节数, 只用于 JPEG 及 WebP 静态图, 查找不超过的最高质量; 0 为不限制
+	AutoQuality float64 // 自动质量, 选择与原图亮度的 SSIM 不低于此值的最低质量, 如 0.98; 只用于 JPEG 及 WebP 静态图
+	MinQuality  uint8   // MaxBytes 及 AutoQuality 查找的最低质量, 0 为 10; Quality 为最高质量, 0 为 100
+	Downscale   bool    // 最低质量仍超过 MaxBytes 时逐步缩小图像
+
+	srgb         bool  // 像素已转换为 sRGB, 原有的 ICC profile 不再适用
+	finalQuality uint8 // MaxBytes 或 AutoQuality 查找后实际使用的质量, 见 Output.Quality
+
 	ExtraWriter io.Writer // 额外的输出 一般用于hash计算
 }
 
@@ -97,42 +240,144 @@ func (o *WriteOption) patch() {
 	o.Format = PatchFormat(o.Format)
 }
 
-// SaveTo ...
-func (im *Image) SaveTo(w io.Writer, opt *WriteOption) (int, error) {
-	if opt == nil {
-		opt = new(WriteOption)
+// hasMetaPolicy 是否设置了保留, 清理或替换元数据的选项
+func (o *WriteOption) hasMetaPolicy() bool {
+	return o.KeepMeta != MetaNone || o.Scrub != ScrubNone || o.EmbedSRGB
+}
+
+// selectMeta 按选项筛选并清理元数据
+func (o *WriteOption) selectMeta() *Metadata {
+	md := o.Metadata.Select(o.KeepMeta)
+	if o.srgb || o.EmbedSRGB {
+		if md == nil {
+			md = new(Metadata)
+		}
+		md.ICC = nil
+		if o.EmbedSRGB {
+			md.ICC = SRGBProfile()
+		}
+		if md.IsEmpty() {
+			md = nil
+		}
+	}
+	if md != nil && iccColorSpace(md.ICC) == iccSpaceCMYK {
+		// 输出的都是 RGB, CMYK 的 profile 不再适用
+		md.ICC = nil
+		if md.IsEmpty() {
+			md = nil
+		}
+	}
+	if md == nil || o.Scrub == ScrubNone {
+		return md
+	}
+	if len(md.XMP) > 0 && o.Scrub&ScrubGPS != 0 {
+		md.XMP = scrubXMPGPS(md.XMP)
 	}
-	if opt.Format == "" {
-		opt.Format = im.Format
+	if len(md.Exif) > 0 {
+		exif, err := ScrubExif(md.Exif, o.Scrub)
+		if err != nil {
+			slog.Info("scrub exif fail, dropped", "err", err)
+			exif = nil
+		}
+		md.Exif = exif
 	}
-	if !WebpEncodable && im.Format == FormatWEBP && im.rs != nil {
+	if md.IsEmpty() {
+		return nil
+	}
+	return md
+}
+
+// Metadata 返回原图的元数据, 首次调用时读取
+func (im *Image) Metadata() *Metadata {
+	if im.meta == nil && im.rs != nil {
 		_, _ = im.rs.Seek(0, 0)
-		n, err := io.Copy(w, im.rs)
-		return int(n), err
+		l := im.ropt.limits()
+		md, err := readMetadata(l.reader(im.rs), l.MaxBytes)
+		if err != nil {
+			slog.Debug("read metadata fail", "err", err)
+			md = new(Metadata)
+		}
+		if im.orient > OrientNormal {
+			md.resetOrientation()
+		}
+		im.meta = md
+	}
+	return im.meta
+}
+
+// SaveTo ...
+func (im *Image) SaveTo(w io.Writer, opt *WriteOption) (*Output, error) {
+	// 在副本上补全格式及元数据, 同一个选项用于多个图像时不会带入上一个图像的元数据
+	var o WriteOption
+	if opt != nil {
+		o = *opt
+	}
+	if o.Format == "" {
+		o.Format = outputFormat(im.Format)
+	}
+	if o.KeepMeta != MetaNone && o.Metadata == nil {
+		o.Metadata = im.Metadata()
 	}
+	if err := im.load(); err != nil {
+		return nil, err
+	}
+	o.srgb = im.srgb
+	// 是否复制原图要在编码后决定, ExtraWriter 只接收最终写入的数据
+	extra := o.ExtraWriter
+	o.ExtraWriter = nil
 	var buf bytes.Buffer
-	err := SaveTo(&buf, im.m, opt)
+	var out *Output
+	var err error
+	if im.anim != nil {
+		out, err = SaveAnimationTo(&buf, im.anim, &o)
+	} else {
+		out, err = SaveTo(&buf, im.m, &o)
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if extra != nil {
+		w = io.MultiWriter(w, extra)
 	}
 	var nn int64
-	if im.Format == opt.Format && buf.Len() > im.rn && im.rs != nil {
+	passed := im.Format == o.Format && buf.Len() > im.rn && im.rs != nil && im.orient <= OrientNormal && !im.srgb && !im.isCMYK() && im.Pages <= 1
+	if passed {
 		slog.Debug("saved", "n", buf.Len(), "read length", im.rn)
-		_, _ = im.rs.Seek(0, 0)
-		nn, err = io.Copy(w, im.rs)
+		nn, err = im.copyTo(w, &o)
 	} else {
 		nn, err = io.Copy(w, &buf)
 	}
 	if err != nil {
 		slog.Info("copy fail", "err", err, "bytes", nn)
-	} else {
-		slog.Debug("copied", "bytes", nn)
+		return nil, err
 	}
-	return int(nn), err
+	slog.Debug("copied", "bytes", nn)
+	if passed {
+		return passOutput(im.Attr, im.Format, PassLarger, int(nn)), nil
+	}
+	return out, nil
+}
+
+// copyTo 复制原图数据, 原图中的元数据按选项改写
+func (im *Image) copyTo(w io.Writer, opt *WriteOption) (int64, error) {
+	_, _ = im.rs.Seek(0, 0)
+	data, err := io.ReadAll(im.rs)
+	if err != nil {
+		return 0, err
+	}
+	// 未设置元数据选项时原样复制, 保留 ICC 及 EXIF Orientation
+	if opt.hasMetaPolicy() {
+		data, err = replaceMeta(im.Format, data, opt.selectMeta())
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.Write(data)
+	return int64(n), err
 }
 
 // SaveTo ...
-func SaveTo(w io.Writer, m image.Image, opt *WriteOption) (err error) {
+func SaveTo(w io.Writer, m image.Image, opt *WriteOption) (*Output, error) {
 	if opt == nil {
 		opt = new(WriteOption)
 	}
@@ -142,45 +387,68 @@ func SaveTo(w io.Writer, m image.Image, opt *WriteOption) (err error) {
 	}
 
 	opt.patch()
-	switch opt.Format {
-	case FormatJPEG:
-		qlt := int(opt.Quality)
-		if qlt == 0 {
-			qlt = MinJPEGQuality
-		}
-		err = jpeg.Encode(w, m, &jpeg.Options{Quality: qlt})
-		return
-	case FormatGIF:
-		err = gif.Encode(w, m, &gif.Options{
-			NumColors: 256,
-			Quantizer: nil,
-			Drawer:    nil,
-		})
-		return
-	case FormatPNG:
-		err = png.Encode(w, m)
-		return
-	case FormatWEBP:
-		qlt := int(opt.Quality)
-		if qlt == 0 {
-			qlt = MinWebpQuality
-		}
-		err = webpEncode(w, m, float32(qlt))
-		return
-	default:
+	cw := new(CountWriter)
+	m, err := save(io.MultiWriter(w, cw), m, opt)
+	if err != nil {
+		return nil, err
+	}
+	return imageOutput(m, opt, cw.Len()), nil
+}
+
+// save 按选项编码并写入 w, 返回实际写入的图像
+func save(w io.Writer, m image.Image, opt *WriteOption) (image.Image, error) {
+	md := opt.selectMeta()
+	if opt.AutoQuality > 0 && opt.searchable() {
+		return saveAutoQuality(w, m, opt, md)
+	}
+	if opt.MaxBytes > 0 && opt.searchable() {
+		return saveMaxBytes(w, m, opt, md)
+	}
+	if md == nil {
+		return m, encode(w, m, opt)
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, m, opt); err != nil {
+		return nil, err
+	}
+	data, err := embedMeta(opt.Format, buf.Bytes(), md)
+	if err != nil {
+		slog.Info("embed metadata fail", "err", err)
+		return nil, err
+	}
+	_, err = w.Write(data)
+	return m, err
+}
+
+func encode(w io.Writer, m image.Image, opt *WriteOption) error {
+	f := lookupFormat(opt.Format)
+	if f == nil || f.Encode == nil {
 		slog.Info("invalid format", "opt", opt)
-		err = ErrUnsupportFormat
-		return
+		return ErrUnsupportFormat
 	}
+	return f.Encode(w, m, opt)
 }
 
 // ThumbnailTo ...
-func (im *Image) ThumbnailTo(w io.Writer, topt *ThumbOption) error {
-	if im.m == nil {
-		return ErrEmptyImage
+func (im *Image) ThumbnailTo(w io.Writer, topt *ThumbOption) (*Output, error) {
+	if err := im.load(); err != nil {
+		return nil, err
+	}
+	t := *topt
+	if t.Format == "" {
+		t.Format = outputFormat(im.Format)
 	}
-	if topt.Format == "" {
-		topt.Format = im.Format
+	if t.KeepMeta != MetaNone && t.Metadata == nil {
+		t.Metadata = im.Metadata()
+	}
+	t.srgb = im.srgb
+	var out *Output
+	var err error
+	if im.anim != nil {
+		out, err = ThumbnailAnimationTo(im.anim, w, &t)
+	} else {
+		out, err = ThumbnailImageTo(im.m, w, &t)
 	}
-	return ThumbnailImageTo(im.m, w, topt)
+	return out, err
 }
@@ -0,0 +1,183 @@
+//go:build cgo && libavif
+// +build cgo,libavif
+
+package image
+
+/*
+#cgo pkg-config: libavif
+#include <stdlib.h>
+#include <avif/avif.h>
+
+// imagi_avif_decode 解码主图, 成功时返回 decoder, 由调用者销毁
+static avifDecoder *imagi_avif_decode(const uint8_t *data, size_t size, avifResult *res) {
+	avifDecoder *dec = avifDecoderCreate();
+	if (dec == NULL) {
+		*res = AVIF_RESULT_OUT_OF_MEMORY;
+		return NULL;
+	}
+	dec->ignoreExif = AVIF_TRUE;
+	dec->ignoreXMP = AVIF_TRUE;
+	*res = avifDecoderSetIOMemory(dec, data, size);
+	if (*res == AVIF_RESULT_OK) {
+		*res = avifDecoderParse(dec);
+	}
+	if (*res == AVIF_RESULT_OK) {
+		*res = avifDecoderNextImage(dec);
+	}
+	if (*res != AVIF_RESULT_OK) {
+		avifDecoderDestroy(dec);
+		return NULL;
+	}
+	return dec;
+}
+
+// imagi_avif_rgba 转换为非预乘的 RGBA, depth 为 8 或 16
+static avifResult imagi_avif_rgba(avifDecoder *dec, uint8_t *pixels, uint32_t rowBytes, uint32_t depth) {
+	avifRGBImage rgb;
+	avifRGBImageSetDefaults(&rgb, dec->image);
+	rgb.format = AVIF_RGB_FORMAT_RGBA;
+	rgb.depth = depth;
+	rgb.alphaPremultiplied = AVIF_FALSE;
+	rgb.pixels = pixels;
+	rgb.rowBytes = rowBytes;
+	return avifImageYUVToRGB(dec->image, &rgb);
+}
+
+static avifResult imagi_avif_encode(uint8_t *pixels, uint32_t width, uint32_t height, uint32_t rowBytes,
+	uint32_t rgbDepth, uint32_t depth, int alpha, int quality, int qualityAlpha, int speed, int lossless, int threads, avifRWData *out) {
+	avifImage *image = avifImageCreate(width, height, depth, lossless ? AVIF_PIXEL_FORMAT_YUV444 : AVIF_PIXEL_FORMAT_YUV420);
+	if (image == NULL) {
+		return AVIF_RESULT_OUT_OF_MEMORY;
+	}
+	if (lossless) {
+		image->matrixCoefficients = AVIF_MATRIX_COEFFICIENTS_IDENTITY;
+	}
+	avifRGBImage rgb;
+	avifRGBImageSetDefaults(&rgb, image);
+	rgb.format = AVIF_RGB_FORMAT_RGBA;
+	rgb.depth = rgbDepth;
+	rgb.ignoreAlpha = alpha ? AVIF_FALSE : AVIF_TRUE;
+	rgb.pixels = pixels;
+	rgb.rowBytes = rowBytes;
+	avifResult res = avifImageRGBToYUV(image, &rgb);
+	if (res == AVIF_RESULT_OK) {
+		avifEncoder *enc = avifEncoderCreate();
+		if (enc == NULL) {
+			res = AVIF_RESULT_OUT_OF_MEMORY;
+		} else {
+			enc->quality = lossless ? AVIF_QUALITY_LOSSLESS : quality;
+			enc->qualityAlpha = lossless ? AVIF_QUALITY_LOSSLESS : qualityAlpha;
+			enc->speed = speed;
+			enc->maxThreads = threads;
+			res = avifEncoderWrite(enc, image, out);
+			avifEncoderDestroy(enc);
+		}
+	}
+	avifImageDestroy(image);
+	return res;
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"runtime"
+	"unsafe"
+)
+
+// AVIFCodec 当前构建是否可以解码及编码 AVIF
+const AVIFCodec = true
+
+func avifError(res C.avifResult) error {
+	return errors.New("avif: " + C.GoString(C.avifResultToString(res)))
+}
+
+func avifDecode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := readAVIF(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	// decoder 在解码之后仍持有输入, 需要使用 C 的内存
+	cdata := C.CBytes(data)
+	defer C.free(cdata)
+	var res C.avifResult
+	dec := C.imagi_avif_decode((*C.uint8_t)(cdata), C.size_t(len(data)), &res)
+	if dec == nil {
+		return nil, avifError(res)
+	}
+	defer C.avifDecoderDestroy(dec)
+
+	rect := image.Rect(0, 0, int(dec.image.width), int(dec.image.height))
+	var m image.Image
+	if dec.image.depth > 8 {
+		nm := image.NewNRGBA64(rect)
+		res = C.imagi_avif_rgba(dec, (*C.uint8_t)(unsafe.Pointer(&nm.Pix[0])), C.uint32_t(nm.Stride), 16)
+		// libavif 为本机字节序, NRGBA64 为大端
+		for i := 0; i < len(nm.Pix); i += 2 {
+			binary.BigEndian.PutUint16(nm.Pix[i:], binary.NativeEndian.Uint16(nm.Pix[i:]))
+		}
+		m = nm
+	} else {
+		nm := image.NewNRGBA(rect)
+		res = C.imagi_avif_rgba(dec, (*C.uint8_t)(unsafe.Pointer(&nm.Pix[0])), C.uint32_t(nm.Stride), 8)
+		m = nm
+	}
+	if res != C.AVIF_RESULT_OK {
+		return nil, avifError(res)
+	}
+	return h.orient(m), nil
+}
+
+func avifEncode(w io.Writer, m image.Image, qlt int, o *AVIFOption) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	var pix []byte
+	var stride, depth int // RGB 的位深
+	if isDeep(m) {
+		src := image.NewNRGBA64(b)
+		draw.Draw(src, b, m, b.Min, draw.Src)
+		for i := 0; i < len(src.Pix); i += 2 {
+			binary.NativeEndian.PutUint16(src.Pix[i:], binary.BigEndian.Uint16(src.Pix[i:]))
+		}
+		pix, stride, depth = src.Pix, src.Stride, 16
+	} else {
+		src := image.NewNRGBA(b)
+		draw.Draw(src, b, m, b.Min, draw.Src)
+		pix, stride, depth = src.Pix, src.Stride, 8
+	}
+	// 16 位的图按 10 位编码
+	yuvDepth := 8
+	if depth == 16 {
+		yuvDepth = 10
+	}
+	alpha := 0
+	if !isOpaque(m) {
+		alpha = 1
+	}
+	lossless := 0
+	if o != nil && o.Lossless {
+		lossless = 1
+	}
+
+	var out C.avifRWData
+	res := C.imagi_avif_encode((*C.uint8_t)(unsafe.Pointer(&pix[0])), C.uint32_t(b.Dx()), C.uint32_t(b.Dy()),
+		C.uint32_t(stride), C.uint32_t(depth), C.uint32_t(yuvDepth), C.int(alpha), C.int(qlt), C.int(o.alphaQuality(qlt)),
+		C.int(o.speed()), C.int(lossless), C.int(runtime.NumCPU()), &out)
+	defer C.avifRWDataFree(&out)
+	if res != C.AVIF_RESULT_OK {
+		return avifError(res)
+	}
+	_, err := w.Write(C.GoBytes(unsafe.Pointer(out.data), C.int(out.size)))
+	return err
+}
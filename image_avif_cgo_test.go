@@ -0,0 +1,49 @@
+//go:build cgo && libavif
+// +build cgo,libavif
+
+package image
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAVIFCodec(t *testing.T) {
+	src := photo(120, 90)
+	var lossy, best bytes.Buffer
+	_, err := SaveTo(&lossy, src, &WriteOption{Format: FormatAVIF, Quality: 50})
+	assert.NoError(t, err)
+	_, err = SaveTo(&best, src, &WriteOption{Format: FormatAVIF, Quality: 90, AVIF: &AVIFOption{Speed: 8}})
+	assert.NoError(t, err)
+	assert.Less(t, lossy.Len(), best.Len())
+
+	im, err := Open(bytes.NewReader(best.Bytes()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatAVIF, im.Format)
+		assert.Equal(t, "image/avif", im.Mime)
+		assert.Equal(t, 120, int(im.Width))
+	}
+	m, _, err := image.Decode(&best)
+	if assert.NoError(t, err) {
+		assert.Less(t, meanDiff(src, m), 4.0)
+	}
+
+	alpha := image.NewNRGBA(image.Rect(0, 0, 37, 21))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = uint8(i * 13)
+	}
+	var buf bytes.Buffer
+	_, err = SaveTo(&buf, alpha, &WriteOption{Format: FormatAVIF, AVIF: &AVIFOption{Lossless: true}})
+	assert.NoError(t, err)
+	h, err := readAVIF(bytes.NewReader(buf.Bytes()))
+	if assert.NoError(t, err) {
+		assert.True(t, h.alpha)
+	}
+	m, err = avifDecode(&buf)
+	if assert.NoError(t, err) {
+		samePixels(t, alpha, m)
+	}
+}
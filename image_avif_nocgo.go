@@ -0,0 +1,20 @@
+//go:build !cgo || !libavif
+// +build !cgo !libavif
+
+package image
+
+import (
+	"image"
+	"io"
+)
+
+// AVIFCodec 当前构建是否可以解码及编码 AVIF
+const AVIFCodec = false
+
+func avifDecode(r io.Reader) (image.Image, error) {
+	return nil, ErrNoCodec
+}
+
+func avifEncode(w io.Writer, m image.Image, qlt int, o *AVIFOption) error {
+	return ErrNoCodec
+}
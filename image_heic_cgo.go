@@ -0,0 +1,106 @@
+//go:build cgo && libheif
+// +build cgo,libheif
+
+package image
+
+/*
+#cgo pkg-config: libheif
+#include <stdlib.h>
+#include <libheif/heif.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"unsafe"
+)
+
+// HEICCodec 当前构建是否可以解码 HEIC
+const HEICCodec = true
+
+func heifError(err C.struct_heif_error) error {
+	if err.code == C.heif_error_Ok {
+		return nil
+	}
+	return errors.New("heic: " + C.GoString(err.message))
+}
+
+// heicDecode 解码主图, libheif 已按 irot/imir 旋转
+func heicDecode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// context 引用输入而不复制, 需要使用 C 的内存
+	cdata := C.CBytes(data)
+	defer C.free(cdata)
+	ctx := C.heif_context_alloc()
+	if ctx == nil {
+		return nil, ErrNoCodec
+	}
+	defer C.heif_context_free(ctx)
+	if err = heifError(C.heif_context_read_from_memory_without_copy(ctx, cdata, C.size_t(len(data)), nil)); err != nil {
+		return nil, err
+	}
+	var handle *C.struct_heif_image_handle
+	if err = heifError(C.heif_context_get_primary_image_handle(ctx, &handle)); err != nil {
+		return nil, err
+	}
+	defer C.heif_image_handle_release(handle)
+
+	deep := C.heif_image_handle_get_luma_bits_per_pixel(handle) > 8
+	chroma := C.enum_heif_chroma(C.heif_chroma_interleaved_RGBA)
+	if deep {
+		chroma = C.heif_chroma_interleaved_RRGGBBAA_BE
+	}
+	var img *C.struct_heif_image
+	if err = heifError(C.heif_decode_image(handle, &img, C.heif_colorspace_RGB, chroma, nil)); err != nil {
+		return nil, err
+	}
+	defer C.heif_image_release(img)
+
+	var stride C.int
+	plane := C.heif_image_get_plane_readonly(img, C.heif_channel_interleaved, &stride)
+	if plane == nil {
+		return nil, ErrInvalidFormat
+	}
+	w := int(C.heif_image_get_width(img, C.heif_channel_interleaved))
+	h := int(C.heif_image_get_height(img, C.heif_channel_interleaved))
+	bpp := 4
+	if deep {
+		bpp = 8
+	}
+	src := unsafe.Slice((*byte)(unsafe.Pointer(plane)), int(stride)*(h-1)+w*bpp)
+	rect := image.Rect(0, 0, w, h)
+	premultiplied := C.heif_image_handle_is_premultiplied_alpha(handle) != 0
+
+	if !deep {
+		pix, stride8 := make([]byte, w*h*4), w*4
+		for y := 0; y < h; y++ {
+			copy(pix[y*stride8:], src[y*int(stride):y*int(stride)+stride8])
+		}
+		if premultiplied {
+			return &image.RGBA{Pix: pix, Stride: stride8, Rect: rect}, nil
+		}
+		return &image.NRGBA{Pix: pix, Stride: stride8, Rect: rect}, nil
+	}
+
+	// 按实际位深放大到 16 位
+	bits := int(C.heif_image_get_bits_per_pixel_range(img, C.heif_channel_interleaved))
+	maxval := uint32(1)<<bits - 1
+	pix, stride16 := make([]byte, w*h*8), w*8
+	for y := 0; y < h; y++ {
+		row := src[y*int(stride):]
+		for i := 0; i < stride16; i += 2 {
+			v := uint32(binary.BigEndian.Uint16(row[i:]))
+			binary.BigEndian.PutUint16(pix[y*stride16+i:], uint16(min(v, maxval)*0xffff/maxval))
+		}
+	}
+	if premultiplied {
+		return &image.RGBA64{Pix: pix, Stride: stride16, Rect: rect}, nil
+	}
+	return &image.NRGBA64{Pix: pix, Stride: stride16, Rect: rect}, nil
+}
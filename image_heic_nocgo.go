@@ -0,0 +1,16 @@
+//go:build !cgo || !libheif
+// +build !cgo !libheif
+
+package image
+
+import (
+	"image"
+	"io"
+)
+
+// HEICCodec 当前构建是否可以解码 HEIC
+const HEICCodec = false
+
+func heicDecode(r io.Reader) (image.Image, error) {
+	return nil, ErrNoCodec
+}
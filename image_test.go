@@ -36,10 +36,10 @@ func TestImage(t *testing.T) {
 	assert.Equal(t, 5642, int(im.Attr.Size))
 
 	var buf bytes.Buffer
-	var n int
-	n, err = im.SaveTo(&buf, &WriteOption{Format: "jpeg", Quality: 84})
+	var out *Output
+	out, err = im.SaveTo(&buf, &WriteOption{Format: "jpeg", Quality: 84})
 	assert.NoError(t, err)
-	assert.NotZero(t, n)
+	assert.NotZero(t, out.Size)
 
 	assert.Equal(t, int(jpegSize), buf.Len())
 
@@ -52,6 +52,44 @@ func TestImage(t *testing.T) {
 	assert.Equal(t, ".jpg", a.Ext)
 }
 
+func TestProbe(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(jpegData)
+	assert.NoError(t, err)
+
+	attr, err := Probe(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, jpegWidth, attr.Width)
+	assert.Equal(t, jpegHeight, attr.Height)
+	assert.Equal(t, ".jpg", attr.Ext)
+	assert.Equal(t, "image/jpeg", attr.Mime)
+	assert.Equal(t, jpegQuality, attr.Quality)
+	assert.Equal(t, len(data), int(attr.Size))
+
+	attr, err = ProbeWith(bytes.NewReader(jpegWithOrientation(t, 40, 20, OrientRotate270)), &ReadOption{AutoOrient: true})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(20), attr.Width)
+	assert.Equal(t, uint32(40), attr.Height)
+
+	_, err = Probe(bytes.NewReader(pngBomb(t)))
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+}
+
+func TestOpenLazy(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(jpegData)
+	assert.NoError(t, err)
+
+	im, err := OpenWith(bytes.NewReader(data), &ReadOption{Lazy: true})
+	assert.NoError(t, err)
+	assert.Nil(t, im.m)
+	assert.Equal(t, jpegWidth, im.Width)
+
+	var buf bytes.Buffer
+	_, err = im.ThumbnailTo(&buf, &ThumbOption{Width: 60, Height: 60, IsFit: true})
+	assert.NoError(t, err)
+	assert.NotNil(t, im.m)
+	assert.NotZero(t, buf.Len())
+}
+
 const (
 	jpegWidth   = uint32(124)
 	jpegHeight  = uint32(144)
@@ -1,19 +1,98 @@
-//go:build cgo
-// +build cgo
+//go:build cgo && libwebp
+// +build cgo,libwebp
 
 package image
 
+/*
+#cgo pkg-config: libwebp
+#include <webp/encode.h>
+
+// imagi_webp_encode 以 libwebp 的高级接口编码 RGBA, 成功时返回的数据由调用者以 WebPFree 释放
+static uint8_t *imagi_webp_encode(const uint8_t *rgba, int width, int height, int stride,
+	float quality, int lossless, int exact, int method, int near_lossless, int alpha_quality, size_t *size) {
+	WebPConfig config;
+	WebPPicture pic;
+	WebPMemoryWriter wrt;
+	int ok;
+
+	if (!WebPConfigPreset(&config, WEBP_PRESET_DEFAULT, quality) || !WebPPictureInit(&pic)) {
+		return NULL;
+	}
+	config.lossless = lossless;
+	config.exact = exact;
+	config.method = method;
+	config.near_lossless = near_lossless;
+	config.alpha_quality = alpha_quality;
+	if (!WebPValidateConfig(&config)) {
+		return NULL;
+	}
+
+	pic.use_argb = lossless;
+	pic.width = width;
+	pic.height = height;
+	pic.writer = WebPMemoryWrite;
+	pic.custom_ptr = &wrt;
+	WebPMemoryWriterInit(&wrt);
+
+	ok = WebPPictureImportRGBA(&pic, rgba, stride) && WebPEncode(&config, &pic);
+	WebPPictureFree(&pic);
+	if (!ok) {
+		WebPMemoryWriterClear(&wrt);
+		return NULL;
+	}
+	*size = wrt.size;
+	return wrt.mem;
+}
+*/
+import "C"
+
 import (
+	"errors"
 	"image"
+	"image/draw"
 	"io"
-
-	"github.com/chai2010/webp"
+	"unsafe"
 )
 
-const (
-	WebpEncodable = true
-)
+var errWebpEncode = errors.New("webp: encode fail")
+
+func webpEncode(w io.Writer, m image.Image, qlt float32, o *WebPOption) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	if b.Dx() > webpMaxSize || b.Dy() > webpMaxSize {
+		return ErrImageTooLarge
+	}
+	var lossless, exact bool
+	nearLossless, alphaQuality := 100, 100
+	if o != nil {
+		lossless = o.lossless(m)
+		exact = o.Exact
+		if o.NearLossless > 0 && o.NearLossless < 100 {
+			nearLossless = o.NearLossless
+		}
+		if o.AlphaQuality > 0 && o.AlphaQuality < 100 {
+			alphaQuality = o.AlphaQuality
+		}
+	}
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Rect, m, b.Min, draw.Src)
+
+	var size C.size_t
+	out := C.imagi_webp_encode((*C.uint8_t)(unsafe.Pointer(&src.Pix[0])), C.int(b.Dx()), C.int(b.Dy()), C.int(src.Stride),
+		C.float(qlt), cBool(lossless), cBool(exact), C.int(o.method()), C.int(nearLossless), C.int(alphaQuality), &size)
+	if out == nil {
+		return errWebpEncode
+	}
+	defer C.WebPFree(unsafe.Pointer(out))
+	_, err := w.Write(C.GoBytes(unsafe.Pointer(out), C.int(size)))
+	return err
+}
 
-func webpEncode(w io.Writer, m image.Image, qlt float32) error {
-	return webp.Encode(w, m, &webp.Options{Quality: qlt})
+func cBool(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
 }
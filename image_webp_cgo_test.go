@@ -0,0 +1,6 @@
+//go:build cgo && libwebp
+// +build cgo,libwebp
+
+package image
+
+const webpNewSize = 2206 // libwebp 1.4.0 编码 x/image/webp 解码的结果
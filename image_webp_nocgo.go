@@ -1,5 +1,5 @@
-//go:build !cgo
-// +build !cgo
+//go:build !cgo || !libwebp
+// +build !cgo !libwebp
 
 package image
 
@@ -7,18 +7,13 @@ import (
 	"errors"
 	"image"
 	"io"
-
-	_ "golang.org/x/image/webp" // ok
-)
-
-const (
-	WebpEncodable = false
 )
 
 var (
+	// Deprecated: 没有 libwebp 时使用纯 Go 的编码器, 不再返回此错误
 	ErrUnsupportEncodeWebP = errors.New("unsupported encode webP")
 )
 
-func webpEncode(w io.Writer, m image.Image, qlt float32) error {
-	return ErrUnsupportEncodeWebP
+func webpEncode(w io.Writer, m image.Image, qlt float32, o *WebPOption) error {
+	return encodeWebP(w, m, qlt, o)
 }
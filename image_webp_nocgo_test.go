@@ -0,0 +1,6 @@
+//go:build !cgo || !libwebp
+// +build !cgo !libwebp
+
+package image
+
+const webpNewSize = webpOrgSize // 纯 Go 的编码结果比原图大, 复制原图
@@ -0,0 +1,215 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+)
+
+// Limits 解码限制, 为 0 的项不限制
+type Limits struct {
+	MaxWidth  uint   // 最大宽度
+	MaxHeight uint   // 最大高度
+	MaxPixels uint64 // 最大像素数 (宽 x 高), 动画为所有帧之和
+	MaxBytes  int64  // 最大输入字节数
+	MaxFrames int    // 动画最大帧数
+}
+
+// DefaultLimits 未指定 ReadOption.Limits 时使用
+var DefaultLimits = Limits{
+	MaxPixels: 100_000_000, // 100 MP, RGBA 约 400 MB
+	MaxBytes:  256 << 20,   // 同时限制容器中声明的块长度
+	MaxFrames: 1000,
+}
+
+func (ropt *ReadOption) limits() *Limits {
+	if ropt == nil || ropt.Limits == nil {
+		return &DefaultLimits
+	}
+	return ropt.Limits
+}
+
+// Check 检查图像尺寸
+func (l *Limits) Check(cfg image.Config) error {
+	w, h := uint(cfg.Width), uint(cfg.Height)
+	if (l.MaxWidth > 0 && w > l.MaxWidth) || (l.MaxHeight > 0 && h > l.MaxHeight) ||
+		(l.MaxPixels > 0 && uint64(w)*uint64(h) > l.MaxPixels) {
+		slog.Info("image too large", "width", w, "height", h)
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
+// checkFrames 检查动画帧数及全部帧的像素数
+func (l *Limits) checkFrames(n int, cfg image.Config) error {
+	if (l.MaxFrames > 0 && n > l.MaxFrames) ||
+		(l.MaxPixels > 0 && n > 1 && uint64(cfg.Width)*uint64(cfg.Height)*uint64(n) > l.MaxPixels) {
+		slog.Info("too many frames", "frames", n, "width", cfg.Width, "height", cfg.Height)
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
+// limitReader 读取超过 n 字节时返回 ErrImageTooLarge
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.n <= 0 {
+		// 恰好读完时不报错
+		var b [1]byte
+		if n, _ := lr.r.Read(b[:]); n == 0 {
+			return 0, io.EOF
+		}
+		return 0, ErrImageTooLarge
+	}
+	if int64(len(p)) > lr.n {
+		p = p[:lr.n]
+	}
+	n, err := lr.r.Read(p)
+	lr.n -= int64(n)
+	return n, err
+}
+
+func (l *Limits) reader(r io.Reader) io.Reader {
+	if l.MaxBytes > 0 {
+		return &limitReader{r: r, n: l.MaxBytes}
+	}
+	return r
+}
+
+// decodeLimited 先用 DecodeConfig 检查尺寸, 再完整解码, 动画只解码第一帧
+func decodeLimited(r io.Reader, l *Limits) (image.Image, string, error) {
+	m, _, format, err := decodeFrames(r, &ReadOption{Limits: l}, false)
+	return m, format, err
+}
+
+// decodeFrames 与 decodeLimited 相同, all 为真时读取动画的全部帧, TIFF 读取 ropt.Page 页
+func decodeFrames(r io.Reader, ropt *ReadOption, all bool) (image.Image, *Animation, string, error) {
+	l := ropt.limits()
+	r = l.reader(r)
+	var head bytes.Buffer
+	cfg, format, err := decodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, nil, format, err
+	}
+	if err = l.Check(cfg); err != nil {
+		return nil, nil, format, err
+	}
+	r = io.MultiReader(&head, r)
+	if format == FormatTIFF {
+		var page int
+		if ropt != nil {
+			page = ropt.Page
+		}
+		m, err := decodeTIFFPage(r, page, l)
+		return m, nil, format, err
+	}
+	if format == FormatJPEG && cfg.ColorModel == color.CMYKModel {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, format, err
+		}
+		m, err := decodeCMYK(data)
+		return m, nil, format, err
+	}
+	if format == FormatGIF && (all || l.MaxFrames > 0) {
+		var data []byte
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, nil, format, err
+		}
+		n := countGIFFrames(bytes.NewReader(data))
+		if err = l.checkFrames(n, cfg); err != nil {
+			return nil, nil, format, err
+		}
+		if all && n > 1 {
+			a, err := decodeGIFAnimation(bytes.NewReader(data))
+			if err != nil {
+				return nil, nil, format, err
+			}
+			return a.First(), a, format, nil
+		}
+		r = bytes.NewReader(data)
+	}
+	if format == FormatWEBP && isWebpAnimated(head.Bytes()) {
+		chunks, err := readRiffChunks(r, l.MaxBytes)
+		if err != nil {
+			return nil, nil, format, err
+		}
+		if err = l.checkFrames(countWebpFrames(chunks), cfg); err != nil {
+			return nil, nil, format, err
+		}
+		max := 1
+		if all {
+			max = 0
+		}
+		a, err := decodeWebpAnimation(chunks, max, l)
+		if err != nil {
+			return nil, nil, format, err
+		}
+		if len(a.Frames) < 2 {
+			return a.First(), nil, format, nil
+		}
+		return a.First(), a, format, nil
+	}
+	m, _, err := image.Decode(r)
+	return m, nil, format, err
+}
+
+// countGIFFrames 只扫描 GIF 的块结构, 不解码像素, 出错时返回已数到的帧数
+func countGIFFrames(r io.Reader) (n int) {
+	br := bufio.NewReader(r)
+	var hdr [13]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return
+	}
+	if hdr[10]&0x80 != 0 { // global color table
+		if _, err := br.Discard(3 << (1 + hdr[10]&0x07)); err != nil {
+			return
+		}
+	}
+	skipBlocks := func() error {
+		for {
+			size, err := br.ReadByte()
+			if err != nil || size == 0 {
+				return err
+			}
+			if _, err = br.Discard(int(size)); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+		switch c {
+		case 0x21: // extension
+			if _, err = br.ReadByte(); err != nil || skipBlocks() != nil {
+				return
+			}
+		case 0x2c: // image descriptor
+			var desc [9]byte
+			if _, err = io.ReadFull(br, desc[:]); err != nil {
+				return
+			}
+			if desc[8]&0x80 != 0 { // local color table
+				if _, err = br.Discard(3 << (1 + desc[8]&0x07)); err != nil {
+					return
+				}
+			}
+			n++
+			if _, err = br.ReadByte(); err != nil || skipBlocks() != nil { // LZW min code size
+				return
+			}
+		default: // trailer
+			return
+		}
+	}
+}
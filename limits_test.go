@@ -0,0 +1,146 @@
+package image
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pngBomb a tiny png claims to be 60000x60000
+func pngBomb(t *testing.T) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	assert.NoError(t, err)
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 60000)
+	binary.BigEndian.PutUint32(data[20:], 60000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestLimits(t *testing.T) {
+	bomb := pngBomb(t)
+
+	_, err := Open(bytes.NewReader(bomb))
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+
+	var buf bytes.Buffer
+	_, err = Thumbnail(bytes.NewReader(bomb), &buf, &ThumbOption{Width: 60, Height: 60})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+
+	water, _ := base64.StdEncoding.DecodeString(pngWatermarkData)
+	err = Watermark(bytes.NewReader(bomb), bytes.NewReader(water), &buf, WaterOption{})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+
+	data, _ := base64.StdEncoding.DecodeString(jpegData)
+	_, err = OpenWith(bytes.NewReader(data), &ReadOption{Limits: &Limits{MaxWidth: 100}})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+	_, err = OpenWith(bytes.NewReader(data), &ReadOption{Limits: &Limits{MaxBytes: 1024}})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+	_, err = OpenWith(bytes.NewReader(data), &ReadOption{Limits: &Limits{MaxBytes: int64(len(data))}})
+	assert.NoError(t, err)
+}
+
+func TestLimitFrames(t *testing.T) {
+	g := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 8, 8), palette.Plan9))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, g)
+	assert.NoError(t, err)
+	data := buf.Bytes()
+
+	assert.Equal(t, 3, countGIFFrames(bytes.NewReader(data)))
+
+	_, err = OpenWith(bytes.NewReader(data), &ReadOption{Limits: &Limits{MaxFrames: 2}})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+	_, err = OpenWith(bytes.NewReader(data), &ReadOption{Limits: &Limits{MaxFrames: 3}})
+	assert.NoError(t, err)
+}
+
+// webpChunkBomb a 38-byte animated webp whose ALPH chunk claims 1.5 GB
+func webpChunkBomb() []byte {
+	data := []byte("RIFF\x1e\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00")
+	data = append(data, vp8xAnimation|vp8xAlpha, 0, 0, 0, 7, 0, 0, 7, 0, 0)
+	data = append(data, "ALPH"...)
+	return binary.LittleEndian.AppendUint32(data, 0x60000000)
+}
+
+func TestWebpChunkBomb(t *testing.T) {
+	bomb := webpChunkBomb()
+	assert.Len(t, bomb, 38)
+
+	_, err := Probe(bytes.NewReader(bomb))
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+	_, err = Open(bytes.NewReader(bomb))
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+	_, err = ReadMetadata(bytes.NewReader(bomb))
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+}
+
+// webpFrameBomb an animated webp with a canvas of cw x ch and one 400x400 VP8L frame declared as fw x fh in ANMF
+func webpFrameBomb(cw, ch, fw, fh int) []byte {
+	vp8x := make([]byte, 10)
+	vp8x[0] = vp8xAnimation
+	putUint24(vp8x[4:], uint32(cw-1))
+	putUint24(vp8x[7:], uint32(ch-1))
+	anmf := make([]byte, 16)
+	putUint24(anmf[6:], uint32(fw-1))
+	putUint24(anmf[9:], uint32(fh-1))
+	anmf = appendChunks(anmf, riffChunk{fourcc: "VP8L", data: encodeVP8L(image.NewNRGBA(image.Rect(0, 0, 400, 400)), 4, true)})
+	return writeRiffChunks([]riffChunk{{fourcc: "VP8X", data: vp8x}, {fourcc: "ANIM", data: make([]byte, 6)}, {fourcc: "ANMF", data: anmf}})
+}
+
+func TestWebpFrameBomb(t *testing.T) {
+	ropt := &ReadOption{Limits: &Limits{MaxPixels: 100}}
+	// 帧的位流尺寸与 ANMF 不同
+	bomb := webpFrameBomb(1, 1, 1, 1)
+	assert.Less(t, len(bomb), 200)
+	_, err := OpenWith(bytes.NewReader(bomb), ropt)
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+	// 帧超出画布
+	_, err = OpenWith(bytes.NewReader(webpFrameBomb(1, 1, 400, 400)), ropt)
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+	// 帧与画布相同时受 Limits 限制
+	_, err = OpenWith(bytes.NewReader(webpFrameBomb(400, 400, 400, 400)), &ReadOption{Limits: &Limits{MaxPixels: 160_000}})
+	assert.NoError(t, err)
+	_, err = decodeWebpAnimation(mustRiffChunks(t, webpFrameBomb(400, 400, 400, 400)), 0, &Limits{MaxPixels: 100})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+}
+
+func mustRiffChunks(t *testing.T, data []byte) []riffChunk {
+	chunks, err := readRiffChunks(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	return chunks
+}
+
+func TestCraftedBombs(t *testing.T) {
+	// PNG 的 iCCP 块声明 2 GB
+	pngChunk := append([]byte(nil), pngSignature...)
+	pngChunk = append(pngChunk, "\x7f\xff\xff\xffiCCP"...)
+	// HEIF 的 meta box 声明 2 GB
+	heifMeta := []byte("\x00\x00\x00\x10ftypheic\x00\x00\x00\x00\x7f\xff\xff\xffmeta")
+
+	for name, bomb := range map[string][]byte{"png": pngChunk, "heif": heifMeta, "webp": webpChunkBomb()} {
+		_, err := Probe(bytes.NewReader(bomb))
+		assert.Error(t, err, name)
+		_, err = Open(bytes.NewReader(bomb))
+		assert.Error(t, err, name)
+		_, err = ReadMetadata(bytes.NewReader(bomb))
+		assert.Error(t, err, name)
+	}
+
+	_, err := ProbeWith(bytes.NewReader(pngBomb(t)), &ReadOption{Limits: &Limits{MaxBytes: 16}})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+	assert.NotZero(t, DefaultLimits.MaxBytes)
+}
@@ -0,0 +1,101 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"log/slog"
+	"math"
+)
+
+const (
+	defaultMinQuality = 10
+	minDownscaleSize  = 16 // 缩小时宽高的下限
+)
+
+// searchable 是否可以按质量查找, 只用于 JPEG 及 WebP
+func (o *WriteOption) searchable() bool {
+	return o.Format == FormatJPEG || o.Format == FormatWEBP
+}
+
+// qualityRange 查找的质量范围, Quality 为上限
+func (o *WriteOption) qualityRange() (lo, hi int) {
+	hi = int(o.Quality)
+	if hi == 0 {
+		hi = 100
+	}
+	lo = int(o.MinQuality)
+	if lo == 0 {
+		lo = defaultMinQuality
+	}
+	return min(lo, hi), hi
+}
+
+// saveMaxBytes 查找不超过 opt.MaxBytes 的最高质量并写入 w, 返回写入的图像;
+// 最低质量仍超过时, 按 Downscale 缩小图像后重新查找, 否则返回 ErrOverMaxBytes
+func saveMaxBytes(w io.Writer, m image.Image, opt *WriteOption, md *Metadata) (image.Image, error) {
+	lo, hi := opt.qualityRange()
+	for {
+		data, q, err := searchQuality(m, opt, md, lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= opt.MaxBytes {
+			slog.Debug("max bytes", "quality", q, "bytes", len(data), "size", m.Bounds().Size())
+			opt.finalQuality = uint8(q)
+			_, err = w.Write(data)
+			return m, err
+		}
+		if !opt.Downscale {
+			return nil, ErrOverMaxBytes
+		}
+		// 按面积与字节数大致成正比估算, 每次缩小 10% 到 50%
+		f := math.Sqrt(float64(opt.MaxBytes) / float64(len(data)))
+		f = max(0.5, min(0.9, f))
+		b := m.Bounds()
+		nw, nh := int(float64(b.Dx())*f), int(float64(b.Dy())*f)
+		if nw < minDownscaleSize || nh < minDownscaleSize {
+			return nil, ErrOverMaxBytes
+		}
+		m = matchDepth(m, Resize(m, nw, nh, FilterCatmullRom))
+	}
+}
+
+// searchQuality 二分查找 [lo, hi] 中不超过 MaxBytes 的最高质量, 返回编码结果及质量;
+// 都超过时返回 lo 的结果
+func searchQuality(m image.Image, opt *WriteOption, md *Metadata, lo, hi int) ([]byte, int, error) {
+	o := *opt
+	enc := func(q int) ([]byte, error) {
+		o.Quality = uint8(q)
+		var buf bytes.Buffer
+		if err := encode(&buf, m, &o); err != nil {
+			return nil, err
+		}
+		return embedMeta(o.Format, buf.Bytes(), md)
+	}
+	data, err := enc(hi)
+	if err != nil || len(data) <= opt.MaxBytes || lo == hi {
+		return data, hi, err
+	}
+	var best, lowest []byte
+	bestQ := lo
+	for l, r := lo, hi-1; l <= r; {
+		mid := (l + r) / 2
+		if data, err = enc(mid); err != nil {
+			return nil, 0, err
+		}
+		if len(data) <= opt.MaxBytes {
+			best, bestQ = data, mid
+			l = mid + 1
+		} else {
+			if mid == lo {
+				lowest = data
+			}
+			r = mid - 1
+		}
+	}
+	if best == nil {
+		return lowest, lo, nil
+	}
+	return best, bestQ, nil
+}
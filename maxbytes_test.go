@@ -0,0 +1,83 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxBytes(t *testing.T) {
+	src := photo(300, 200)
+	for _, format := range []string{FormatJPEG, FormatWEBP} {
+		var q50, q60 bytes.Buffer
+		_, err := SaveTo(&q50, src, &WriteOption{Format: format, Quality: 50})
+		assert.NoError(t, err)
+		_, err = SaveTo(&q60, src, &WriteOption{Format: format, Quality: 60})
+		assert.NoError(t, err)
+		assert.Greater(t, q60.Len(), q50.Len(), format)
+
+		opt := &WriteOption{Format: format, MaxBytes: q50.Len()}
+		var buf bytes.Buffer
+		out, err := SaveTo(&buf, src, opt)
+		assert.NoError(t, err, format)
+		assert.LessOrEqual(t, buf.Len(), q50.Len())
+		assert.GreaterOrEqual(t, int(out.Quality), 50, format)
+		assert.Less(t, int(out.Quality), 60, format)
+		assert.Zero(t, opt.Quality)
+
+		// Quality 为上限
+		opt = &WriteOption{Format: format, Quality: 30, MaxBytes: 1 << 20}
+		buf.Reset()
+		out, err = SaveTo(&buf, src, opt)
+		assert.NoError(t, err)
+		assert.Equal(t, 30, int(out.Quality))
+	}
+
+	// 最低质量仍超过
+	var buf bytes.Buffer
+	opt := &WriteOption{Format: FormatJPEG, MaxBytes: 1500, MinQuality: 40}
+	_, err := SaveTo(&buf, src, opt)
+	assert.Equal(t, ErrOverMaxBytes, err)
+	assert.Zero(t, buf.Len())
+
+	opt.Downscale = true
+	out, err := SaveTo(&buf, src, opt)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, buf.Len(), 1500)
+	assert.GreaterOrEqual(t, int(out.Quality), 40)
+	cfg, _, err := image.DecodeConfig(&buf)
+	assert.NoError(t, err)
+	assert.Less(t, cfg.Width, 300)
+	assert.InDelta(t, 1.5, float64(cfg.Width)/float64(cfg.Height), 0.05)
+
+	// 元数据计入字节数
+	opt = &WriteOption{Format: FormatJPEG, MaxBytes: 8000, KeepMeta: MetaAll, Metadata: &Metadata{XMP: bytes.Repeat([]byte("x"), 4000)}}
+	buf.Reset()
+	_, err = SaveTo(&buf, src, opt)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, buf.Len(), 8000)
+	got, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+	if assert.NoError(t, err) {
+		assert.Len(t, got.XMP, 4000)
+	}
+
+	// 缩略图
+	topt := &ThumbOption{Width: 120, Height: 80, WriteOption: WriteOption{Format: FormatJPEG, MaxBytes: 3000}}
+	buf.Reset()
+	out, err = ThumbnailImageTo(src, &buf, topt)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, buf.Len(), 3000)
+	assert.NotZero(t, out.Quality)
+
+	// 动画不支持
+	a, err := decodeGIFAnimation(bytes.NewReader(gifAnimation(t)))
+	assert.NoError(t, err)
+	for _, o := range []WriteOption{{Format: FormatWEBP, MaxBytes: 3000}, {Format: FormatGIF, AutoQuality: 0.95}} {
+		buf.Reset()
+		_, err = SaveAnimationTo(&buf, a, &o)
+		assert.ErrorIs(t, err, ErrInvalidOption)
+		assert.Zero(t, buf.Len())
+	}
+}
@@ -0,0 +1,193 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"regexp"
+)
+
+// MetaFlag 元数据类别
+type MetaFlag uint8
+
+// MetaFlag
+const (
+	MetaExif MetaFlag = 1 << iota // EXIF
+	MetaICC                       // ICC profile
+	MetaXMP                       // XMP packet
+	MetaText                      // PNG tEXt/iTXt/zTXt, JPEG COM
+
+	MetaNone MetaFlag = 0
+	MetaAll           = MetaExif | MetaICC | MetaXMP | MetaText
+)
+
+// TextEntry 文本元数据
+type TextEntry struct {
+	Key   string
+	Value string
+}
+
+// Metadata 与格式无关的元数据块
+type Metadata struct {
+	Exif []byte // TIFF 结构, 不含 "Exif\0\0" 头
+	ICC  []byte // ICC profile
+	XMP  []byte // XMP packet
+	Text []TextEntry
+}
+
+// IsEmpty ...
+func (md *Metadata) IsEmpty() bool {
+	return md == nil || (len(md.Exif) == 0 && len(md.ICC) == 0 && len(md.XMP) == 0 && len(md.Text) == 0)
+}
+
+// Select 返回只包含指定类别的副本, 为空时返回 nil
+func (md *Metadata) Select(flag MetaFlag) *Metadata {
+	if md == nil || flag == MetaNone {
+		return nil
+	}
+	out := new(Metadata)
+	if flag&MetaExif != 0 {
+		out.Exif = bytes.Clone(md.Exif)
+	}
+	if flag&MetaICC != 0 {
+		out.ICC = bytes.Clone(md.ICC)
+	}
+	if flag&MetaXMP != 0 {
+		out.XMP = bytes.Clone(md.XMP)
+	}
+	if flag&MetaText != 0 && len(md.Text) > 0 {
+		out.Text = append([]TextEntry(nil), md.Text...)
+	}
+	if out.IsEmpty() {
+		return nil
+	}
+	return out
+}
+
+// resetOrientation 图像已经按方向旋转过后, 把 EXIF 中的 Orientation 置为 1
+func (md *Metadata) resetOrientation() {
+	if md != nil && len(md.Exif) > 0 {
+		exifSetOrientation(md.Exif, OrientNormal)
+	}
+}
+
+var (
+	xmpGPSAttr = regexp.MustCompile(`\s[\w.-]+:GPS\w*\s*=\s*("[^"]*"|'[^']*')`)
+	xmpGPSElem = regexp.MustCompile(`<[\w.-]+:GPS\w*`)
+)
+
+// scrubXMPGPS 移除 XMP 中的 exif:GPS* 属性及元素, 无法确定已全部移除时返回 nil
+func scrubXMPGPS(b []byte) []byte {
+	b = xmpGPSAttr.ReplaceAll(b, nil)
+	for {
+		loc := xmpGPSElem.FindIndex(b)
+		if loc == nil {
+			break
+		}
+		end := bytes.IndexByte(b[loc[1]:], '>')
+		if end < 0 {
+			return nil
+		}
+		end += loc[1] + 1
+		if b[end-2] != '/' {
+			closing := []byte("</" + string(b[loc[0]+1:loc[1]]) + ">")
+			i := bytes.Index(b[end:], closing)
+			if i < 0 {
+				return nil
+			}
+			end += i + len(closing)
+		}
+		b = append(b[:loc[0]], b[end:]...)
+	}
+	if bytes.Contains(b, []byte(":GPS")) {
+		return nil
+	}
+	return b
+}
+
+// ReadMetadata 读取 JPEG, PNG, WebP, AVIF 或 HEIC 中的元数据, 输入大小受 DefaultLimits.MaxBytes 限制
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	return readMetadata(DefaultLimits.reader(r), DefaultLimits.MaxBytes)
+}
+
+// readMetadata 与 ReadMetadata 相同, max 为输入的最大字节数
+func readMetadata(r io.Reader, max int64) (*Metadata, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(12)
+	if err != nil && len(magic) < 8 {
+		return nil, err
+	}
+	md := new(Metadata)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0xff, markerSOI}):
+		err = readJPEGMeta(br, md)
+	case bytes.HasPrefix(magic, pngSignature):
+		err = readPNGMeta(br, md)
+	case len(magic) >= 12 && string(magic[:4]) == "RIFF" && string(magic[8:12]) == "WEBP":
+		err = readWebpMeta(br, md, max)
+	case string(magic[4:8]) == "ftyp":
+		err = readHEIFMeta(br, md)
+	default:
+		return nil, ErrUnsupportFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// embedMeta 把元数据写入已编码的图像数据
+func embedMeta(format string, data []byte, md *Metadata) ([]byte, error) {
+	if md.IsEmpty() {
+		return data, nil
+	}
+	switch format {
+	case FormatJPEG:
+		return embedJPEGMeta(data, md)
+	case FormatPNG:
+		return embedPNGMeta(data, md)
+	case FormatWEBP:
+		return embedWebpMeta(data, md)
+	default:
+		slog.Debug("metadata not supported", "format", format)
+		return data, nil
+	}
+}
+
+// replaceMeta 去掉原有的元数据, 再写入 md
+func replaceMeta(format string, data []byte, md *Metadata) ([]byte, error) {
+	var err error
+	switch format {
+	case FormatJPEG:
+		data, err = stripJPEGMeta(data)
+	case FormatPNG:
+		data, err = stripPNGMeta(data)
+	case FormatWEBP:
+		data, err = stripWebpMeta(data)
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return embedMeta(format, data, md)
+}
+
+// readMetaWith 读取全部数据并解析元数据, 返回可以再次读取的 reader
+func readMetaWith(r io.Reader, ropt *ReadOption) (io.Reader, *Metadata, error) {
+	data, err := io.ReadAll(ropt.limits().reader(r))
+	if err != nil {
+		return nil, nil, err
+	}
+	md, err := readMetadata(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		slog.Debug("read metadata fail", "err", err)
+		md = nil
+	}
+	// decodeWith 只旋转 JPEG, 其他格式的像素未旋转, 保留方向
+	if ropt != nil && ropt.AutoOrient && bytes.HasPrefix(data, []byte{0xff, markerSOI}) {
+		md.resetOrientation()
+	}
+	return bytes.NewReader(data), md, nil
+}
@@ -0,0 +1,39 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// readHEIFMeta 读取 AVIF 或 HEIC 中主图的 EXIF, XMP 及 ICC profile;
+// 方向以 irot/imir 为准, 解码时已经应用, 所以 EXIF 中的 Orientation 置为 1
+func readHEIFMeta(r io.Reader, md *Metadata) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	h, err := readHEIF(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	md.ICC = h.icc
+	if h.exif != 0 {
+		b, err := h.itemData(data, h.exif)
+		if err != nil {
+			return err
+		}
+		// 前 4 字节为到 TIFF 头的偏移, 一般跳过 "Exif\0\0"
+		if len(b) < 4 || uint64(binary.BigEndian.Uint32(b)) > uint64(len(b)-4) {
+			return ErrInvalidFormat
+		}
+		md.Exif = b[4+binary.BigEndian.Uint32(b):]
+		md.resetOrientation()
+	}
+	if h.xmp != 0 {
+		if md.XMP, err = h.itemData(data, h.xmp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// JPEG markers
+const (
+	markerSOI   = 0xd8
+	markerEOI   = 0xd9
+	markerSOS   = 0xda
+	markerAPP0  = 0xe0
+	markerAPP1  = 0xe1
+	markerAPP2  = 0xe2
+	markerAPP13 = 0xed
+	markerCOM   = 0xfe
+)
+
+const (
+	jpegMaxSegment = 0xffff - 2 // payload
+	iccChunkMax    = jpegMaxSegment - 14
+)
+
+var (
+	xmpHeader    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	iccHeader    = []byte("ICC_PROFILE\x00")
+)
+
+// readJPEGSegments 依次读取 JPEG 文件头部的段, 直到 SOS 或 fn 返回 false
+func readJPEGSegments(r io.Reader, fn func(marker byte, payload []byte) bool) error {
+	br := bufio.NewReader(r)
+	var hdr [2]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[0] != 0xff || hdr[1] != markerSOI {
+		return ErrInvalidFormat
+	}
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c != 0xff {
+			return ErrInvalidFormat
+		}
+		marker, err := br.ReadByte()
+		for err == nil && marker == 0xff { // fill bytes
+			marker, err = br.ReadByte()
+		}
+		if err != nil {
+			return err
+		}
+		if marker == markerSOS || marker == markerEOI {
+			return nil
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) { // TEM, RSTn
+			continue
+		}
+		if _, err = io.ReadFull(br, hdr[:]); err != nil {
+			return err
+		}
+		n := int(binary.BigEndian.Uint16(hdr[:])) - 2
+		if n < 0 {
+			return ErrInvalidFormat
+		}
+		payload := make([]byte, n)
+		if _, err = io.ReadFull(br, payload); err != nil {
+			return err
+		}
+		if !fn(marker, payload) {
+			return nil
+		}
+	}
+}
+
+// readJPEGExif 返回 APP1 中的 EXIF(TIFF) 数据, 不含 "Exif\0\0" 头
+func readJPEGExif(r io.Reader) (exif []byte, err error) {
+	err = readJPEGSegments(r, func(marker byte, payload []byte) bool {
+		if marker == markerAPP1 && bytes.HasPrefix(payload, exifHeader) {
+			exif = payload[len(exifHeader):]
+			return false
+		}
+		return true
+	})
+	return
+}
+
+func readJPEGMeta(r io.Reader, md *Metadata) error {
+	var icc [][]byte
+	err := readJPEGSegments(r, func(marker byte, payload []byte) bool {
+		switch {
+		case marker == markerAPP1 && bytes.HasPrefix(payload, exifHeader):
+			if md.Exif == nil {
+				md.Exif = payload[len(exifHeader):]
+			}
+		case marker == markerAPP1 && bytes.HasPrefix(payload, xmpHeader):
+			if md.XMP == nil {
+				md.XMP = payload[len(xmpHeader):]
+			}
+		case marker == markerAPP2 && bytes.HasPrefix(payload, iccHeader) && len(payload) > len(iccHeader)+2:
+			// seq_no (1-based), number of chunks
+			seq, total := int(payload[len(iccHeader)]), int(payload[len(iccHeader)+1])
+			if seq == 0 || seq > total {
+				break
+			}
+			if icc == nil {
+				icc = make([][]byte, total)
+			}
+			if seq <= len(icc) {
+				icc[seq-1] = payload[len(iccHeader)+2:]
+			}
+		case marker == markerCOM && len(payload) > 0:
+			md.Text = append(md.Text, TextEntry{Key: "Comment", Value: string(payload)})
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, chunk := range icc {
+		if chunk == nil { // incomplete
+			return nil
+		}
+	}
+	if len(icc) > 0 {
+		md.ICC = bytes.Join(icc, nil)
+	}
+	return nil
+}
+
+func appendJPEGSegment(b []byte, marker byte, parts ...[]byte) []byte {
+	n := 2
+	for _, p := range parts {
+		n += len(p)
+	}
+	b = append(b, 0xff, marker)
+	b = binary.BigEndian.AppendUint16(b, uint16(n))
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// embedJPEGMeta 在 SOI (及 JFIF APP0) 之后插入元数据段
+func embedJPEGMeta(data []byte, md *Metadata) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, ErrInvalidFormat
+	}
+	pos := 2
+	if data[pos] == 0xff && data[pos+1] == markerAPP0 && len(data) > pos+4 {
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+	}
+
+	out := make([]byte, 0, len(data)+len(md.Exif)+len(md.ICC)+len(md.XMP)+64)
+	out = append(out, data[:pos]...)
+	if len(md.Exif) > 0 {
+		if len(exifHeader)+len(md.Exif) > jpegMaxSegment {
+			slog.Info("exif too large, skipped", "size", len(md.Exif))
+		} else {
+			out = appendJPEGSegment(out, markerAPP1, exifHeader, md.Exif)
+		}
+	}
+	if len(md.XMP) > 0 {
+		if len(xmpHeader)+len(md.XMP) > jpegMaxSegment {
+			slog.Info("xmp too large, skipped", "size", len(md.XMP))
+		} else {
+			out = appendJPEGSegment(out, markerAPP1, xmpHeader, md.XMP)
+		}
+	}
+	if len(md.ICC) > 0 {
+		total := (len(md.ICC) + iccChunkMax - 1) / iccChunkMax
+		if total > 255 {
+			slog.Info("icc profile too large, skipped", "size", len(md.ICC))
+		} else {
+			for i := 0; i < total; i++ {
+				chunk := md.ICC[i*iccChunkMax : min((i+1)*iccChunkMax, len(md.ICC))]
+				out = appendJPEGSegment(out, markerAPP2, iccHeader, []byte{byte(i + 1), byte(total)}, chunk)
+			}
+		}
+	}
+	for _, t := range md.Text {
+		s := t.Value
+		if !strings.EqualFold(t.Key, "Comment") {
+			s = t.Key + ": " + t.Value
+		}
+		if len(s) > jpegMaxSegment {
+			s = s[:jpegMaxSegment]
+		}
+		out = appendJPEGSegment(out, markerCOM, []byte(s))
+	}
+	return append(out, data[pos:]...), nil
+}
+
+// stripJPEGMeta 移除 SOS 之前的 EXIF, XMP (含扩展 XMP), ICC, Photoshop IRB (IPTC) 及注释段
+func stripJPEGMeta(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, ErrInvalidFormat
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return nil, ErrInvalidFormat
+		}
+		marker := data[pos+1]
+		if marker == markerSOS || marker == markerEOI {
+			break
+		}
+		if marker == 0xff { // fill byte
+			out = append(out, data[pos])
+			pos++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) { // TEM, RSTn
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return nil, ErrInvalidFormat
+		}
+		payload := data[pos+4 : end]
+		switch {
+		case marker == markerAPP1 && (bytes.HasPrefix(payload, exifHeader) || bytes.HasPrefix(payload, xmpHeader) ||
+			bytes.HasPrefix(payload, xmpExtHeader)):
+		case marker == markerAPP13:
+		case marker == markerAPP2 && bytes.HasPrefix(payload, iccHeader):
+		case marker == markerCOM:
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return append(out, data[pos:]...), nil
+}
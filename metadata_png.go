@@ -0,0 +1,218 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	pngXMPKeyword = "XML:com.adobe.xmp"
+	pngICCName    = "ICC Profile"
+	pngMaxChunk   = 1 << 24 // 元数据块的上限
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// readPNGChunks 依次读取 PNG 的块, 直到 IEND 或 fn 返回 false; IDAT 的数据不读入内存
+func readPNGChunks(r io.Reader, fn func(typ string, data []byte) bool) error {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(hdr[:], pngSignature) {
+		return ErrInvalidFormat
+	}
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return err
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		if typ == "IEND" {
+			return nil
+		}
+		if typ == "IDAT" || n > pngMaxChunk {
+			if _, err := io.CopyN(io.Discard, r, n+4); err != nil {
+				return err
+			}
+			continue
+		}
+		data := make([]byte, n+4) // with crc
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if !fn(typ, data[:n]) {
+			return nil
+		}
+	}
+}
+
+func zlibInflate(b []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, pngMaxChunk))
+}
+
+func zlibDeflate(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, _ = zw.Write(b)
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func readPNGMeta(r io.Reader, md *Metadata) error {
+	return readPNGChunks(r, func(typ string, data []byte) bool {
+		switch typ {
+		case "eXIf":
+			md.Exif = data
+		case "iCCP":
+			// name, 0, compression method, zlib data
+			if i := bytes.IndexByte(data, 0); i > 0 && i+2 <= len(data) {
+				if icc, err := zlibInflate(data[i+2:]); err == nil {
+					md.ICC = icc
+				}
+			}
+		case "tEXt":
+			if i := bytes.IndexByte(data, 0); i > 0 {
+				md.Text = append(md.Text, TextEntry{Key: string(data[:i]), Value: latin1(data[i+1:])})
+			}
+		case "zTXt":
+			if i := bytes.IndexByte(data, 0); i > 0 && i+2 <= len(data) {
+				if v, err := zlibInflate(data[i+2:]); err == nil {
+					md.Text = append(md.Text, TextEntry{Key: string(data[:i]), Value: latin1(v)})
+				}
+			}
+		case "iTXt":
+			key, value, ok := parseITXt(data)
+			if !ok {
+				break
+			}
+			if key == pngXMPKeyword {
+				md.XMP = []byte(value)
+			} else {
+				md.Text = append(md.Text, TextEntry{Key: key, Value: value})
+			}
+		}
+		return true
+	})
+}
+
+// parseITXt keyword, 0, flag, method, language, 0, translated keyword, 0, text
+func parseITXt(data []byte) (key, value string, ok bool) {
+	i := bytes.IndexByte(data, 0)
+	if i <= 0 || i+3 > len(data) {
+		return
+	}
+	key = string(data[:i])
+	compressed := data[i+1] == 1
+	rest := data[i+3:]
+	for n := 0; n < 2; n++ { // language tag, translated keyword
+		j := bytes.IndexByte(rest, 0)
+		if j < 0 {
+			return
+		}
+		rest = rest[j+1:]
+	}
+	if compressed {
+		v, err := zlibInflate(rest)
+		if err != nil {
+			return
+		}
+		rest = v
+	}
+	return key, string(rest), true
+}
+
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func appendPNGChunk(b []byte, typ string, parts ...[]byte) []byte {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(n))
+	start := len(b)
+	b = append(b, typ...)
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[start:]))
+}
+
+// embedPNGMeta 在 IHDR 之后插入元数据块
+func embedPNGMeta(data []byte, md *Metadata) ([]byte, error) {
+	const ihdrEnd = 8 + 8 + 13 + 4
+	if len(data) < ihdrEnd || !bytes.Equal(data[:8], pngSignature) || string(data[12:16]) != "IHDR" {
+		return nil, ErrInvalidFormat
+	}
+
+	out := make([]byte, 0, len(data)+len(md.Exif)+len(md.ICC)+len(md.XMP)+64)
+	out = append(out, data[:ihdrEnd]...)
+	if len(md.ICC) > 0 {
+		out = appendPNGChunk(out, "iCCP", []byte(pngICCName), []byte{0, 0}, zlibDeflate(md.ICC))
+	}
+	if len(md.Exif) > 0 {
+		out = appendPNGChunk(out, "eXIf", md.Exif)
+	}
+	if len(md.XMP) > 0 {
+		out = appendPNGChunk(out, "iTXt", []byte(pngXMPKeyword), []byte{0, 0, 0, 0, 0}, md.XMP)
+	}
+	for _, t := range md.Text {
+		if len(t.Key) == 0 || len(t.Key) > 79 {
+			continue
+		}
+		if isASCII(t.Value) {
+			out = appendPNGChunk(out, "tEXt", []byte(t.Key), []byte{0}, []byte(t.Value))
+		} else {
+			out = appendPNGChunk(out, "iTXt", []byte(t.Key), []byte{0, 0, 0, 0, 0}, []byte(t.Value))
+		}
+	}
+	return append(out, data[ihdrEnd:]...), nil
+}
+
+// stripPNGMeta 移除 iCCP, eXIf 及文本块
+func stripPNGMeta(data []byte) ([]byte, error) {
+	if len(data) < 8 || !bytes.Equal(data[:8], pngSignature) {
+		return nil, ErrInvalidFormat
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:8]...)
+	pos := 8
+	for pos+12 <= len(data) {
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) {
+			return nil, ErrInvalidFormat
+		}
+		switch string(data[pos+4 : pos+8]) {
+		case "iCCP", "eXIf", "tEXt", "zTXt", "iTXt":
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return append(out, data[pos:]...), nil
+}
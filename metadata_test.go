@@ -0,0 +1,259 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadata(t *testing.T) {
+	icc := bytes.Repeat([]byte("icc-"), 20000) // more than one APP2 segment
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`)
+	data, err := embedJPEGMeta(jpegWithOrientation(t, 40, 20, OrientRotate90), &Metadata{ICC: icc, XMP: xmp})
+	assert.NoError(t, err)
+
+	md, err := ReadMetadata(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, icc, md.ICC)
+	assert.Equal(t, xmp, md.XMP)
+	assert.Equal(t, OrientRotate90, exifOrientation(md.Exif))
+
+	im, err := OpenWith(bytes.NewReader(data), &ReadOption{AutoOrient: true})
+	assert.NoError(t, err)
+
+	for _, format := range []string{FormatJPEG, FormatPNG, FormatWEBP} {
+		var buf bytes.Buffer
+		_, err = im.SaveTo(&buf, &WriteOption{Format: format, KeepMeta: MetaAll})
+		assert.NoError(t, err)
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err, format)
+		assert.Equal(t, 20, cfg.Width, format)
+
+		out, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err, format)
+		assert.Equal(t, icc, out.ICC, format)
+		assert.Equal(t, xmp, out.XMP, format)
+		assert.Equal(t, OrientNormal, exifOrientation(out.Exif), format)
+
+		buf.Reset()
+		_, err = im.SaveTo(&buf, &WriteOption{Format: format, KeepMeta: MetaICC})
+		assert.NoError(t, err)
+		out, err = ReadMetadata(bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err, format)
+		assert.Equal(t, icc, out.ICC, format)
+		assert.Nil(t, out.Exif, format)
+		assert.Nil(t, out.XMP, format)
+	}
+
+	var buf bytes.Buffer
+	topt := &ThumbOption{Width: 10, Height: 10, IsFit: true}
+	topt.Format = FormatPNG
+	topt.KeepMeta = MetaICC | MetaText
+	topt.Metadata = &Metadata{ICC: icc, Text: []TextEntry{{Key: "Copyright", Value: "© imagi"}}}
+	_, err = Thumbnail(bytes.NewReader(data), &buf, topt)
+	assert.NoError(t, err)
+	out, err := ReadMetadata(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, icc, out.ICC)
+	assert.Equal(t, []TextEntry{{Key: "Copyright", Value: "© imagi"}}, out.Text)
+}
+
+func testExif(order binary.ByteOrder) []byte {
+	app := order.(binary.AppendByteOrder)
+	short := func(v uint16) []byte { return app.AppendUint16(nil, v) }
+	ascii := func(s string) exifEntry {
+		return exifEntry{typ: 2, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+	}
+	entry := func(tag uint16, e exifEntry) exifEntry { e.tag = tag; return e }
+	ed := &exifData{
+		order: order,
+		ifd0: &exifIFD{entries: []exifEntry{
+			{tag: exifTagOrientation, typ: 3, count: 1, value: short(6)},
+			entry(exifTagArtist, ascii("John Doe")),
+			entry(0x8298, ascii("(c) imagi")), // Copyright
+			{tag: exifTagExifIFD, typ: 4, count: 1, value: make([]byte, 4), sub: &exifIFD{entries: []exifEntry{
+				entry(exifTagMakerNote, ascii("maker private data")),
+				entry(exifTagBodySerialNumber, ascii("SN12345678")),
+			}}},
+			{tag: exifTagGPSIFD, typ: 4, count: 1, value: make([]byte, 4), sub: &exifIFD{entries: []exifEntry{
+				entry(1, ascii("N")), // GPSLatitudeRef
+			}}},
+		}},
+		ifd1: &exifIFD{
+			entries: []exifEntry{
+				{tag: exifTagThumbOffset, typ: 4, count: 1, value: make([]byte, 4)},
+				{tag: exifTagThumbLength, typ: 4, count: 1, value: app.AppendUint32(nil, 4)},
+			},
+			thumb: []byte{0xff, 0xd8, 0xff, 0xd9},
+		},
+	}
+	return ed.encode()
+}
+
+func exifTags(ifd *exifIFD) (tags []uint16) {
+	if ifd == nil {
+		return
+	}
+	for _, e := range ifd.entries {
+		tags = append(tags, e.tag)
+		tags = append(tags, exifTags(e.sub)...)
+	}
+	return
+}
+
+func TestScrubExif(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		exif := testExif(order)
+		ed, err := parseExif(exif)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint16{exifTagOrientation, exifTagArtist, 0x8298, exifTagExifIFD,
+			exifTagMakerNote, exifTagBodySerialNumber, exifTagGPSIFD, 1}, exifTags(ed.ifd0))
+		assert.NotNil(t, ed.ifd1)
+		assert.Equal(t, []byte{0xff, 0xd8, 0xff, 0xd9}, ed.ifd1.thumb)
+
+		out, err := ScrubExif(exif, ScrubGPS|ScrubThumbnail)
+		assert.NoError(t, err)
+		ed, err = parseExif(out)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint16{exifTagOrientation, exifTagArtist, 0x8298, exifTagExifIFD,
+			exifTagMakerNote, exifTagBodySerialNumber}, exifTags(ed.ifd0))
+		assert.Nil(t, ed.ifd1)
+
+		out, err = ScrubExif(exif, ScrubPrivacy)
+		assert.NoError(t, err)
+		ed, err = parseExif(out)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint16{exifTagOrientation, 0x8298, exifTagExifIFD}, exifTags(ed.ifd0))
+		assert.Equal(t, OrientRotate90, exifOrientation(out))
+		assert.Contains(t, string(out), "(c) imagi")
+	}
+}
+
+func TestScrubPassthrough(t *testing.T) {
+	icc := []byte("fake icc profile")
+	data, err := embedJPEGMeta(jpegWithOrientation(t, 40, 20, OrientNormal),
+		&Metadata{ICC: icc, Exif: testExif(binary.BigEndian), Text: []TextEntry{{Key: "Comment", Value: "hi"}}})
+	assert.NoError(t, err)
+
+	im, err := Open(bytes.NewReader(data))
+	assert.NoError(t, err)
+	opt := &WriteOption{KeepMeta: MetaICC | MetaExif, Scrub: ScrubPrivacy, Metadata: im.Metadata()}
+	var buf bytes.Buffer
+	_, err = im.copyTo(&buf, opt)
+	assert.NoError(t, err)
+
+	out, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, icc, out.ICC)
+	assert.Nil(t, out.Text)
+	assert.NotContains(t, string(out.Exif), "John Doe")
+	assert.NotContains(t, string(out.Exif), "SN12345678")
+	assert.Contains(t, string(out.Exif), "(c) imagi")
+
+	_, err = jpeg.Decode(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+}
+
+func TestPassthroughKeepsMeta(t *testing.T) {
+	icc := []byte("fake icc profile")
+	data, err := embedJPEGMeta(jpegWithOrientation(t, 40, 20, OrientRotate90), &Metadata{ICC: icc})
+	assert.NoError(t, err)
+
+	im, err := Open(bytes.NewReader(data))
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = im.copyTo(&buf, &WriteOption{})
+	assert.NoError(t, err)
+	assert.Equal(t, data, buf.Bytes())
+
+	md, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, icc, md.ICC)
+	assert.Equal(t, OrientRotate90, ReadOrientation(bytes.NewReader(buf.Bytes())))
+}
+
+func TestMetadataOptionReuse(t *testing.T) {
+	a, err := Open(bytes.NewReader(jpegWithOrientation(t, 40, 20, OrientRotate90)))
+	assert.NoError(t, err)
+	var plain bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&plain, image.NewGray(image.Rect(0, 0, 30, 20)), nil))
+	b, err := Open(bytes.NewReader(plain.Bytes()))
+	assert.NoError(t, err)
+
+	opt := &WriteOption{Format: FormatPNG, KeepMeta: MetaAll}
+	var buf bytes.Buffer
+	_, err = a.SaveTo(&buf, opt)
+	assert.NoError(t, err)
+	assert.Nil(t, opt.Metadata)
+	buf.Reset()
+	_, err = b.SaveTo(&buf, opt)
+	assert.NoError(t, err)
+	out, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Nil(t, out.Exif)
+
+	topt := &ThumbOption{Width: 10, Height: 10, IsFit: true}
+	topt.KeepMeta = MetaAll
+	buf.Reset()
+	_, err = a.ThumbnailTo(&buf, topt)
+	assert.NoError(t, err)
+	assert.Nil(t, topt.Metadata)
+	assert.Empty(t, topt.Format)
+	buf.Reset()
+	_, err = Thumbnail(bytes.NewReader(jpegWithOrientation(t, 40, 20, OrientRotate90)), &buf, topt)
+	assert.NoError(t, err)
+	assert.Nil(t, topt.Metadata)
+	buf.Reset()
+	_, err = Thumbnail(bytes.NewReader(plain.Bytes()), &buf, topt)
+	assert.NoError(t, err)
+	out, err = ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Nil(t, out.Exif)
+}
+
+func TestStripJPEGMeta(t *testing.T) {
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF><rdf:Description exif:GPSLatitude="31,14.1N" ` +
+		`exif:GPSLongitude='121,28.3E' dc:format="image/jpeg"><exif:GPSAltitude>12/1</exif:GPSAltitude>` +
+		`<exif:GPSVersionID/><dc:title>hi</dc:title></rdf:Description></rdf:RDF></x:xmpmeta>`)
+	data, err := embedJPEGMeta(jpegWithOrientation(t, 40, 20, OrientNormal), &Metadata{XMP: xmp})
+	assert.NoError(t, err)
+	// Photoshop IRB (IPTC) 及扩展 XMP
+	var extra []byte
+	extra = appendJPEGSegment(extra, markerAPP13, []byte("Photoshop 3.0\x008BIM\x04\x04location"))
+	extra = appendJPEGSegment(extra, markerAPP1, xmpExtHeader, []byte("exif:GPSLatitude"))
+	data = append(data[:2:2], append(extra, data[2:]...)...)
+
+	im, err := Open(bytes.NewReader(data))
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = im.copyTo(&buf, &WriteOption{Scrub: ScrubPrivacy, Metadata: im.Metadata()})
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "8BIM")
+	assert.NotContains(t, buf.String(), "GPS")
+	assert.NotContains(t, buf.String(), "dc:title")
+	_, err = jpeg.Decode(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+
+	// SOS 之前单独的 TEM 及 RST 标记
+	marked := append(data[:2:2], append([]byte{0xff, 0x01, 0xff, 0xd3}, data[2:]...)...)
+	stripped, err := stripJPEGMeta(marked)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xff, markerSOI, 0xff, 0x01, 0xff, 0xd3}, stripped[:6])
+	assert.NotContains(t, string(stripped), "8BIM")
+
+	buf.Reset()
+	_, err = im.copyTo(&buf, &WriteOption{KeepMeta: MetaXMP, Scrub: ScrubGPS, Metadata: im.Metadata()})
+	assert.NoError(t, err)
+	out, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF><rdf:Description dc:format="image/jpeg">`+
+		`<dc:title>hi</dc:title></rdf:Description></rdf:RDF></x:xmpmeta>`, string(out.XMP))
+	assert.NotContains(t, buf.String(), "GPS")
+
+	// 无法解析的 GPS 元素时丢弃整个 XMP
+	assert.Nil(t, scrubXMPGPS([]byte(`<exif:GPSAltitude>12/1</exif:GPSAltitude >`)))
+}
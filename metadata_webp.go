@@ -0,0 +1,217 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// VP8X flags
+const (
+	vp8xAnimation = 0x02
+	vp8xXMP       = 0x04
+	vp8xExif      = 0x08
+	vp8xAlpha     = 0x10
+	vp8xICC       = 0x20
+)
+
+type riffChunk struct {
+	fourcc string
+	data   []byte
+}
+
+// readRiffChunks 读取 WebP 文件中的全部块, max 为文件的最大字节数, 0 为不限制
+func readRiffChunks(r io.Reader, max int64) ([]riffChunk, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if string(hdr[:4]) != "RIFF" || string(hdr[8:12]) != "WEBP" {
+		return nil, ErrInvalidFormat
+	}
+	size := int64(binary.LittleEndian.Uint32(hdr[4:8])) - 4
+	if max > 0 && size > max-12 {
+		size = max - 12
+	}
+	return readChunks(io.LimitReader(r, size), size)
+}
+
+// readChunks 读取连续的 RIFF 块, 块长度超过剩余的 size 字节时返回 ErrInvalidFormat
+func readChunks(lr io.Reader, size int64) ([]riffChunk, error) {
+	var hdr [8]byte
+	var chunks []riffChunk
+	for {
+		_, err := io.ReadFull(lr, hdr[:8])
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		size -= 8
+		n := int(binary.LittleEndian.Uint32(hdr[4:8]))
+		if int64(n) > size {
+			return nil, ErrInvalidFormat
+		}
+		size -= int64(n + n&1)
+		data := make([]byte, n)
+		if _, err = io.ReadFull(lr, data); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, riffChunk{fourcc: string(hdr[:4]), data: data})
+		if n&1 == 1 {
+			_, _ = io.ReadFull(lr, hdr[:1]) // pad byte
+		}
+	}
+}
+
+// writeRiffChunks 把块拼装为 WebP 文件
+func writeRiffChunks(chunks []riffChunk) []byte {
+	size := 4
+	for _, c := range chunks {
+		size += 8 + len(c.data) + len(c.data)&1
+	}
+	out := make([]byte, 0, size+8)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(size))
+	out = append(out, "WEBP"...)
+	return appendChunks(out, chunks...)
+}
+
+func appendChunks(out []byte, chunks ...riffChunk) []byte {
+	for _, c := range chunks {
+		out = append(out, c.fourcc...)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(c.data)))
+		out = append(out, c.data...)
+		if len(c.data)&1 == 1 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+func readWebpMeta(r io.Reader, md *Metadata, max int64) error {
+	chunks, err := readRiffChunks(r, max)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		switch c.fourcc {
+		case "EXIF":
+			md.Exif = c.data
+		case "ICCP":
+			md.ICC = c.data
+		case "XMP ":
+			md.XMP = c.data
+		}
+	}
+	return nil
+}
+
+// webpCanvas 从位流头部解析画布大小及是否有透明通道
+func webpCanvas(chunks []riffChunk) (w, h int, alpha, ok bool) {
+	for _, c := range chunks {
+		switch c.fourcc {
+		case "VP8X":
+			if len(c.data) >= 10 {
+				w = 1 + int(uint32(c.data[4])|uint32(c.data[5])<<8|uint32(c.data[6])<<16)
+				h = 1 + int(uint32(c.data[7])|uint32(c.data[8])<<8|uint32(c.data[9])<<16)
+				return w, h, c.data[0]&vp8xAlpha != 0, true
+			}
+		case "ALPH":
+			alpha = true
+		case "VP8 ":
+			// frame tag(3), start code(3), width(2), height(2)
+			if len(c.data) >= 10 {
+				w = int(binary.LittleEndian.Uint16(c.data[6:]) & 0x3fff)
+				h = int(binary.LittleEndian.Uint16(c.data[8:]) & 0x3fff)
+				return w, h, alpha, true
+			}
+		case "VP8L":
+			// signature(1), width-1(14), height-1(14), alpha(1), version(3)
+			if len(c.data) >= 5 && c.data[0] == 0x2f {
+				bits := binary.LittleEndian.Uint32(c.data[1:])
+				w = 1 + int(bits&0x3fff)
+				h = 1 + int((bits>>14)&0x3fff)
+				return w, h, (bits>>28)&1 == 1, true
+			}
+		}
+	}
+	return
+}
+
+// embedWebpMeta 转换为 VP8X 扩展格式并写入 ICCP/EXIF/XMP 块
+func embedWebpMeta(data []byte, md *Metadata) ([]byte, error) {
+	chunks, err := readRiffChunks(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	w, h, alpha, ok := webpCanvas(chunks)
+	if !ok {
+		return nil, ErrInvalidFormat
+	}
+
+	var flags byte
+	var body []riffChunk
+	for _, c := range chunks {
+		switch c.fourcc {
+		case "VP8X":
+			flags = c.data[0] &^ (vp8xICC | vp8xExif | vp8xXMP)
+		case "ICCP", "EXIF", "XMP ":
+		default:
+			body = append(body, c)
+		}
+	}
+	if alpha {
+		flags |= vp8xAlpha
+	}
+
+	out := []riffChunk{{fourcc: "VP8X"}}
+	if len(md.ICC) > 0 {
+		flags |= vp8xICC
+		out = append(out, riffChunk{fourcc: "ICCP", data: md.ICC})
+	}
+	out = append(out, body...)
+	if len(md.Exif) > 0 {
+		flags |= vp8xExif
+		out = append(out, riffChunk{fourcc: "EXIF", data: md.Exif})
+	}
+	if len(md.XMP) > 0 {
+		flags |= vp8xXMP
+		out = append(out, riffChunk{fourcc: "XMP ", data: md.XMP})
+	}
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = flags
+	putUint24(vp8x[4:], uint32(w-1))
+	putUint24(vp8x[7:], uint32(h-1))
+	out[0].data = vp8x
+	return writeRiffChunks(out), nil
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// stripWebpMeta 移除 ICCP, EXIF 及 XMP 块
+func stripWebpMeta(data []byte) ([]byte, error) {
+	chunks, err := readRiffChunks(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].fourcc != "VP8X" || len(chunks[0].data) < 10 {
+		return data, nil // simple format
+	}
+	out := chunks[:0]
+	for _, c := range chunks {
+		switch c.fourcc {
+		case "ICCP", "EXIF", "XMP ":
+		case "VP8X":
+			c.data[0] &^= vp8xICC | vp8xExif | vp8xXMP
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return writeRiffChunks(out), nil
+}
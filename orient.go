@@ -0,0 +1,130 @@
+package image
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Orientation EXIF 中的方向值
+type Orientation uint8
+
+// Orientation, 值为显示时需要做的变换
+const (
+	OrientNormal     Orientation = iota + 1 // 1 不变
+	OrientFlipH                             // 2 水平翻转
+	OrientRotate180                         // 3 旋转 180°
+	OrientFlipV                             // 4 垂直翻转
+	OrientTranspose                         // 5 沿主对角线翻转
+	OrientRotate90                          // 6 顺时针旋转 90°
+	OrientTransverse                        // 7 沿副对角线翻转
+	OrientRotate270                         // 8 顺时针旋转 270°
+)
+
+// Swapped 变换后宽高是否互换
+func (o Orientation) Swapped() bool {
+	return o >= OrientTranspose && o <= OrientRotate270
+}
+
+// Orient 按 EXIF Orientation 旋转或翻转图像, 结果的原点为 (0, 0)
+func Orient(m image.Image, o Orientation) image.Image {
+	if o <= OrientNormal || o > OrientRotate270 {
+		return m
+	}
+	src, spix, sstride, bpp := pixelsOf(m)
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+	dw, dh := w, h
+	if o.Swapped() {
+		dw, dh = h, w
+	}
+	dst := newImageLike(src, image.Rect(0, 0, dw, dh))
+	_, dpix, dstride, _ := pixelsOf(dst)
+
+	var sx, sy int
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			switch o {
+			case OrientFlipH:
+				sx, sy = w-1-dx, dy
+			case OrientRotate180:
+				sx, sy = w-1-dx, h-1-dy
+			case OrientFlipV:
+				sx, sy = dx, h-1-dy
+			case OrientTranspose:
+				sx, sy = dy, dx
+			case OrientRotate90:
+				sx, sy = dy, h-1-dx
+			case OrientTransverse:
+				sx, sy = w-1-dy, h-1-dx
+			case OrientRotate270:
+				sx, sy = w-1-dy, dx
+			}
+			si := sy*sstride + sx*bpp
+			di := dy*dstride + dx*bpp
+			copy(dpix[di:di+bpp], spix[si:si+bpp])
+		}
+	}
+	return dst
+}
+
+// pixelsOf 返回可按字节直接操作的图像及其像素, 其他类型先转换为 RGBA
+func pixelsOf(m image.Image) (img draw.Image, pix []uint8, stride, bpp int) {
+	switch p := m.(type) {
+	case *image.RGBA:
+		return p, p.Pix, p.Stride, 4
+	case *image.NRGBA:
+		return p, p.Pix, p.Stride, 4
+	case *image.RGBA64:
+		return p, p.Pix, p.Stride, 8
+	case *image.NRGBA64:
+		return p, p.Pix, p.Stride, 8
+	case *image.Gray:
+		return p, p.Pix, p.Stride, 1
+	case *image.Gray16:
+		return p, p.Pix, p.Stride, 2
+	}
+	b := m.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), m, b.Min, draw.Src)
+	return dst, dst.Pix, dst.Stride, 4
+}
+
+// isDeep 是否为每通道 16 位的图像
+func isDeep(m image.Image) bool {
+	switch m.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// matchDepth 来源不是 16 位时, 把处理成 16 位的结果 (如 resize 的通用路径) 转回 8 位
+func matchDepth(src, m image.Image) image.Image {
+	if isDeep(src) || !isDeep(m) {
+		return m
+	}
+	b := m.Bounds()
+	var dst draw.Image = image.NewRGBA(b)
+	if _, ok := m.(*image.Gray16); ok {
+		dst = image.NewGray(b)
+	}
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	return dst
+}
+
+// newImageLike 创建与 m 像素格式相同的空白图像
+func newImageLike(m image.Image, r image.Rectangle) draw.Image {
+	switch m.(type) {
+	case *image.NRGBA:
+		return image.NewNRGBA(r)
+	case *image.RGBA64:
+		return image.NewRGBA64(r)
+	case *image.NRGBA64:
+		return image.NewNRGBA64(r)
+	case *image.Gray:
+		return image.NewGray(r)
+	case *image.Gray16:
+		return image.NewGray16(r)
+	}
+	return image.NewRGBA(r)
+}
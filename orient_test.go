@@ -0,0 +1,113 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrient(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			m.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+
+	cases := []struct {
+		o      Orientation
+		w, h   int
+		x0, y0 uint8 // source of the top-left pixel
+	}{
+		{OrientNormal, 3, 2, 0, 0},
+		{OrientFlipH, 3, 2, 2, 0},
+		{OrientRotate180, 3, 2, 2, 1},
+		{OrientFlipV, 3, 2, 0, 1},
+		{OrientTranspose, 2, 3, 0, 0},
+		{OrientRotate90, 2, 3, 0, 1},
+		{OrientTransverse, 2, 3, 2, 1},
+		{OrientRotate270, 2, 3, 2, 0},
+	}
+	for _, c := range cases {
+		r := Orient(m, c.o)
+		assert.Equal(t, c.w, r.Bounds().Dx(), "orient %d", c.o)
+		assert.Equal(t, c.h, r.Bounds().Dy(), "orient %d", c.o)
+		px := r.At(0, 0).(color.NRGBA)
+		assert.Equal(t, c.x0, px.R, "orient %d", c.o)
+		assert.Equal(t, c.y0, px.G, "orient %d", c.o)
+	}
+}
+
+func TestOpenAutoOrient(t *testing.T) {
+	data := jpegWithOrientation(t, 40, 20, OrientRotate90)
+	assert.Equal(t, OrientRotate90, ReadOrientation(bytes.NewReader(data)))
+
+	im, err := Open(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(40), im.Width)
+	assert.Equal(t, uint32(20), im.Height)
+
+	im, err = OpenWith(bytes.NewReader(data), &ReadOption{AutoOrient: true})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(20), im.Width)
+	assert.Equal(t, uint32(40), im.Height)
+
+	var buf bytes.Buffer
+	topt := &ThumbOption{Width: 10, Height: 10, IsFit: true, ReadOption: ReadOption{AutoOrient: true}}
+	_, err = Thumbnail(bytes.NewReader(data), &buf, topt)
+	assert.NoError(t, err)
+	cfg, err := jpeg.DecodeConfig(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, cfg.Width)
+	assert.Equal(t, 10, cfg.Height)
+
+	// 只有 JPEG 会旋转, 其他格式保留原来的方向
+	exif, err := readJPEGExif(bytes.NewReader(data))
+	assert.NoError(t, err)
+	var png bytes.Buffer
+	_, err = SaveTo(&png, image.NewGray(image.Rect(0, 0, 40, 20)), &WriteOption{Format: FormatPNG, Metadata: &Metadata{Exif: exif}, KeepMeta: MetaExif})
+	assert.NoError(t, err)
+	cases := []struct {
+		src  []byte
+		want Orientation
+	}{{data, OrientNormal}, {png.Bytes(), OrientRotate90}}
+	for _, c := range cases {
+		buf.Reset()
+		topt = &ThumbOption{Width: 10, Height: 10, IsFit: true, ReadOption: ReadOption{AutoOrient: true}}
+		topt.KeepMeta = MetaExif
+		_, err = Thumbnail(bytes.NewReader(c.src), &buf, topt)
+		assert.NoError(t, err)
+		md, err := ReadMetadata(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, exifOrientation(md.Exif))
+	}
+}
+
+// jpegWithOrientation encode a jpeg with an APP1 EXIF segment contains orientation
+func jpegWithOrientation(t *testing.T, w, h int, o Orientation) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil)
+	assert.NoError(t, err)
+	data := buf.Bytes()
+
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1}
+	tiff = binary.BigEndian.AppendUint16(tiff, exifTagOrientation)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(o))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	payload := append(append([]byte{}, exifHeader...), tiff...)
+
+	seg := []byte{0xff, markerAPP1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(payload)+2))
+	seg = append(seg, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, seg...)
+	return append(out, data[2:]...)
+}
@@ -0,0 +1,82 @@
+package image
+
+import (
+	"image"
+)
+
+// Passthrough 输出为原图数据的原因
+type Passthrough uint8
+
+// consts
+const (
+	PassNone   Passthrough = iota // 重新编码
+	PassLarger                    // 重新编码后比原图大, 复制原图
+)
+
+func (p Passthrough) String() string {
+	if p == PassLarger {
+		return "larger"
+	}
+	return "none"
+}
+
+// Output 写入的结果, 由 SaveTo, SaveAnimationTo, Image.SaveTo 及缩略图函数返回.
+// Size 为写入的字节数, Quality 为编码实际使用的质量, 按 MaxBytes 或 AutoQuality 查找时为查找到的质量,
+// 无损的格式为 0; 复制原图时为原图的属性
+type Output struct {
+	Attr
+	Format      string
+	Passthrough Passthrough
+}
+
+// Passed 是否复制了原图
+func (o *Output) Passed() bool {
+	return o.Passthrough != PassNone
+}
+
+func newOutput(w, h int, format string, quality uint8, n int) *Output {
+	out := &Output{Attr: *newAttrWith(uint(w), uint(h), format, n), Format: format}
+	out.Quality = quality
+	return out
+}
+
+// imageOutput 编码 m 的结果
+func imageOutput(m image.Image, opt *WriteOption, n int) *Output {
+	b := m.Bounds()
+	return newOutput(b.Dx(), b.Dy(), opt.Format, opt.quality(m), n)
+}
+
+// passOutput 复制原图的结果
+func passOutput(attr *Attr, format string, reason Passthrough, n int) *Output {
+	out := &Output{Attr: *attr, Format: format, Passthrough: reason}
+	out.Size = uint32(n)
+	return out
+}
+
+// quality 编码 m 实际使用的质量, 无损时为 0
+func (o *WriteOption) quality(m image.Image) uint8 {
+	if o.searchable() && (o.AutoQuality > 0 || o.MaxBytes > 0) {
+		return o.finalQuality
+	}
+	var def uint8
+	switch o.Format {
+	case FormatJPEG:
+		def = MinJPEGQuality
+	case FormatWEBP:
+		if wo, _ := optionOf[WebPOption](o, FormatWEBP); wo.lossless(m) {
+			return 0
+		}
+		def = MinWebpQuality
+	case FormatAVIF:
+		if ao, _ := optionOf[AVIFOption](o, FormatAVIF); ao != nil && ao.Lossless {
+			return 0
+		}
+		def = MinAVIFQuality
+	default:
+		return 0
+	}
+	if o.Quality > 0 {
+		return min(o.Quality, 100)
+	}
+	return def
+}
@@ -0,0 +1,98 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutput(t *testing.T) {
+	src := photo(120, 80)
+	var buf bytes.Buffer
+	out, err := SaveTo(&buf, src, &WriteOption{Format: "png"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, out) {
+		assert.Equal(t, FormatPNG, out.Format)
+		assert.Equal(t, ".png", out.Ext)
+		assert.Equal(t, "image/png", out.Mime)
+		assert.Equal(t, 120, int(out.Width))
+		assert.Equal(t, 80, int(out.Height))
+		assert.Zero(t, out.Quality)
+		assert.Equal(t, buf.Len(), int(out.Size))
+		assert.False(t, out.Passed())
+	}
+
+	buf.Reset()
+	out, err = SaveTo(&buf, src, &WriteOption{Format: FormatJPEG})
+	assert.NoError(t, err)
+	assert.Equal(t, MinJPEGQuality, int(out.Quality))
+
+	// 缩小后的尺寸及查找到的质量
+	buf.Reset()
+	opt := &WriteOption{Format: FormatJPEG, MaxBytes: 1500, MinQuality: 40, Downscale: true}
+	out, err = SaveTo(&buf, photo(300, 200), opt)
+	assert.NoError(t, err)
+	assert.Less(t, int(out.Width), 300)
+	assert.GreaterOrEqual(t, int(out.Quality), 40)
+	assert.Equal(t, buf.Len(), int(out.Size))
+
+	a, err := decodeGIFAnimation(bytes.NewReader(gifAnimation(t)))
+	assert.NoError(t, err)
+	buf.Reset()
+	out, err = SaveAnimationTo(&buf, a, &WriteOption{Format: FormatGIF})
+	assert.NoError(t, err)
+	assert.True(t, out.Animated)
+	assert.Equal(t, 3, out.Frames)
+	assert.Equal(t, 40, int(out.Width))
+	assert.Equal(t, buf.Len(), int(out.Size))
+}
+
+func TestOutputPassthrough(t *testing.T) {
+	var orig bytes.Buffer
+	_, err := SaveTo(&orig, photo(120, 80), &WriteOption{Format: FormatJPEG, Quality: 30})
+	assert.NoError(t, err)
+
+	im, err := Open(bytes.NewReader(orig.Bytes()))
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	h := sha1.New()
+	out, err := im.SaveTo(&buf, &WriteOption{Format: FormatJPEG, Quality: 95, ExtraWriter: h})
+	assert.NoError(t, err)
+	assert.Equal(t, orig.Bytes(), buf.Bytes())
+	if assert.NotNil(t, out) {
+		assert.True(t, out.Passed())
+		assert.Equal(t, PassLarger, out.Passthrough)
+		assert.Equal(t, buf.Len(), int(out.Size))
+		assert.Equal(t, 30, int(out.Quality))
+		assert.Equal(t, 120, int(out.Width))
+	}
+	// ExtraWriter 收到的是实际写入的数据
+	sum := sha1.Sum(orig.Bytes())
+	assert.Equal(t, sum[:], h.Sum(nil))
+
+	buf.Reset()
+	h.Reset()
+	out, err = im.SaveTo(&buf, &WriteOption{Format: FormatPNG, ExtraWriter: h})
+	assert.NoError(t, err)
+	assert.Equal(t, PassNone, out.Passthrough)
+	assert.Equal(t, FormatPNG, out.Format)
+	sum = sha1.Sum(buf.Bytes())
+	assert.Equal(t, sum[:], h.Sum(nil))
+
+	// 缩略图
+	buf.Reset()
+	out, err = im.ThumbnailTo(&buf, &ThumbOption{Width: 60, Height: 60, IsFit: true})
+	assert.NoError(t, err)
+	assert.Equal(t, FormatJPEG, out.Format)
+	assert.Equal(t, 60, int(out.Width))
+	assert.Equal(t, 40, int(out.Height))
+	assert.Equal(t, buf.Len(), int(out.Size))
+
+	buf.Reset()
+	out, err = Thumbnail(bytes.NewReader(orig.Bytes()), &buf, &ThumbOption{Width: 60, Height: 60, IsFit: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 60, int(out.Width))
+	assert.Equal(t, buf.Len(), int(out.Size))
+}
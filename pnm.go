@@ -0,0 +1,425 @@
+package image
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Netpbm: PBM (P1/P4), PGM (P2/P5), PPM (P3/P6) 及 PAM (P7), 见 https://netpbm.sourceforge.net/doc/
+// 解码支持文本及二进制, 编码只输出二进制
+
+type pnmHeader struct {
+	magic  byte // '1' - '7'
+	width  int
+	height int
+	depth  int // 每像素的通道数
+	maxval int
+}
+
+// readPNMToken 跳过空白及注释, 读取一个不含空白的词, 并消耗其后的一个空白
+func readPNMToken(br *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF && sb.Len() > 0 {
+				return sb.String(), nil
+			}
+			return "", err
+		}
+		switch {
+		case c == '#' && sb.Len() == 0:
+			if _, err = br.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case isPNMSpace(c):
+			if sb.Len() > 0 {
+				return sb.String(), nil
+			}
+		default:
+			if sb.Len() > 16 {
+				return "", ErrInvalidFormat
+			}
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func isPNMSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func readPNMInt(br *bufio.Reader) (int, error) {
+	s, err := readPNMToken(br)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, ErrInvalidFormat
+	}
+	return v, nil
+}
+
+func readPNMHeader(br *bufio.Reader) (*pnmHeader, error) {
+	var magic [2]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '7' {
+		return nil, ErrInvalidFormat
+	}
+	h := &pnmHeader{magic: magic[1], depth: 1, maxval: 1}
+	var err error
+	switch h.magic {
+	case '7':
+		err = h.readPAM(br)
+	default:
+		if h.width, err = readPNMInt(br); err != nil {
+			return nil, err
+		}
+		if h.height, err = readPNMInt(br); err != nil {
+			return nil, err
+		}
+		if h.magic == '3' || h.magic == '6' {
+			h.depth = 3
+		}
+		if h.magic != '1' && h.magic != '4' {
+			h.maxval, err = readPNMInt(br)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h.width <= 0 || h.height <= 0 || h.maxval <= 0 || h.maxval > 0xffff || h.depth < 1 || h.depth > 4 ||
+		uint64(h.width)*uint64(h.height) > 1<<32 {
+		return nil, ErrInvalidFormat
+	}
+	return h, nil
+}
+
+// readPAM 读取 PAM 的头部, 直到 ENDHDR
+func (h *pnmHeader) readPAM(br *bufio.Reader) error {
+	h.depth = 0
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "ENDHDR" {
+			return nil
+		}
+		if len(fields) < 2 {
+			return ErrInvalidFormat
+		}
+		var v *int
+		switch fields[0] {
+		case "WIDTH":
+			v = &h.width
+		case "HEIGHT":
+			v = &h.height
+		case "DEPTH":
+			v = &h.depth
+		case "MAXVAL":
+			v = &h.maxval
+		default:
+			continue // TUPLTYPE 按 DEPTH 处理
+		}
+		if *v, err = strconv.Atoi(fields[1]); err != nil {
+			return ErrInvalidFormat
+		}
+	}
+}
+
+func (h *pnmHeader) deep() bool {
+	return h.maxval > 0xff
+}
+
+func (h *pnmHeader) colorModel() color.Model {
+	switch {
+	case h.depth <= 1 && h.deep():
+		return color.Gray16Model
+	case h.depth <= 1:
+		return color.GrayModel
+	case h.deep():
+		return color.NRGBA64Model
+	}
+	return color.NRGBAModel
+}
+
+func pnmDecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readPNMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+func pnmDecode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readPNMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	rect := image.Rect(0, 0, h.width, h.height)
+	var m image.Image
+	switch h.colorModel() {
+	case color.Gray16Model:
+		m = image.NewGray16(rect)
+	case color.GrayModel:
+		m = image.NewGray(rect)
+	case color.NRGBA64Model:
+		m = image.NewNRGBA64(rect)
+	default:
+		m = image.NewNRGBA(rect)
+	}
+	row := make([]int, h.width*h.depth)
+	for y := 0; y < h.height; y++ {
+		if err = h.readRow(br, row); err != nil {
+			return nil, err
+		}
+		h.setRow(m, y, row)
+	}
+	return m, nil
+}
+
+// readRow 读取一行的样本; PBM 的 1 为黑色, 转换为 0
+func (h *pnmHeader) readRow(br *bufio.Reader, row []int) error {
+	switch h.magic {
+	case '1':
+		for i := range row {
+			c, err := br.ReadByte()
+			for err == nil && (isPNMSpace(c) || c == '#') {
+				if c == '#' {
+					_, err = br.ReadString('\n')
+				}
+				if err == nil {
+					c, err = br.ReadByte()
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if c != '0' && c != '1' {
+				return ErrInvalidFormat
+			}
+			row[i] = int('1' - c)
+		}
+	case '2', '3':
+		for i := range row {
+			v, err := readPNMInt(br)
+			if err != nil {
+				return err
+			}
+			row[i] = min(v, h.maxval)
+		}
+	case '4':
+		buf := make([]byte, (h.width+7)/8)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return err
+		}
+		for i := range row {
+			row[i] = int(buf[i/8]>>(7-i%8)&1 ^ 1)
+		}
+	default:
+		size := 1
+		if h.deep() {
+			size = 2
+		}
+		buf := make([]byte, len(row)*size)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return err
+		}
+		for i := range row {
+			if size == 2 {
+				row[i] = int(binary.BigEndian.Uint16(buf[2*i:]))
+			} else {
+				row[i] = int(buf[i])
+			}
+			row[i] = min(row[i], h.maxval)
+		}
+	}
+	return nil
+}
+
+// setRow 按 maxval 把样本缩放到 8 或 16 位后写入第 y 行
+func (h *pnmHeader) setRow(m image.Image, y int, row []int) {
+	full := 0xff
+	if h.deep() {
+		full = 0xffff
+	}
+	scale := func(v int) int { return (v*full + h.maxval/2) / h.maxval }
+	// 每像素展开为 RGBA
+	rgba := func(x int) (r, g, b, a int) {
+		s := row[x*h.depth:]
+		switch h.depth {
+		case 1:
+			r, g, b, a = s[0], s[0], s[0], h.maxval
+		case 2:
+			r, g, b, a = s[0], s[0], s[0], s[1]
+		case 3:
+			r, g, b, a = s[0], s[1], s[2], h.maxval
+		default:
+			r, g, b, a = s[0], s[1], s[2], s[3]
+		}
+		return scale(r), scale(g), scale(b), scale(a)
+	}
+	switch m := m.(type) {
+	case *image.Gray:
+		for x, v := range row {
+			m.Pix[y*m.Stride+x] = uint8(scale(v))
+		}
+	case *image.Gray16:
+		for x, v := range row {
+			binary.BigEndian.PutUint16(m.Pix[y*m.Stride+2*x:], uint16(scale(v)))
+		}
+	case *image.NRGBA:
+		for x := 0; x < h.width; x++ {
+			r, g, b, a := rgba(x)
+			p := m.Pix[y*m.Stride+4*x:]
+			p[0], p[1], p[2], p[3] = uint8(r), uint8(g), uint8(b), uint8(a)
+		}
+	case *image.NRGBA64:
+		for x := 0; x < h.width; x++ {
+			r, g, b, a := rgba(x)
+			m.SetNRGBA64(x, y, color.NRGBA64{uint16(r), uint16(g), uint16(b), uint16(a)})
+		}
+	}
+}
+
+// pnmSource 把图像转换为灰度或 NRGBA, 16 位的图像保持 16 位
+func pnmSource(m image.Image, gray bool) image.Image {
+	b := m.Bounds()
+	var dst draw.Image
+	switch {
+	case gray && isDeep(m):
+		if _, ok := m.(*image.Gray16); ok {
+			return m
+		}
+		dst = image.NewGray16(b)
+	case gray:
+		if _, ok := m.(*image.Gray); ok {
+			return m
+		}
+		dst = image.NewGray(b)
+	case isDeep(m):
+		if _, ok := m.(*image.NRGBA64); ok {
+			return m
+		}
+		dst = image.NewNRGBA64(b)
+	default:
+		if _, ok := m.(*image.NRGBA); ok {
+			return m
+		}
+		dst = image.NewNRGBA(b)
+	}
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	return dst
+}
+
+// encodePNM 编码为二进制的 PGM (P5), PPM (P6) 或 PAM (P7)
+func encodePNM(w io.Writer, m image.Image, format string) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	gray := format == FormatPGM
+	if format == FormatPAM {
+		switch m.(type) {
+		case *image.Gray, *image.Gray16:
+			gray = true
+		}
+	}
+	src := pnmSource(m, gray)
+	channels, tuple := 3, "RGB"
+	switch {
+	case gray:
+		channels, tuple = 1, "GRAYSCALE"
+	case format == FormatPAM && !isOpaque(src):
+		channels, tuple = 4, "RGB_ALPHA"
+	}
+	size, maxval := 1, 0xff
+	if isDeep(src) {
+		size, maxval = 2, 0xffff
+	}
+
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatPGM:
+		fmt.Fprintf(bw, "P5\n%d %d\n%d\n", b.Dx(), b.Dy(), maxval)
+	case FormatPPM:
+		fmt.Fprintf(bw, "P6\n%d %d\n%d\n", b.Dx(), b.Dy(), maxval)
+	default:
+		fmt.Fprintf(bw, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\nTUPLTYPE %s\nENDHDR\n",
+			b.Dx(), b.Dy(), channels, maxval, tuple)
+	}
+	row := make([]byte, 0, b.Dx()*channels*size)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		switch src := src.(type) {
+		case *image.Gray:
+			off := src.PixOffset(b.Min.X, y)
+			row = append(row, src.Pix[off:off+b.Dx()]...)
+		case *image.Gray16:
+			off := src.PixOffset(b.Min.X, y)
+			row = append(row, src.Pix[off:off+2*b.Dx()]...)
+		case *image.NRGBA:
+			for x := b.Min.X; x < b.Max.X; x++ {
+				off := src.PixOffset(x, y)
+				row = append(row, src.Pix[off:off+channels]...)
+			}
+		case *image.NRGBA64:
+			for x := b.Min.X; x < b.Max.X; x++ {
+				off := src.PixOffset(x, y)
+				row = append(row, src.Pix[off:off+2*channels]...)
+			}
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// encodePBM 编码为二进制的 PBM (P4), 灰度小于 128 的为黑色
+func encodePBM(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	src := pnmSource(m, true)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P4\n%d %d\n", b.Dx(), b.Dy())
+	row := make([]byte, (b.Dx()+7)/8)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		clear(row)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var v uint8
+			switch src := src.(type) {
+			case *image.Gray:
+				v = src.GrayAt(x, y).Y
+			case *image.Gray16:
+				v = uint8(src.Gray16At(x, y).Y >> 8)
+			}
+			if v < 0x80 {
+				i := x - b.Min.X
+				row[i/8] |= 0x80 >> (i % 8)
+			}
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,94 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPNM(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 11, 5))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 3)
+	}
+	gray16 := image.NewGray16(image.Rect(0, 0, 10, 3))
+	for i := range gray16.Pix {
+		gray16.Pix[i] = uint8(i * 7)
+	}
+	alpha := image.NewNRGBA(image.Rect(0, 0, 37, 21))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = uint8(i * 13)
+	}
+	deep := image.NewNRGBA64(image.Rect(0, 0, 9, 7))
+	for i := range deep.Pix {
+		deep.Pix[i] = uint8(i * 29)
+	}
+	cases := []struct {
+		format string
+		m      image.Image
+	}{
+		{FormatPGM, gray},
+		{FormatPGM, gray16},
+		{FormatPPM, gradient(23, 17)},
+		{FormatPPM, gray},
+		{FormatPAM, alpha},
+		{FormatPAM, deep},
+		{FormatPAM, gray16},
+		{FormatPAM, gradient(23, 17).SubImage(image.Rect(2, 3, 20, 9))},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		assert.NoError(t, encodePNM(&buf, c.m, c.format))
+		got, name, err := image.Decode(&buf)
+		if assert.NoError(t, err, c.format) {
+			assert.Equal(t, c.format, name)
+			samePixels(t, c.m, translateTo(got, c.m.Bounds().Min))
+		}
+	}
+
+	bw := image.NewGray(image.Rect(0, 0, 13, 3))
+	for i := range bw.Pix {
+		bw.Pix[i] = uint8(i%2) * 255
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, encodePBM(&buf, bw))
+	got, name, err := image.Decode(&buf)
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatPBM, name)
+		samePixels(t, bw, got)
+	}
+}
+
+func TestPNMPlain(t *testing.T) {
+	m, name, err := image.Decode(strings.NewReader("P1\n# comment\n3 2\n1 0 1\n0 1 0\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatPBM, name)
+		assert.Equal(t, []uint8{0, 255, 0, 255, 0, 255}, m.(*image.Gray).Pix)
+	}
+	// PBM 文本格式的像素可以不以空白分隔
+	m, _, err = image.Decode(strings.NewReader("P1 3 1 101"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []uint8{0, 255, 0}, m.(*image.Gray).Pix)
+	}
+
+	m, name, err = image.Decode(strings.NewReader("P2 2 1 15 0 15"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatPGM, name)
+		assert.Equal(t, []uint8{0, 255}, m.(*image.Gray).Pix)
+	}
+
+	m, name, err = image.Decode(strings.NewReader("P3 1 1 65535 65535 0 32768"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatPPM, name)
+		assert.Equal(t, color.NRGBA64{65535, 0, 32768, 65535}, m.At(0, 0))
+	}
+
+	_, _, err = image.Decode(strings.NewReader("P2 2 1 15 0"))
+	assert.Error(t, err)
+	_, _, err = image.Decode(strings.NewReader("P5 2 1 255 \x00"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package image
+
+import (
+	"io"
+)
+
+// Probe 只读取图像属性, 不解码像素
+func Probe(rs io.ReadSeeker) (*Attr, error) {
+	return ProbeWith(rs, nil)
+}
+
+// ProbeWith probe an image with read option
+func ProbeWith(rs io.ReadSeeker, ropt *ReadOption) (*Attr, error) {
+	im, err := probe(rs, ropt)
+	if err != nil {
+		return nil, err
+	}
+	return im.Attr, nil
+}
+
+// probe 返回尚未解码像素的 Image
+func probe(rs io.ReadSeeker, ropt *ReadOption) (*Image, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	l := ropt.limits()
+	if l.MaxBytes > 0 && size > l.MaxBytes {
+		return nil, ErrImageTooLarge
+	}
+	cfg, format, err := decodeConfig(rs)
+	if err != nil {
+		return nil, err
+	}
+	if err = l.Check(cfg); err != nil {
+		return nil, err
+	}
+	if format == FormatTIFF && ropt != nil && ropt.Page != 0 {
+		_, _ = rs.Seek(0, io.SeekStart)
+		if _, cfg, err = readTIFFPage(rs, ropt.Page, l); err != nil {
+			return nil, err
+		}
+	}
+
+	var orient Orientation
+	if format == FormatJPEG && ropt != nil && ropt.AutoOrient {
+		_, _ = rs.Seek(0, io.SeekStart)
+		orient = ReadOrientation(rs)
+	}
+	var frames int
+	switch format {
+	case FormatGIF:
+		_, _ = rs.Seek(0, io.SeekStart)
+		frames = countGIFFrames(rs)
+	case FormatWEBP:
+		_, _ = rs.Seek(0, io.SeekStart)
+		chunks, err := readRiffChunks(rs, size)
+		if err != nil {
+			return nil, err
+		}
+		frames = countWebpFrames(chunks)
+	}
+	if err = l.checkFrames(frames, cfg); err != nil {
+		return nil, err
+	}
+	w, h := uint(cfg.Width), uint(cfg.Height)
+	if orient.Swapped() {
+		w, h = h, w
+	}
+	im := &Image{
+		Attr:   newAttrWith(w, h, format, int(size)),
+		Format: format,
+		rs:     rs,
+		rn:     int(size),
+		orient: orient,
+		ropt:   ropt,
+	}
+	im.readColorModel(cfg.ColorModel)
+	if frames > 1 {
+		im.Frames = frames
+		im.Animated = true
+	}
+	im.readPages()
+	if err = im.readQuality(); err != nil {
+		return nil, err
+	}
+	return im, nil
+}
+
+// load 延迟模式下首次使用时解码像素
+func (im *Image) load() error {
+	if im.m != nil {
+		return nil
+	}
+	if im.rs == nil {
+		return ErrEmptyImage
+	}
+	_, _ = im.rs.Seek(0, io.SeekStart)
+	m, anim, _, err := decodeFrames(im.rs, im.ropt, true)
+	if err != nil {
+		return err
+	}
+	im.m = Orient(m, im.orient)
+	im.anim = anim
+	im.toSRGB()
+	return nil
+}
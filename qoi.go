@@ -0,0 +1,168 @@
+package image
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// QOI, 见 https://qoiformat.org/qoi-specification.pdf
+
+const (
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xc0
+	qoiOpRGB   = 0xfe
+	qoiOpRGBA  = 0xff
+	qoiMask    = 0xc0
+
+	qoiHeaderSize = 14
+	qoiMaxPixels  = 400_000_000
+)
+
+var qoiEnd = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+func qoiHash(c color.NRGBA) int {
+	return (int(c.R)*3 + int(c.G)*5 + int(c.B)*7 + int(c.A)*11) % 64
+}
+
+func qoiDecodeConfig(r io.Reader) (image.Config, error) {
+	var hdr [qoiHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return image.Config{}, err
+	}
+	if string(hdr[:4]) != "qoif" {
+		return image.Config{}, ErrInvalidFormat
+	}
+	w, h := binary.BigEndian.Uint32(hdr[4:]), binary.BigEndian.Uint32(hdr[8:])
+	if w == 0 || h == 0 || uint64(w)*uint64(h) > qoiMaxPixels || hdr[12] < 3 || hdr[12] > 4 {
+		return image.Config{}, ErrInvalidFormat
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: int(w), Height: int(h)}, nil
+}
+
+func qoiDecode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	cfg, err := qoiDecodeConfig(br)
+	if err != nil {
+		return nil, err
+	}
+	m := image.NewNRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+	var index [64]color.NRGBA
+	px := color.NRGBA{A: 0xff}
+	run := 0
+	for i := 0; i < len(m.Pix); i += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case b == qoiOpRGB || b == qoiOpRGBA:
+				n := 3
+				if b == qoiOpRGBA {
+					n = 4
+				}
+				var v [4]byte
+				if _, err = io.ReadFull(br, v[:n]); err != nil {
+					return nil, err
+				}
+				px.R, px.G, px.B = v[0], v[1], v[2]
+				if n == 4 {
+					px.A = v[3]
+				}
+			case b&qoiMask == qoiOpIndex:
+				px = index[b]
+			case b&qoiMask == qoiOpDiff:
+				px.R += (b>>4)&3 - 2
+				px.G += (b>>2)&3 - 2
+				px.B += b&3 - 2
+			case b&qoiMask == qoiOpLuma:
+				b2, err := br.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				dg := b&0x3f - 32
+				px.R += dg + b2>>4 - 8
+				px.G += dg
+				px.B += dg + b2&0x0f - 8
+			default:
+				run = int(b & 0x3f)
+			}
+			index[qoiHash(px)] = px
+		}
+		m.Pix[i], m.Pix[i+1], m.Pix[i+2], m.Pix[i+3] = px.R, px.G, px.B, px.A
+	}
+	return m, nil
+}
+
+// encodeQOI 不透明时写入 3 个通道
+func encodeQOI(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	src, ok := m.(*image.NRGBA)
+	if !ok || src.Rect.Min != (image.Point{}) || src.Stride != 4*b.Dx() {
+		src = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Rect, m, b.Min, draw.Src)
+	}
+	channels := byte(4)
+	if isOpaque(src) {
+		channels = 3
+	}
+	bw := bufio.NewWriter(w)
+	hdr := append([]byte("qoif"), 0, 0, 0, 0, 0, 0, 0, 0, channels, 0)
+	binary.BigEndian.PutUint32(hdr[4:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(hdr[8:], uint32(b.Dy()))
+	_, _ = bw.Write(hdr)
+
+	var index [64]color.NRGBA
+	prev := color.NRGBA{A: 0xff}
+	run := 0
+	pix := src.Pix[:4*b.Dx()*b.Dy()]
+	for i := 0; i < len(pix); i += 4 {
+		px := color.NRGBA{pix[i], pix[i+1], pix[i+2], pix[i+3]}
+		if px == prev {
+			run++
+			if run == 62 || i+4 == len(pix) {
+				_ = bw.WriteByte(qoiOpRun | byte(run-1))
+				run = 0
+			}
+			continue
+		}
+		if run > 0 {
+			_ = bw.WriteByte(qoiOpRun | byte(run-1))
+			run = 0
+		}
+		h := qoiHash(px)
+		switch {
+		case index[h] == px:
+			_ = bw.WriteByte(qoiOpIndex | byte(h))
+		case px.A != prev.A:
+			index[h] = px
+			_, _ = bw.Write([]byte{qoiOpRGBA, px.R, px.G, px.B, px.A})
+		default:
+			index[h] = px
+			dr, dg, db := int8(px.R-prev.R), int8(px.G-prev.G), int8(px.B-prev.B)
+			drg, dbg := dr-dg, db-dg
+			switch {
+			case dr > -3 && dr < 2 && dg > -3 && dg < 2 && db > -3 && db < 2:
+				_ = bw.WriteByte(qoiOpDiff | byte(dr+2)<<4 | byte(dg+2)<<2 | byte(db+2))
+			case drg > -9 && drg < 8 && dg > -33 && dg < 32 && dbg > -9 && dbg < 8:
+				_, _ = bw.Write([]byte{qoiOpLuma | byte(dg+32), byte(drg+8)<<4 | byte(dbg+8)})
+			default:
+				_, _ = bw.Write([]byte{qoiOpRGB, px.R, px.G, px.B})
+			}
+		}
+		prev = px
+	}
+	_, _ = bw.Write(qoiEnd)
+	return bw.Flush()
+}
@@ -0,0 +1,66 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQOI(t *testing.T) {
+	alpha := image.NewNRGBA(image.Rect(0, 0, 37, 21))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = uint8(i * 13)
+	}
+	// 超过 62 个像素的连续重复
+	flat := image.NewNRGBA(image.Rect(0, 0, 100, 3))
+	for i := range flat.Pix {
+		flat.Pix[i] = 200
+	}
+	for _, m := range []image.Image{photo(120, 90), gradient(23, 17), alpha, flat, alpha.SubImage(image.Rect(3, 2, 20, 9))} {
+		var buf bytes.Buffer
+		assert.NoError(t, encodeQOI(&buf, m))
+		got, name, err := image.Decode(&buf)
+		if assert.NoError(t, err) {
+			assert.Equal(t, FormatQOI, name)
+			samePixels(t, m, translateTo(got, m.Bounds().Min))
+		}
+	}
+
+	// 两个红色像素: DIFF 及 RUN
+	red := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	red.SetNRGBA(1, 0, color.NRGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	assert.NoError(t, encodeQOI(&buf, red))
+	want := []byte("qoif\x00\x00\x00\x02\x00\x00\x00\x01\x03\x00\x5a\xc0")
+	assert.Equal(t, append(want, qoiEnd...), buf.Bytes())
+
+	_, err := qoiDecode(bytes.NewReader(want[:15]))
+	assert.Error(t, err)
+	_, err = qoiDecodeConfig(bytes.NewReader([]byte("qoif\x00\x00\x00\x02\x00\x00\x00\x01\x05\x00")))
+	assert.Equal(t, ErrInvalidFormat, err)
+}
+
+func TestFarbfeld(t *testing.T) {
+	deep := image.NewNRGBA64(image.Rect(0, 0, 9, 7))
+	for i := range deep.Pix {
+		deep.Pix[i] = uint8(i * 29)
+	}
+	for _, m := range []image.Image{gradient(23, 17), deep, deep.SubImage(image.Rect(1, 2, 8, 5))} {
+		var buf bytes.Buffer
+		assert.NoError(t, encodeFarbfeld(&buf, m))
+		assert.Equal(t, 16+8*m.Bounds().Dx()*m.Bounds().Dy(), buf.Len())
+		got, name, err := image.Decode(&buf)
+		if assert.NoError(t, err) {
+			assert.Equal(t, FormatFarbfeld, name)
+			samePixels(t, m, translateTo(got, m.Bounds().Min))
+		}
+	}
+
+	// 头部声明的尺寸大于数据
+	_, err := farbfeldDecode(bytes.NewReader([]byte("farbfeld\x00\x01\x00\x00\x00\x01\x00\x00\x00\x00")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,446 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"sort"
+)
+
+// Quantizer 生成调色板的算法
+type Quantizer uint8
+
+// Quantizer
+const (
+	QuantizeMedianCut Quantizer = iota // 中位切分, 速度与效果较均衡
+	QuantizeOctree                     // 八叉树, 较快, 适合颜色较少的图
+	QuantizeKMeans                     // 以中位切分为初值的 k-means, 最慢, 照片效果最好
+	QuantizePlan9                      // 固定的 Plan9 调色板, 与 gif.Encode 的默认行为一致
+)
+
+// GIFOption GIF 编码选项
+type GIFOption struct {
+	Quantizer   Quantizer // 量化算法
+	Colors      int       // 颜色数, 0 为 256
+	Dither      float32   // Floyd-Steinberg 抖动的强度, 0 为不抖动, 1 为完全扩散误差
+	Transparent bool      // 源图有透明像素时保留一个透明色, alpha 小于一半的像素为透明
+}
+
+// alphaMode 量化时如何处理 alpha
+type alphaMode uint8
+
+const (
+	alphaKeep   alphaMode = iota // 保留 alpha, 用于 PNG
+	alphaBinary                  // 只保留一个完全透明色, 用于 GIF
+	alphaDrop                    // 合成到黑色上
+)
+
+// quantize 按选项量化, 不保留透明时合成到黑色上
+func (o *GIFOption) quantize(m image.Image) *image.Paletted {
+	mode := alphaDrop
+	if o.Transparent {
+		mode = alphaBinary
+	}
+	return quantizeImage(m, o.Quantizer, o.Colors, o.Dither, mode)
+}
+
+// colorCount 直方图中的一种颜色及其像素数
+type colorCount struct {
+	c [4]uint8 // NRGBA
+	n int
+}
+
+// prepare 复制为 NRGBA 并按 mode 处理 alpha, 完全透明的像素都改为 0
+func prepare(m image.Image, mode alphaMode) *image.NRGBA {
+	b := m.Bounds()
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		p := dst.Pix[i : i+4 : i+4]
+		switch {
+		case mode == alphaDrop:
+			p[0] = uint8(int(p[0]) * int(p[3]) / 255)
+			p[1] = uint8(int(p[1]) * int(p[3]) / 255)
+			p[2] = uint8(int(p[2]) * int(p[3]) / 255)
+			p[3] = 0xff
+		case mode == alphaBinary && p[3] >= 0x80:
+			p[3] = 0xff
+		case p[3] == 0 || mode == alphaBinary:
+			p[0], p[1], p[2], p[3] = 0, 0, 0, 0
+		}
+	}
+	return dst
+}
+
+// histogram 统计颜色, 按颜色排序使结果可重复
+func histogram(m *image.NRGBA) []colorCount {
+	b := m.Bounds()
+	counts := make(map[[4]uint8]int)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := m.Pix[m.PixOffset(b.Min.X, y):m.PixOffset(b.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			counts[[4]uint8(row[i:i+4])]++
+		}
+	}
+	hist := make([]colorCount, 0, len(counts))
+	for c, n := range counts {
+		hist = append(hist, colorCount{c, n})
+	}
+	sort.Slice(hist, func(i, j int) bool { return colorKey(hist[i].c) < colorKey(hist[j].c) })
+	return hist
+}
+
+func colorKey(c [4]uint8) uint32 {
+	return uint32(c[0])<<24 | uint32(c[1])<<16 | uint32(c[2])<<8 | uint32(c[3])
+}
+
+// Quantize 实现 draw.Quantizer, 向 p 追加最多 cap(p)-len(p) 种颜色
+func (q Quantizer) Quantize(p color.Palette, m image.Image) color.Palette {
+	n := cap(p) - len(p)
+	if n <= 0 {
+		return p
+	}
+	return append(p, q.palette(histogram(prepare(m, alphaKeep)), n)...)
+}
+
+// palette 由直方图生成不超过 n 种颜色的调色板, 颜色数不超过 n 时不损失
+func (q Quantizer) palette(hist []colorCount, n int) color.Palette {
+	if q == QuantizePlan9 {
+		return color.Palette(palette.Plan9)[:min(n, len(palette.Plan9))]
+	}
+	if len(hist) <= n {
+		p := make(color.Palette, len(hist))
+		for i, c := range hist {
+			p[i] = nrgba(c.c)
+		}
+		return p
+	}
+	switch q {
+	case QuantizeOctree:
+		return octree(hist, n)
+	case QuantizeKMeans:
+		return kmeans(hist, medianCut(hist, n))
+	}
+	return medianCut(hist, n)
+}
+
+func nrgba(c [4]uint8) color.NRGBA {
+	return color.NRGBA{c[0], c[1], c[2], c[3]}
+}
+
+// colorSum 按像素数加权的颜色累加
+type colorSum struct {
+	s [4]int
+	n int
+}
+
+func (s *colorSum) add(c [4]uint8, n int) {
+	for i, v := range c {
+		s.s[i] += int(v) * n
+	}
+	s.n += n
+}
+
+func (s *colorSum) mean() [4]uint8 {
+	var c [4]uint8
+	if s.n == 0 {
+		return c
+	}
+	for i, v := range s.s {
+		c[i] = uint8((v + s.n/2) / s.n)
+	}
+	return c
+}
+
+// colorBox 中位切分中的一个颜色盒
+type colorBox struct {
+	colors []colorCount
+	n      int
+	ch     int // 跨度最大的通道
+	span   int
+}
+
+func newColorBox(colors []colorCount) *colorBox {
+	b := &colorBox{colors: colors}
+	lo, hi := [4]uint8{255, 255, 255, 255}, [4]uint8{}
+	for _, c := range colors {
+		b.n += c.n
+		for i, v := range c.c {
+			lo[i], hi[i] = min(lo[i], v), max(hi[i], v)
+		}
+	}
+	for i := range lo {
+		if s := int(hi[i]) - int(lo[i]); s > b.span {
+			b.ch, b.span = i, s
+		}
+	}
+	return b
+}
+
+// split 在所选通道上按像素数的中位切为两个盒
+func (b *colorBox) split() (*colorBox, *colorBox) {
+	ch := b.ch
+	sort.SliceStable(b.colors, func(i, j int) bool { return b.colors[i].c[ch] < b.colors[j].c[ch] })
+	k, sum := 1, b.colors[0].n
+	for k < len(b.colors)-1 && sum+b.colors[k].n <= b.n/2 {
+		sum += b.colors[k].n
+		k++
+	}
+	return newColorBox(b.colors[:k]), newColorBox(b.colors[k:])
+}
+
+// medianCut 中位切分, 优先切分跨度与像素数乘积最大的盒
+func medianCut(hist []colorCount, n int) color.Palette {
+	boxes := []*colorBox{newColorBox(append([]colorCount(nil), hist...))}
+	for len(boxes) < n {
+		best, score := -1, 0
+		for i, b := range boxes {
+			if len(b.colors) > 1 && b.span*b.n > score {
+				best, score = i, b.span*b.n
+			}
+		}
+		if best < 0 {
+			break
+		}
+		l, r := boxes[best].split()
+		boxes[best] = l
+		boxes = append(boxes, r)
+	}
+	p := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		var s colorSum
+		for _, c := range b.colors {
+			s.add(c.c, c.n)
+		}
+		p[i] = nrgba(s.mean())
+	}
+	return p
+}
+
+// octNode 八叉树的节点, RGBA 四个通道每层各取一位, 故每个节点最多 16 个子节点
+type octNode struct {
+	children [16]*octNode
+	sum      colorSum
+	leaf     bool
+}
+
+// octree 把颜色插入最深 8 层的树, 再从最深层起合并像素数最少的节点, 直到叶子数不超过 n
+func octree(hist []colorCount, n int) color.Palette {
+	const depth = 8
+	root := new(octNode)
+	// levels[d] 为深度 d 的内部节点
+	levels := [depth][]*octNode{{root}}
+	leaves := 0
+	for _, c := range hist {
+		node := root
+		for d := 0; d < depth; d++ {
+			shift := 7 - d
+			i := int(c.c[0]>>shift&1)<<3 | int(c.c[1]>>shift&1)<<2 | int(c.c[2]>>shift&1)<<1 | int(c.c[3]>>shift&1)
+			if node.children[i] == nil {
+				node.children[i] = new(octNode)
+				if d+1 < depth {
+					levels[d+1] = append(levels[d+1], node.children[i])
+				} else {
+					node.children[i].leaf = true
+					leaves++
+				}
+			}
+			node = node.children[i]
+		}
+		node.sum.add(c.c, c.n)
+	}
+	for d := depth - 1; d >= 0 && leaves > n; d-- {
+		nodes := levels[d]
+		for _, node := range nodes {
+			node.sum = colorSum{}
+			for _, ch := range node.children {
+				if ch != nil {
+					for j, v := range ch.sum.s {
+						node.sum.s[j] += v
+					}
+					node.sum.n += ch.sum.n
+				}
+			}
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].sum.n < nodes[j].sum.n })
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			k := 0
+			for i, ch := range node.children {
+				if ch != nil {
+					k++
+					node.children[i] = nil
+				}
+			}
+			node.leaf = true
+			leaves -= k - 1
+		}
+	}
+	var p color.Palette
+	var walk func(*octNode)
+	walk = func(node *octNode) {
+		if node.leaf {
+			p = append(p, nrgba(node.sum.mean()))
+			return
+		}
+		for _, ch := range node.children {
+			if ch != nil {
+				walk(ch)
+			}
+		}
+	}
+	walk(root)
+	return p
+}
+
+// kmeans 以 p 为初值迭代, 颜色过多时先合并低位以限制计算量
+func kmeans(hist []colorCount, p color.Palette) color.Palette {
+	const maxColors, rounds = 1 << 14, 8
+	for shift := uint8(1); len(hist) > maxColors && shift < 8; shift++ {
+		hist = coarsen(hist, shift)
+	}
+	centers := make([][4]uint8, len(p))
+	for i, c := range p {
+		n := c.(color.NRGBA)
+		centers[i] = [4]uint8{n.R, n.G, n.B, n.A}
+	}
+	sums := make([]colorSum, len(centers))
+	for r := 0; r < rounds; r++ {
+		clear(sums)
+		for _, c := range hist {
+			sums[nearest(centers, c.c)].add(c.c, c.n)
+		}
+		moved := false
+		for i := range centers {
+			if sums[i].n == 0 {
+				continue
+			}
+			if c := sums[i].mean(); c != centers[i] {
+				centers[i], moved = c, true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	out := make(color.Palette, len(centers))
+	for i, c := range centers {
+		out[i] = nrgba(c)
+	}
+	return out
+}
+
+// coarsen 合并去掉低 shift 位后相同的颜色, 保留加权平均色
+func coarsen(hist []colorCount, shift uint8) []colorCount {
+	mask := uint8(0xff) << shift
+	sums := make(map[[4]uint8]*colorSum)
+	var keys [][4]uint8
+	for _, c := range hist {
+		k := [4]uint8{c.c[0] & mask, c.c[1] & mask, c.c[2] & mask, c.c[3] & mask}
+		s, ok := sums[k]
+		if !ok {
+			s = new(colorSum)
+			sums[k] = s
+			keys = append(keys, k)
+		}
+		s.add(c.c, c.n)
+	}
+	out := make([]colorCount, len(keys))
+	for i, k := range keys {
+		out[i] = colorCount{sums[k].mean(), sums[k].n}
+	}
+	return out
+}
+
+// nearest 返回欧氏距离最近的颜色序号
+func nearest(p [][4]uint8, c [4]uint8) int {
+	best, bestD := 0, -1
+	for i, v := range p {
+		d := 0
+		for j := range v {
+			x := int(v[j]) - int(c[j])
+			d += x * x
+		}
+		if bestD < 0 || d < bestD {
+			best, bestD = i, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// quantizeImage 量化为不超过 colors 种颜色 (0 为 256) 的调色板图像, dither 为抖动强度
+func quantizeImage(m image.Image, q Quantizer, colors int, dither float32, mode alphaMode) *image.Paletted {
+	if colors <= 0 || colors > 256 {
+		colors = 256
+	}
+	src := prepare(m, mode)
+	hist := histogram(src)
+	var p color.Palette
+	if mode == alphaBinary && len(hist) > 0 && hist[0].c[3] == 0 {
+		// 按颜色排序后透明色在最前, 单独保留一项
+		p = append(q.palette(hist[1:], max(colors-1, 1)), color.NRGBA{})
+	} else {
+		p = q.palette(hist, colors)
+	}
+	if len(p) == 0 {
+		p = append(p, color.NRGBA{})
+	}
+	return remap(src, p, dither)
+}
+
+// remap 把像素映射到最近的调色板颜色, dither > 0 时按 Floyd-Steinberg 扩散误差
+func remap(src *image.NRGBA, p color.Palette, dither float32) *image.Paletted {
+	b := src.Bounds()
+	pm := image.NewPaletted(b, p)
+	centers := make([][4]uint8, len(p))
+	for i, c := range p {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		centers[i] = [4]uint8{n.R, n.G, n.B, n.A}
+	}
+	cache := make(map[[4]uint8]uint8)
+	lookup := func(c [4]uint8) uint8 {
+		i, ok := cache[c]
+		if !ok {
+			i = uint8(nearest(centers, c))
+			cache[c] = i
+		}
+		return i
+	}
+	w := b.Dx()
+	// 当前行及下一行的累积误差, 两侧各留一个像素
+	cur, next := make([][4]float32, w+2), make([][4]float32, w+2)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := src.Pix[src.PixOffset(b.Min.X, y):]
+		out := pm.Pix[pm.PixOffset(b.Min.X, y):]
+		for x := 0; x < w; x++ {
+			c := [4]uint8(row[x*4 : x*4+4])
+			if dither <= 0 || c[3] == 0 {
+				out[x] = lookup(c)
+				continue
+			}
+			var want [4]float32
+			for j := range c {
+				want[j] = float32(c[j]) + cur[x+1][j]
+				c[j] = uint8(min(max(want[j]+0.5, 0), 255))
+			}
+			i := lookup(c)
+			out[x] = i
+			for j := range want {
+				e := (want[j] - float32(centers[i][j])) * dither
+				cur[x+2][j] += e * 7 / 16
+				next[x][j] += e * 3 / 16
+				next[x+1][j] += e * 5 / 16
+				next[x+2][j] += e * 1 / 16
+			}
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+	return pm
+}
@@ -0,0 +1,95 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// photo 带噪声的渐变, 近似照片
+func photo(w, h int) *image.RGBA {
+	m := gradient(w, h)
+	seed := uint32(1)
+	for i := range m.Pix {
+		seed = seed*1664525 + 1013904223
+		if i%4 != 3 {
+			m.Pix[i] = uint8(min(max(int(m.Pix[i])+int(seed>>28)-8, 0), 255))
+		}
+	}
+	return m
+}
+
+func TestQuantizer(t *testing.T) {
+	src := photo(96, 64)
+	diffs := map[Quantizer]float64{}
+	for _, q := range []Quantizer{QuantizeMedianCut, QuantizeOctree, QuantizeKMeans, QuantizePlan9} {
+		p := q.Quantize(make(color.Palette, 0, 32), src)
+		assert.NotEmpty(t, p)
+		assert.LessOrEqual(t, len(p), 32)
+
+		pm := quantizeImage(src, q, 0, 0, alphaDrop)
+		assert.LessOrEqual(t, len(pm.Palette), 256)
+		diffs[q] = meanDiff(src, pm)
+		dithered := quantizeImage(src, q, 0, 1, alphaDrop)
+		assert.NotEqual(t, pm.Pix, dithered.Pix)
+		assert.Less(t, meanDiff(src, dithered), diffs[q]*1.5, "quantizer %d", q)
+	}
+	assert.Less(t, diffs[QuantizeMedianCut], 5.0)
+	assert.Less(t, diffs[QuantizeOctree], diffs[QuantizePlan9])
+	assert.LessOrEqual(t, diffs[QuantizeKMeans], diffs[QuantizeMedianCut])
+
+	// 颜色不超过目标数时不损失
+	few := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < len(few.Pix); i += 4 {
+		copy(few.Pix[i:], []uint8{uint8(i % 5 * 50), uint8(i % 3 * 100), 7, 255})
+	}
+	for _, q := range []Quantizer{QuantizeMedianCut, QuantizeOctree, QuantizeKMeans} {
+		pm := quantizeImage(few, q, 16, 1, alphaDrop)
+		assert.Zero(t, meanDiff(few, pm))
+	}
+
+	// 八叉树合并后不超过目标数
+	assert.LessOrEqual(t, len(octree(histogram(prepare(src, alphaKeep)), 5)), 5)
+}
+
+func TestGIFOption(t *testing.T) {
+	src := photo(60, 40)
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 10; x++ {
+			src.SetRGBA(x, y, color.RGBA{})
+		}
+	}
+	save := func(o *GIFOption) image.Image {
+		var buf bytes.Buffer
+		_, err := SaveTo(&buf, src, &WriteOption{Format: FormatGIF, GIF: o})
+		assert.NoError(t, err)
+		m, err := gif.Decode(&buf)
+		assert.NoError(t, err)
+		return m
+	}
+
+	std := save(nil)
+	for _, q := range []Quantizer{QuantizeMedianCut, QuantizeOctree, QuantizeKMeans} {
+		m := save(&GIFOption{Quantizer: q, Transparent: true, Dither: 0.5})
+		pm, ok := m.(*image.Paletted)
+		if assert.True(t, ok) {
+			assert.LessOrEqual(t, len(pm.Palette), 256)
+		}
+		_, _, _, a := m.At(5, 5).RGBA()
+		assert.Zero(t, a, "transparent pixels are kept")
+		_, _, _, a = m.At(30, 5).RGBA()
+		assert.EqualValues(t, 0xffff, a)
+		// 只比较不透明的区域
+		r := image.Rect(10, 0, 60, 40)
+		assert.Less(t, meanDiff(src.SubImage(r), subImage(m, r)), meanDiff(src.SubImage(r), subImage(std, r)))
+	}
+
+	m := save(&GIFOption{Colors: 16})
+	assert.LessOrEqual(t, len(m.(*image.Paletted).Palette), 16)
+	_, _, _, a := m.At(5, 5).RGBA()
+	assert.EqualValues(t, 0xffff, a, "transparency dropped by default")
+}
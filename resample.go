@@ -0,0 +1,404 @@
+package image
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Filter 缩放的插值方法
+type Filter uint8
+
+// Filter
+const (
+	FilterCatmullRom Filter = iota // Catmull-Rom 三次插值, 与 nfnt/resize 的 Bicubic 相同, 默认
+	FilterNearest                  // 最近邻, 用于像素画
+	FilterBilinear                 // 双线性, 较快
+	FilterMitchell                 // Mitchell-Netravali 三次插值, 较平滑, 振铃较少
+	FilterLanczos2                 // 2 瓣 Lanczos
+	FilterLanczos3                 // 3 瓣 Lanczos, 最锐利
+	FilterBox                      // 按面积平均, 用于大倍数缩小
+)
+
+// kernel 以源像素为单位的插值函数及其半径
+type kernel struct {
+	support float64
+	at      func(x float64) float64
+}
+
+func (f Filter) kernel() kernel {
+	switch f {
+	case FilterBox:
+		return kernel{0.5, func(x float64) float64 {
+			if math.Abs(x) <= 0.5 {
+				return 1
+			}
+			return 0
+		}}
+	case FilterBilinear:
+		return kernel{1, func(x float64) float64 {
+			return max(1-math.Abs(x), 0)
+		}}
+	case FilterMitchell:
+		return kernel{2, cubic(1.0/3, 1.0/3)}
+	case FilterLanczos2:
+		return kernel{2, lanczos(2)}
+	case FilterLanczos3:
+		return kernel{3, lanczos(3)}
+	}
+	return kernel{2, cubic(0, 0.5)}
+}
+
+// cubic Mitchell-Netravali 的 BC 三次样条
+func cubic(b, c float64) func(float64) float64 {
+	return func(x float64) float64 {
+		x = math.Abs(x)
+		switch {
+		case x < 1:
+			return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+		case x < 2:
+			return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+		}
+		return 0
+	}
+}
+
+func lanczos(a float64) func(float64) float64 {
+	sinc := func(x float64) float64 {
+		if x == 0 {
+			return 1
+		}
+		x *= math.Pi
+		return math.Sin(x) / x
+	}
+	return func(x float64) float64 {
+		if math.Abs(x) >= a {
+			return 0
+		}
+		return sinc(x) * sinc(x/a)
+	}
+}
+
+// contrib 一个目标像素使用的源像素起点及权重
+type contrib struct {
+	start int
+	w     []float32
+}
+
+// contribs 把 src 个像素缩放为 dst 个时每个目标像素的权重, 缩小时按比例扩大插值半径, 边缘外的权重舍去后重新归一化
+func contribs(dst, src int, f Filter) []contrib {
+	scale := float64(src) / float64(dst)
+	out := make([]contrib, dst)
+	if f == FilterNearest {
+		for i := range out {
+			out[i] = contrib{min(int((float64(i)+0.5)*scale), src-1), []float32{1}}
+		}
+		return out
+	}
+	k := f.kernel()
+	fs := max(scale, 1)
+	r := k.support * fs
+	ws := make([]float64, 0, int(2*r)+2)
+	for i := range out {
+		c := (float64(i)+0.5)*scale - 0.5
+		lo := max(int(math.Ceil(c-r)), 0)
+		hi := min(int(math.Floor(c+r)), src-1)
+		ws = ws[:0]
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			v := k.at((float64(j) - c) / fs)
+			ws = append(ws, v)
+			sum += v
+		}
+		if sum == 0 {
+			out[i] = contrib{min(max(int(math.Round(c)), 0), src-1), []float32{1}}
+			continue
+		}
+		w := make([]float32, len(ws))
+		for j, v := range ws {
+			w[j] = float32(v / sum)
+		}
+		out[i] = contrib{lo, w}
+	}
+	return out
+}
+
+// parallelRows 每个 goroutine 至少处理的行数
+const parallelRows = 16
+
+// parallel 把 [0, n) 分段后并发执行 fn
+func parallel(n int, fn func(lo, hi int)) {
+	procs := min(runtime.GOMAXPROCS(0), n/parallelRows)
+	if procs <= 1 {
+		fn(0, n)
+		return
+	}
+	step := (n + procs - 1) / procs
+	var wg sync.WaitGroup
+	for lo := 0; lo < n; lo += step {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, min(lo+step, n))
+	}
+	wg.Wait()
+}
+
+// Resize 按 filter 把 m 缩放为 width x height, 宽或高为 0 时按比例计算.
+// 透明的图按预乘的值插值. Gray, Gray16, YCbCr 的结果为相同类型,
+// 其他 16 位的图为 *image.RGBA64, 8 位的为 *image.RGBA
+func Resize(m image.Image, width, height int, filter Filter) image.Image {
+	b := m.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 || (width <= 0 && height <= 0) {
+		return m
+	}
+	if width <= 0 {
+		width = max(int(math.Round(float64(height)*float64(sw)/float64(sh))), 1)
+	}
+	if height <= 0 {
+		height = max(int(math.Round(float64(width)*float64(sh)/float64(sw))), 1)
+	}
+
+	if m, ok := m.(*image.YCbCr); ok {
+		return resizeYCbCr(m, width, height, filter)
+	}
+	src := newRowReader(m)
+	dst := src.newImage(width, height)
+	resample(src, sw, sh, dst, width, height, filter)
+	return dst.m
+}
+
+// resizeYCbCr 分别缩放 Y, Cb, Cr 平面, 结果为相同采样比例的 *image.YCbCr
+func resizeYCbCr(m *image.YCbCr, width, height int, filter Filter) image.Image {
+	b := m.Bounds()
+	dst := image.NewYCbCr(image.Rect(0, 0, width, height), m.SubsampleRatio)
+	db := dst.Bounds()
+	resample(grayRows(m.Y[m.YOffset(b.Min.X, b.Min.Y):], m.YStride, b.Dx()), b.Dx(), b.Dy(),
+		grayWriter(dst.Y, dst.YStride), width, height, filter)
+	sc, dc := chromaRect(b, m.SubsampleRatio), chromaRect(db, m.SubsampleRatio)
+	off := m.COffset(b.Min.X, b.Min.Y)
+	for i, p := range [][]uint8{m.Cb, m.Cr} {
+		q := [][]uint8{dst.Cb, dst.Cr}[i]
+		resample(grayRows(p[off:], m.CStride, sc.Dx()), sc.Dx(), sc.Dy(),
+			grayWriter(q, dst.CStride), dc.Dx(), dc.Dy(), filter)
+	}
+	return dst
+}
+
+// chromaRect 色度平面的范围, 与 image.NewYCbCr 相同
+func chromaRect(r image.Rectangle, ratio image.YCbCrSubsampleRatio) image.Rectangle {
+	x0, y0, x1, y1 := r.Min.X, r.Min.Y, r.Max.X, r.Max.Y
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		x0, x1 = x0/2, (x1+1)/2
+	case image.YCbCrSubsampleRatio420:
+		x0, x1, y0, y1 = x0/2, (x1+1)/2, y0/2, (y1+1)/2
+	case image.YCbCrSubsampleRatio440:
+		y0, y1 = y0/2, (y1+1)/2
+	case image.YCbCrSubsampleRatio411:
+		x0, x1 = x0/4, (x1+3)/4
+	case image.YCbCrSubsampleRatio410:
+		x0, x1, y0, y1 = x0/4, (x1+3)/4, y0/2, (y1+1)/2
+	}
+	return image.Rect(x0, y0, x1, y1)
+}
+
+// resample 把 sw x sh 的 src 缩放为 dw x dh 写入 dst, 先水平后垂直两次卷积, 按行并发
+func resample(src *rowReader, sw, sh int, dst *rowWriter, dw, dh int, filter Filter) {
+	nc := src.channels
+	xc, yc := contribs(dw, sw, filter), contribs(dh, sh, filter)
+
+	// 水平缩放源图的每一行
+	stride := dw * nc
+	tmp := make([]float32, stride*sh)
+	parallel(sh, func(lo, hi int) {
+		row := make([]float32, sw*nc)
+		for y := lo; y < hi; y++ {
+			src.read(y, row)
+			out := tmp[y*stride : (y+1)*stride]
+			if nc == 1 {
+				for x, c := range xc {
+					var s float32
+					for i, w := range c.w {
+						s += w * row[c.start+i]
+					}
+					out[x] = s
+				}
+				continue
+			}
+			for x, c := range xc {
+				var r, g, b, a float32
+				p := row[c.start*4:]
+				for i, w := range c.w {
+					q := p[i*4 : i*4+4 : i*4+4]
+					r += w * q[0]
+					g += w * q[1]
+					b += w * q[2]
+					a += w * q[3]
+				}
+				o := out[x*4 : x*4+4 : x*4+4]
+				o[0], o[1], o[2], o[3] = r, g, b, a
+			}
+		}
+	})
+
+	// 垂直缩放
+	parallel(dh, func(lo, hi int) {
+		row := make([]float32, stride)
+		for y := lo; y < hi; y++ {
+			c := yc[y]
+			clear(row)
+			for i, w := range c.w {
+				line := tmp[(c.start+i)*stride : (c.start+i+1)*stride]
+				for j, v := range line {
+					row[j] += w * v
+				}
+			}
+			dst.write(y, row)
+		}
+	})
+}
+
+// rowReader 按行读取源图为浮点值, 8 位的图取值 0-255, 16 位的为 0-65535
+type rowReader struct {
+	channels int // 1 为灰度, 4 为预乘的 RGBA
+	deep     bool
+	read     func(y int, row []float32)
+}
+
+func newRowReader(m image.Image) *rowReader {
+	b := m.Bounds()
+	w := b.Dx()
+	switch m := m.(type) {
+	case *image.Gray:
+		return grayRows(m.Pix[m.PixOffset(b.Min.X, b.Min.Y):], m.Stride, w)
+	case *image.Gray16:
+		return &rowReader{channels: 1, deep: true, read: func(y int, row []float32) {
+			p := m.Pix[m.PixOffset(b.Min.X, b.Min.Y+y):][: w*2 : w*2]
+			for i := range row {
+				row[i] = float32(uint16(p[i*2])<<8 | uint16(p[i*2+1]))
+			}
+		}}
+	case *image.RGBA:
+		return &rowReader{channels: 4, read: func(y int, row []float32) {
+			for i, v := range m.Pix[m.PixOffset(b.Min.X, b.Min.Y+y):][:w*4] {
+				row[i] = float32(v)
+			}
+		}}
+	case *image.NRGBA:
+		return &rowReader{channels: 4, read: func(y int, row []float32) {
+			p := m.Pix[m.PixOffset(b.Min.X, b.Min.Y+y):][: w*4 : w*4]
+			for i := 0; i < len(p); i += 4 {
+				a := float32(p[i+3])
+				f := a / 0xff
+				row[i], row[i+1], row[i+2], row[i+3] = float32(p[i])*f, float32(p[i+1])*f, float32(p[i+2])*f, a
+			}
+		}}
+	case *image.RGBA64:
+		return &rowReader{channels: 4, deep: true, read: func(y int, row []float32) {
+			p := m.Pix[m.PixOffset(b.Min.X, b.Min.Y+y):][: w*8 : w*8]
+			for i := range row {
+				row[i] = float32(uint16(p[i*2])<<8 | uint16(p[i*2+1]))
+			}
+		}}
+	case *image.NRGBA64:
+		return &rowReader{channels: 4, deep: true, read: func(y int, row []float32) {
+			p := m.Pix[m.PixOffset(b.Min.X, b.Min.Y+y):][: w*8 : w*8]
+			for i := 0; i < len(row); i += 4 {
+				q := p[i*2 : i*2+8 : i*2+8]
+				a := float32(uint16(q[6])<<8 | uint16(q[7]))
+				f := a / 0xffff
+				row[i] = float32(uint16(q[0])<<8|uint16(q[1])) * f
+				row[i+1] = float32(uint16(q[2])<<8|uint16(q[3])) * f
+				row[i+2] = float32(uint16(q[4])<<8|uint16(q[5])) * f
+				row[i+3] = a
+			}
+		}}
+	}
+	return &rowReader{channels: 4, read: func(y int, row []float32) {
+		for x := 0; x < w; x++ {
+			r, g, bl, a := m.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = float32(r)/0x101, float32(g)/0x101, float32(bl)/0x101, float32(a)/0x101
+		}
+	}}
+}
+
+// grayRows 读取 8 位的平面, pix 从第一个像素开始
+func grayRows(pix []uint8, stride, w int) *rowReader {
+	return &rowReader{channels: 1, read: func(y int, row []float32) {
+		for i, v := range pix[y*stride:][:w] {
+			row[i] = float32(v)
+		}
+	}}
+}
+
+// rowWriter 按行写入缩放的结果, 取整并截断到有效范围, 颜色不超过 alpha
+type rowWriter struct {
+	m     image.Image
+	write func(y int, row []float32)
+}
+
+func (r *rowReader) newImage(w, h int) *rowWriter {
+	rect := image.Rect(0, 0, w, h)
+	switch {
+	case r.channels == 1 && r.deep:
+		m := image.NewGray16(rect)
+		return &rowWriter{m, func(y int, row []float32) {
+			p := m.Pix[y*m.Stride:]
+			for i, v := range row {
+				c := clampF(v, 0xffff)
+				p[i*2], p[i*2+1] = uint8(c>>8), uint8(c)
+			}
+		}}
+	case r.channels == 1:
+		m := image.NewGray(rect)
+		return &rowWriter{m, grayWriter(m.Pix, m.Stride).write}
+	case r.deep:
+		m := image.NewRGBA64(rect)
+		return &rowWriter{m, func(y int, row []float32) {
+			p := m.Pix[y*m.Stride:]
+			for i := 0; i < len(row); i += 4 {
+				a := clampF(row[i+3], 0xffff)
+				q := p[i*2 : i*2+8 : i*2+8]
+				for j := 0; j < 3; j++ {
+					c := clampF(row[i+j], a)
+					q[j*2], q[j*2+1] = uint8(c>>8), uint8(c)
+				}
+				q[6], q[7] = uint8(a>>8), uint8(a)
+			}
+		}}
+	}
+	m := image.NewRGBA(rect)
+	return &rowWriter{m, func(y int, row []float32) {
+		p := m.Pix[y*m.Stride:]
+		for i := 0; i < len(row); i += 4 {
+			a := clampF(row[i+3], 0xff)
+			q := p[i : i+4 : i+4]
+			q[0], q[1], q[2], q[3] = uint8(clampF(row[i], a)), uint8(clampF(row[i+1], a)), uint8(clampF(row[i+2], a)), uint8(a)
+		}
+	}}
+}
+
+// grayWriter 写入 8 位的平面
+func grayWriter(pix []uint8, stride int) *rowWriter {
+	return &rowWriter{write: func(y int, row []float32) {
+		p := pix[y*stride:][:len(row)]
+		for i, v := range row {
+			p[i] = uint8(clampF(v, 0xff))
+		}
+	}}
+}
+
+// clampF 四舍五入并截断到 [0, hi]
+func clampF(v float32, hi uint32) uint32 {
+	if v <= 0 {
+		return 0
+	}
+	if c := uint32(v + 0.5); c < hi {
+		return c
+	}
+	return hi
+}
@@ -0,0 +1,141 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/nfnt/resize"
+	"github.com/stretchr/testify/assert"
+)
+
+var testFilters = []Filter{FilterCatmullRom, FilterNearest, FilterBilinear, FilterMitchell, FilterLanczos2, FilterLanczos3, FilterBox}
+
+func TestContribs(t *testing.T) {
+	for _, f := range testFilters {
+		for _, c := range [][2]int{{10, 100}, {100, 10}, {7, 13}, {1, 5}} {
+			for _, ct := range contribs(c[0], c[1], f) {
+				var sum float32
+				for _, w := range ct.w {
+					sum += w
+				}
+				assert.InDelta(t, 1, sum, 1e-5, "filter %d", f)
+				assert.GreaterOrEqual(t, ct.start, 0)
+				assert.LessOrEqual(t, ct.start+len(ct.w), c[1])
+			}
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := photo(200, 150)
+	for _, f := range testFilters {
+		m := Resize(src, 50, 0, f)
+		assert.Equal(t, image.Rect(0, 0, 50, 38), m.Bounds(), "filter %d", f)
+		up := Resize(src, 300, 200, f)
+		assert.Equal(t, image.Rect(0, 0, 300, 200), up.Bounds())
+	}
+
+	// 与 nfnt/resize 的 Bicubic 相近
+	want := resize.Resize(60, 45, src, resize.Bicubic)
+	got := Resize(src, 60, 45, FilterCatmullRom)
+	p, err := PSNR(want, got)
+	assert.NoError(t, err)
+	assert.Greater(t, p, 40.0)
+
+	// 透明的边缘不会混入透明像素的颜色
+	half := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 20; x++ {
+			half.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+			half.SetNRGBA(x+20, y, color.NRGBA{0, 255, 0, 0})
+		}
+	}
+	for _, f := range testFilters {
+		m := Resize(half, 15, 15, f).(*image.RGBA)
+		for i := 0; i < len(m.Pix); i += 4 {
+			assert.Zero(t, m.Pix[i+1], "filter %d", f)
+			assert.LessOrEqual(t, m.Pix[i], m.Pix[i+3])
+		}
+	}
+
+	// 最近邻放大不产生新颜色
+	checker := image.NewGray(image.Rect(0, 0, 2, 2))
+	checker.Pix = []uint8{0, 255, 255, 0}
+	m := Resize(checker, 8, 8, FilterNearest).(*image.Gray)
+	assert.Equal(t, []uint8{0, 0, 0, 0, 255, 255, 255, 255}, m.Pix[:8])
+
+	// YCbCr 按平面缩放
+	ycc := image.NewYCbCr(src.Bounds(), image.YCbCrSubsampleRatio444)
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			c := src.RGBAAt(x, y)
+			i := ycc.YOffset(x, y)
+			ycc.Y[i], ycc.Cb[i], ycc.Cr[i] = color.RGBToYCbCr(c.R, c.G, c.B)
+		}
+	}
+	p, err = PSNR(Resize(src, 60, 45, FilterMitchell), Resize(ycc, 60, 45, FilterMitchell))
+	assert.NoError(t, err)
+	assert.Greater(t, p, 40.0)
+
+	// 像素格式
+	assert.IsType(t, &image.Gray16{}, Resize(image.NewGray16(image.Rect(0, 0, 20, 20)), 10, 10, FilterBox))
+	assert.IsType(t, &image.RGBA64{}, Resize(image.NewNRGBA64(image.Rect(0, 0, 20, 20)), 10, 10, FilterBox))
+	assert.IsType(t, &image.YCbCr{}, Resize(image.NewYCbCr(image.Rect(0, 0, 20, 20), image.YCbCrSubsampleRatio420), 10, 10, FilterBox))
+
+	// 源图的 Bounds 不从 0 开始
+	sub := src.SubImage(image.Rect(100, 75, 200, 150))
+	moved := image.NewRGBA(image.Rect(0, 0, 100, 75))
+	draw.Draw(moved, moved.Bounds(), sub, sub.Bounds().Min, draw.Src)
+	assert.Equal(t, Resize(moved, 50, 0, FilterLanczos3), Resize(sub, 50, 0, FilterLanczos3))
+}
+
+func TestThumbnailFilter(t *testing.T) {
+	src := photo(200, 150)
+	sharp, err := ThumbnailImage(src, &ThumbOption{Width: 50, Height: 50, IsFit: true, Filter: FilterLanczos3})
+	assert.NoError(t, err)
+	smooth, err := ThumbnailImage(src, &ThumbOption{Width: 50, Height: 50, IsFit: true, Filter: FilterBox})
+	assert.NoError(t, err)
+	assert.Equal(t, sharp.Bounds(), smooth.Bounds())
+	assert.NotEqual(t, sharp.(*image.RGBA).Pix, smooth.(*image.RGBA).Pix)
+}
+
+// benchmarkSources 3000x2000 的照片, 分别为 JPEG 解码的 YCbCr 及 RGBA
+func benchmarkSources() map[string]image.Image {
+	src := photo(3000, 2000)
+	m := image.NewYCbCr(src.Bounds(), image.YCbCrSubsampleRatio420)
+	for y := 0; y < 2000; y++ {
+		for x := 0; x < 3000; x++ {
+			c := src.RGBAAt(x, y)
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			m.Y[m.YOffset(x, y)] = yy
+			m.Cb[m.COffset(x, y)], m.Cr[m.COffset(x, y)] = cb, cr
+		}
+	}
+	return map[string]image.Image{"ycbcr": m, "rgba": src}
+}
+
+// BenchmarkResizeNfnt 原来 ThumbnailImage 使用的 nfnt/resize Bicubic
+func BenchmarkResizeNfnt(b *testing.B) {
+	for kind, src := range benchmarkSources() {
+		b.Run(kind, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				resize.Resize(300, 200, src, resize.Bicubic)
+			}
+		})
+	}
+}
+
+func BenchmarkResize(b *testing.B) {
+	filters := map[string]Filter{"catmullrom": FilterCatmullRom, "bilinear": FilterBilinear, "lanczos3": FilterLanczos3, "box": FilterBox}
+	for kind, src := range benchmarkSources() {
+		for name, f := range filters {
+			b.Run(kind+"/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					Resize(src, 300, 200, f)
+				}
+			})
+		}
+	}
+}
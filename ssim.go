@@ -0,0 +1,175 @@
+package image
+
+import (
+	"image"
+	"math"
+)
+
+// SSIM, 见 Wang et al. "Image quality assessment: from error visibility to structural similarity"
+// 使用 11x11, σ=1.5 的高斯窗口, 大图按短边约 256 先平均缩小
+
+const (
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+var ssimKernel = gaussianKernel(11, 1.5)
+
+func gaussianKernel(n int, sigma float64) []float32 {
+	k := make([]float32, n)
+	var sum float64
+	for i := range k {
+		x := float64(i - n/2)
+		v := math.Exp(-x * x / (2 * sigma * sigma))
+		k[i] = float32(v)
+		sum += v
+	}
+	for i := range k {
+		k[i] /= float32(sum)
+	}
+	return k
+}
+
+// plane 单通道的浮点像素, 取值 0-255
+type plane struct {
+	w, h int
+	pix  []float32
+}
+
+func newPlane(w, h int) *plane {
+	return &plane{w: w, h: h, pix: make([]float32, w*h)}
+}
+
+// lumaPlane 按 BT.601 计算亮度, 有透明时为预乘的值
+func lumaPlane(m image.Image) *plane {
+	b := m.Bounds()
+	p := newPlane(b.Dx(), b.Dy())
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := m.At(x, y).RGBA()
+			p.pix[i] = float32(0.299*float64(r)+0.587*float64(g)+0.114*float64(bl)) / 257
+			i++
+		}
+	}
+	return p
+}
+
+// downsample 按 f x f 的块取平均缩小
+func (p *plane) downsample(f int) *plane {
+	if f <= 1 {
+		return p
+	}
+	out := newPlane(p.w/f, p.h/f)
+	scale := 1 / float32(f*f)
+	for y := 0; y < out.h; y++ {
+		for x := 0; x < out.w; x++ {
+			var sum float32
+			for dy := 0; dy < f; dy++ {
+				row := p.pix[(y*f+dy)*p.w+x*f:]
+				for dx := 0; dx < f; dx++ {
+					sum += row[dx]
+				}
+			}
+			out.pix[y*out.w+x] = sum * scale
+		}
+	}
+	return out
+}
+
+// blur 可分离的卷积, 边缘取最近的像素
+func (p *plane) blur(k []float32) *plane {
+	r := len(k) / 2
+	tmp := newPlane(p.w, p.h)
+	for y := 0; y < p.h; y++ {
+		row := p.pix[y*p.w : (y+1)*p.w]
+		for x := 0; x < p.w; x++ {
+			var sum float32
+			for i, kv := range k {
+				sum += kv * row[min(max(x+i-r, 0), p.w-1)]
+			}
+			tmp.pix[y*p.w+x] = sum
+		}
+	}
+	out := newPlane(p.w, p.h)
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			var sum float32
+			for i, kv := range k {
+				sum += kv * tmp.pix[min(max(y+i-r, 0), p.h-1)*p.w+x]
+			}
+			out.pix[y*p.w+x] = sum
+		}
+	}
+	return out
+}
+
+// mul 逐像素相乘
+func (p *plane) mul(q *plane) *plane {
+	out := newPlane(p.w, p.h)
+	for i, v := range p.pix {
+		out.pix[i] = v * q.pix[i]
+	}
+	return out
+}
+
+// ssimScale 缩小的倍数, 使短边约为 256
+func ssimScale(w, h int) int {
+	return max(1, int(math.Round(float64(min(w, h))/256)))
+}
+
+// ssimMap 返回平均 SSIM, 平均的对比度-结构项 (用于 MS-SSIM) 及每个像素的 SSIM, a 与 b 的尺寸须相同
+func ssimMap(a, b *plane) (float64, float64, *plane) {
+	muA, muB := a.blur(ssimKernel), b.blur(ssimKernel)
+	aa, bb, ab := a.mul(a).blur(ssimKernel), b.mul(b).blur(ssimKernel), a.mul(b).blur(ssimKernel)
+	out := newPlane(a.w, a.h)
+	var sum, csSum float64
+	for i := range out.pix {
+		ma, mb := float64(muA.pix[i]), float64(muB.pix[i])
+		va, vb := float64(aa.pix[i])-ma*ma, float64(bb.pix[i])-mb*mb
+		cov := float64(ab.pix[i]) - ma*mb
+		cs := (2*cov + ssimC2) / (va + vb + ssimC2)
+		s := (2*ma*mb + ssimC1) / (ma*ma + mb*mb + ssimC1) * cs
+		out.pix[i] = float32(s)
+		sum += s
+		csSum += cs
+	}
+	if len(out.pix) == 0 {
+		return 1, 1, out
+	}
+	n := float64(len(out.pix))
+	return sum / n, csSum / n, out
+}
+
+// ssimLuma 两个同尺寸图像亮度的 SSIM
+func ssimLuma(a, b image.Image) float64 {
+	f := ssimScale(a.Bounds().Dx(), a.Bounds().Dy())
+	s, _, _ := ssimMap(lumaPlane(a).downsample(f), lumaPlane(b).downsample(f))
+	return s
+}
+
+// msssimWeights MS-SSIM 各尺度的权重, 见 Wang et al. "Multi-scale structural similarity"
+var msssimWeights = []float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// msssim 每个尺度缩小一半, 短边小于窗口时减少尺度并重新归一化权重
+func msssim(a, b *plane) float64 {
+	n := 1
+	for n < len(msssimWeights) && min(a.w, a.h)>>n >= len(ssimKernel) {
+		n++
+	}
+	var total float64
+	for _, w := range msssimWeights[:n] {
+		total += w
+	}
+	out := 1.0
+	for i, w := range msssimWeights[:n] {
+		s, cs, _ := ssimMap(a, b)
+		v := cs
+		if i == n-1 {
+			v = s
+		}
+		out *= math.Pow(max(v, 0), w/total)
+		a, b = a.downsample(2), b.downsample(2)
+	}
+	return out
+}
@@ -0,0 +1,343 @@
+package image
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// TGA (Truevision), 见 http://www.paulbourke.net/dataformats/tga/
+// 解码支持调色板, 灰度及真彩色, 未压缩及 RLE; 编码输出 RLE 压缩的灰度或真彩色
+
+// TGA image types
+const (
+	tgaColorMapped = 1
+	tgaTrueColor   = 2
+	tgaGray        = 3
+	tgaRLE         = 8 // 与以上相加为 RLE 压缩的类型
+)
+
+// descriptor bits
+const (
+	tgaRightToLeft = 0x10
+	tgaTopToBottom = 0x20
+)
+
+const (
+	tgaHeaderSize = 18
+	tgaFooter     = "TRUEVISION-XFILE.\x00"
+)
+
+type tgaHeader struct {
+	idLength   uint8
+	cmapType   uint8
+	imageType  uint8
+	cmapFirst  int
+	cmapLength int
+	cmapDepth  int
+	width      int
+	height     int
+	depth      int
+	descriptor uint8
+}
+
+func readTGAHeader(r io.Reader) (*tgaHeader, error) {
+	var b [tgaHeaderSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	h := &tgaHeader{
+		idLength:   b[0],
+		cmapType:   b[1],
+		imageType:  b[2],
+		cmapFirst:  int(binary.LittleEndian.Uint16(b[3:])),
+		cmapLength: int(binary.LittleEndian.Uint16(b[5:])),
+		cmapDepth:  int(b[7]),
+		width:      int(binary.LittleEndian.Uint16(b[12:])),
+		height:     int(binary.LittleEndian.Uint16(b[14:])),
+		depth:      int(b[16]),
+		descriptor: b[17],
+	}
+	if h.width == 0 || h.height == 0 || h.cmapType > 1 {
+		return nil, ErrInvalidFormat
+	}
+	switch h.imageType &^ tgaRLE {
+	case tgaColorMapped:
+		if h.cmapType != 1 || h.depth != 8 || h.cmapFirst+h.cmapLength > 256 {
+			return nil, ErrUnsupportFormat
+		}
+		if !validTGADepth(h.cmapDepth) {
+			return nil, ErrInvalidFormat
+		}
+	case tgaTrueColor:
+		if !validTGADepth(h.depth) {
+			return nil, ErrInvalidFormat
+		}
+	case tgaGray:
+		if h.depth != 8 {
+			return nil, ErrUnsupportFormat
+		}
+	default:
+		return nil, ErrInvalidFormat
+	}
+	return h, nil
+}
+
+// tgaMagics TGA 没有文件头标识, 按前 17 字节中调色板类型, 图像类型, 色表及像素位深识别;
+// 没有色表时色表的字段为 0
+func tgaMagics() []string {
+	const any8 = "????????" // x/y 原点, 宽, 高
+	var out []string
+	for _, typ := range []byte{tgaTrueColor, tgaTrueColor | tgaRLE} {
+		for _, depth := range []byte{15, 16, 24, 32} {
+			out = append(out, "?\x00"+string([]byte{typ})+"\x00\x00\x00\x00\x00"+any8+string([]byte{depth}))
+		}
+	}
+	for _, typ := range []byte{tgaGray, tgaGray | tgaRLE} {
+		out = append(out, "?\x00"+string([]byte{typ})+"\x00\x00\x00\x00\x00"+any8+"\x08")
+	}
+	for _, typ := range []byte{tgaColorMapped, tgaColorMapped | tgaRLE} {
+		for _, depth := range []byte{15, 16, 24, 32} {
+			out = append(out, "?\x01"+string([]byte{typ})+"????"+string([]byte{depth})+any8+"\x08")
+		}
+	}
+	return out
+}
+
+func validTGADepth(d int) bool {
+	return d == 15 || d == 16 || d == 24 || d == 32
+}
+
+// alphaBits descriptor 中的 alpha 位数, 为 0 时忽略像素中的 alpha
+func (h *tgaHeader) alphaBits() int {
+	return int(h.descriptor & 0x0f)
+}
+
+func (h *tgaHeader) colorModel(pal color.Palette) color.Model {
+	switch h.imageType &^ tgaRLE {
+	case tgaColorMapped:
+		return pal
+	case tgaGray:
+		return color.GrayModel
+	}
+	return color.NRGBAModel
+}
+
+// tgaColor 按位深解析一个 BGR(A) 像素
+func (h *tgaHeader) tgaColor(p []byte, depth int) color.NRGBA {
+	switch depth {
+	case 15, 16:
+		v := binary.LittleEndian.Uint16(p)
+		c := color.NRGBA{
+			R: uint8(v >> 10 & 0x1f * 255 / 31),
+			G: uint8(v >> 5 & 0x1f * 255 / 31),
+			B: uint8(v & 0x1f * 255 / 31),
+			A: 0xff,
+		}
+		if depth == 16 && h.alphaBits() == 1 && v&0x8000 == 0 {
+			c.A = 0
+		}
+		return c
+	case 24:
+		return color.NRGBA{p[2], p[1], p[0], 0xff}
+	}
+	c := color.NRGBA{p[2], p[1], p[0], p[3]}
+	if h.alphaBits() == 0 {
+		c.A = 0xff
+	}
+	return c
+}
+
+func tgaDecodeConfig(r io.Reader) (image.Config, error) {
+	br := bufio.NewReader(r)
+	h, err := readTGAHeader(br)
+	if err != nil {
+		return image.Config{}, err
+	}
+	pal, err := h.readColorMap(br)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(pal), Width: h.width, Height: h.height}, nil
+}
+
+// readColorMap 跳过图像 ID 并读取调色板
+func (h *tgaHeader) readColorMap(br *bufio.Reader) (color.Palette, error) {
+	if _, err := br.Discard(int(h.idLength)); err != nil {
+		return nil, err
+	}
+	if h.cmapType == 0 {
+		return nil, nil
+	}
+	size := (h.cmapDepth + 7) / 8
+	buf := make([]byte, size*h.cmapLength)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, err
+	}
+	if h.imageType&^tgaRLE != tgaColorMapped {
+		return nil, nil
+	}
+	pal := make(color.Palette, h.cmapFirst+h.cmapLength)
+	for i := range pal {
+		pal[i] = color.NRGBA{A: 0xff}
+	}
+	for i := 0; i < h.cmapLength; i++ {
+		pal[h.cmapFirst+i] = h.tgaColor(buf[i*size:], h.cmapDepth)
+	}
+	return pal, nil
+}
+
+func tgaDecode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readTGAHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	pal, err := h.readColorMap(br)
+	if err != nil {
+		return nil, err
+	}
+	size := (h.depth + 7) / 8
+	data := make([]byte, h.width*h.height*size)
+	if h.imageType&tgaRLE == 0 {
+		_, err = io.ReadFull(br, data)
+	} else {
+		err = readTGARLE(br, data, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	var m image.Image
+	var set func(x, y int, p []byte)
+	switch h.imageType &^ tgaRLE {
+	case tgaColorMapped:
+		pm := image.NewPaletted(rect, pal)
+		m, set = pm, func(x, y int, p []byte) { pm.Pix[y*pm.Stride+x] = min(p[0], uint8(len(pal)-1)) }
+	case tgaGray:
+		gm := image.NewGray(rect)
+		m, set = gm, func(x, y int, p []byte) { gm.Pix[y*gm.Stride+x] = p[0] }
+	default:
+		nm := image.NewNRGBA(rect)
+		m, set = nm, func(x, y int, p []byte) { nm.SetNRGBA(x, y, h.tgaColor(p, h.depth)) }
+	}
+	// 默认从左下角开始
+	for i := 0; i < h.width*h.height; i++ {
+		x, y := i%h.width, i/h.width
+		if h.descriptor&tgaRightToLeft != 0 {
+			x = h.width - 1 - x
+		}
+		if h.descriptor&tgaTopToBottom == 0 {
+			y = h.height - 1 - y
+		}
+		set(x, y, data[i*size:])
+	}
+	return m, nil
+}
+
+// readTGARLE 解压 RLE 数据, 包可以跨行
+func readTGARLE(br *bufio.Reader, data []byte, size int) error {
+	for i := 0; i < len(data); {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		n := (int(c&0x7f) + 1) * size
+		if i+n > len(data) {
+			return ErrInvalidFormat
+		}
+		if c&0x80 == 0 {
+			if _, err = io.ReadFull(br, data[i:i+n]); err != nil {
+				return err
+			}
+		} else {
+			if _, err = io.ReadFull(br, data[i:i+size]); err != nil {
+				return err
+			}
+			for j := i + size; j < i+n; j += size {
+				copy(data[j:j+size], data[i:i+size])
+			}
+		}
+		i += n
+	}
+	return nil
+}
+
+// encodeTGA 编码为从左上角开始的 RLE 压缩 TGA, 灰度图为 8 位, 其余为 24 或 32 位
+func encodeTGA(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	if b.Dx() > 0xffff || b.Dy() > 0xffff {
+		return ErrImageTooLarge
+	}
+	hdr := make([]byte, tgaHeaderSize)
+	binary.LittleEndian.PutUint16(hdr[12:], uint16(b.Dx()))
+	binary.LittleEndian.PutUint16(hdr[14:], uint16(b.Dy()))
+	hdr[17] = tgaTopToBottom
+
+	var pix []byte // 每行 BGR(A) 或灰度
+	var stride, size int
+	switch gm := m.(type) {
+	case *image.Gray:
+		hdr[2], hdr[16] = tgaGray|tgaRLE, 8
+		pix, stride, size = gm.Pix[gm.PixOffset(b.Min.X, b.Min.Y):], gm.Stride, 1
+	default:
+		src := image.NewNRGBA(b)
+		draw.Draw(src, b, m, b.Min, draw.Src)
+		hdr[2], hdr[16], size = tgaTrueColor|tgaRLE, 24, 3
+		if !isOpaque(src) {
+			hdr[16], size = 32, 4
+			hdr[17] |= 8
+		}
+		pix, stride = make([]byte, b.Dx()*b.Dy()*size), b.Dx()*size
+		for i, j := 0, 0; i < len(src.Pix); i, j = i+4, j+size {
+			p := src.Pix[i:]
+			pix[j], pix[j+1], pix[j+2] = p[2], p[1], p[0]
+			if size == 4 {
+				pix[j+3] = p[3]
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	_, _ = bw.Write(hdr)
+	for y := 0; y < b.Dy(); y++ {
+		writeTGARLE(bw, pix[y*stride:y*stride+b.Dx()*size], size)
+	}
+	_, _ = bw.Write(make([]byte, 8)) // 无扩展区及开发者区
+	_, _ = bw.WriteString(tgaFooter)
+	return bw.Flush()
+}
+
+// writeTGARLE 压缩一行, 连续 2 个以上相同的像素使用重复包
+func writeTGARLE(bw *bufio.Writer, row []byte, size int) {
+	n := len(row) / size
+	px := func(i int) []byte { return row[i*size : i*size+size] }
+	same := func(i, j int) bool { return string(px(i)) == string(px(j)) }
+	for i := 0; i < n; {
+		run := 1
+		for i+run < n && run < 128 && same(i, i+run) {
+			run++
+		}
+		if run > 1 {
+			_ = bw.WriteByte(0x80 | byte(run-1))
+			_, _ = bw.Write(px(i))
+			i += run
+			continue
+		}
+		// 原样包直到出现相同的相邻像素
+		raw := 1
+		for i+raw < n && raw < 128 && (i+raw+1 >= n || !same(i+raw, i+raw+1)) {
+			raw++
+		}
+		_ = bw.WriteByte(byte(raw - 1))
+		_, _ = bw.Write(row[i*size : (i+raw)*size])
+		i += raw
+	}
+}
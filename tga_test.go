@@ -0,0 +1,101 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTGA(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 300, 5))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i / 50 * 40) // 超过 128 个像素的重复
+	}
+	alpha := image.NewNRGBA(image.Rect(0, 0, 37, 21))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = uint8(i * 13)
+	}
+	for _, m := range []image.Image{photo(120, 90), gradient(23, 17), gray, alpha, alpha.SubImage(image.Rect(3, 2, 20, 9))} {
+		var buf bytes.Buffer
+		assert.NoError(t, encodeTGA(&buf, m))
+		assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte(tgaFooter)))
+		got, name, err := image.Decode(&buf)
+		if assert.NoError(t, err) {
+			assert.Equal(t, FormatTGA, name)
+			samePixels(t, m, translateTo(got, m.Bounds().Min))
+		}
+	}
+}
+
+func TestTGADecode(t *testing.T) {
+	red, green, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 255, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	hdr := func(cmap, typ, depth, desc byte) []byte {
+		return []byte{0, cmap, typ, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 2, 0, depth, desc}
+	}
+
+	// 未压缩 24 位, 从左下角开始
+	data := append(hdr(0, tgaTrueColor, 24, 0), 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255)
+	m, err := tgaDecode(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, blue, m.At(0, 0))
+		assert.Equal(t, color.NRGBA{255, 255, 255, 255}, m.At(1, 0))
+		assert.Equal(t, red, m.At(0, 1))
+		assert.Equal(t, green, m.At(1, 1))
+	}
+
+	// RLE 调色板, 重复包跨行, 从右上角开始
+	data = hdr(1, tgaColorMapped|tgaRLE, 8, tgaTopToBottom|tgaRightToLeft)
+	data[5], data[7] = 3, 24 // 3 种颜色
+	data = append(data, 0, 0, 255, 0, 255, 0, 255, 0, 0)
+	data = append(data, 0x82, 1, 0x00, 2)
+	m, err = tgaDecode(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, green, m.At(1, 0))
+		assert.Equal(t, green, m.At(0, 0))
+		assert.Equal(t, green, m.At(1, 1))
+		assert.Equal(t, blue, m.At(0, 1))
+	}
+
+	// 16 位, alpha 位为 1 时使用最高位
+	data = append(hdr(0, tgaTrueColor, 16, tgaTopToBottom|1), 0x00, 0xfc, 0x00, 0x7c, 0xe0, 0x83, 0x1f, 0x00)
+	m, err = tgaDecode(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, red, m.At(0, 0))
+		assert.Equal(t, color.NRGBA{255, 0, 0, 0}, m.At(1, 0))
+		assert.Equal(t, green, m.At(0, 1))
+		assert.Equal(t, color.NRGBA{0, 0, 255, 0}, m.At(1, 1))
+	}
+
+	// 32 位但 alpha 位为 0 时不透明
+	data = append(hdr(0, tgaTrueColor, 32, tgaTopToBottom), make([]byte, 16)...)
+	m, err = tgaDecode(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, color.NRGBA{A: 255}, m.At(0, 0))
+	}
+
+	// RLE 包超出图像
+	data = append(hdr(0, tgaGray|tgaRLE, 8, 0), 0x84, 0)
+	_, err = tgaDecode(bytes.NewReader(data))
+	assert.Equal(t, ErrInvalidFormat, err)
+	_, err = tgaDecode(bytes.NewReader(hdr(0, 5, 8, 0)))
+	assert.Equal(t, ErrInvalidFormat, err)
+}
+
+func TestTGAMagic(t *testing.T) {
+	// 只有图像类型与 TGA 相同的数据不识别为 TGA
+	data := append([]byte("\x00\x00\x02\x41\x42\x43\x44\x45"), make([]byte, 32)...)
+	_, _, err := image.DecodeConfig(bytes.NewReader(data))
+	assert.Equal(t, image.ErrFormat, err)
+
+	assert.Len(t, tgaMagics(), 18)
+	for _, m := range []image.Image{photo(40, 30), image.NewGray(image.Rect(0, 0, 5, 5))} {
+		var buf bytes.Buffer
+		assert.NoError(t, encodeTGA(&buf, m))
+		_, name, err := image.DecodeConfig(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, FormatTGA, name)
+	}
+}
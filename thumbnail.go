@@ -8,8 +8,6 @@ import (
 	"log/slog"
 	"os"
 	"path"
-
-	"github.com/nfnt/resize"
 )
 
 // ThumbOption 缩图选项
@@ -20,8 +18,11 @@ type ThumbOption struct {
 	IsCrop              bool // 是否裁切
 	CropX, CropY        int  // 裁切位置
 
+	Filter Filter // 缩放的插值方法, 默认为 Catmull-Rom
+
 	ctWidth, ctHeight uint // for crop temporary
 
+	ReadOption
 	WriteOption
 }
 
@@ -112,66 +113,84 @@ func ThumbnailImage(img image.Image, topt *ThumbOption) (image.Image, error) {
 	// slog.Debug("ThumbnailImage", "topt", topt)
 	if topt.IsFit {
 		if topt.IsCrop {
-			buf := resize.Resize(topt.ctWidth, topt.ctHeight, img, resize.Bicubic)
-			dst := image.NewRGBA(image.Rect(0, 0, int(topt.Width), int(topt.Height)))
+			buf := Resize(img, int(topt.ctWidth), int(topt.ctHeight), topt.Filter)
+			dst := newImageLike(buf, image.Rect(0, 0, int(topt.Width), int(topt.Height)))
 			pt := image.Point{topt.CropX, topt.CropY}
 			draw.Draw(dst, dst.Bounds(), buf, pt, draw.Src)
-			return dst, nil
+			return matchDepth(img, dst), nil
 		}
 	}
-	m := resize.Resize(topt.Width, topt.Height, img, resize.Bicubic)
-	return m, nil
+	m := Resize(img, int(topt.Width), int(topt.Height), topt.Filter)
+	return matchDepth(img, m), nil
 }
 
 // Thumbnail ...
-func Thumbnail(r io.Reader, w io.Writer, topt *ThumbOption) error {
+func Thumbnail(r io.Reader, w io.Writer, topt *ThumbOption) (*Output, error) {
+	// 在副本上补全格式及元数据, 不写回调用者的选项
+	t := *topt
+	return thumbnail(r, w, &t)
+}
+
+func thumbnail(r io.Reader, w io.Writer, topt *ThumbOption) (*Output, error) {
 	var err error
-	im, format, err := image.Decode(r)
+	if topt.KeepMeta != MetaNone && topt.Metadata == nil {
+		r, topt.Metadata, err = readMetaWith(r, &topt.ReadOption)
+		if err != nil {
+			return nil, err
+		}
+	}
+	im, anim, format, srgb, err := decodeWith(r, &topt.ReadOption, true)
 	if err != nil {
 		slog.Info("Thumbnail image decode fail", "err", err)
-		return err
+		return nil, err
 	}
 	if topt.Format == "" {
-		topt.Format = format
+		topt.Format = outputFormat(format)
 	}
+	topt.srgb = srgb
 
-	err = ThumbnailImageTo(im, w, topt)
-	if err != nil {
-		if err == ErrOrigTooSmall {
-			if rr, ok := r.(io.Seeker); ok {
-				_, _ = rr.Seek(0, 0)
-			}
-			var written int64
-			written, err = io.Copy(w, r)
-			if err == nil {
-				slog.Debug("copied", "n", written)
-				return nil
-			}
-			slog.Info("copy fail", "err", err)
-		}
+	if anim != nil {
+		return ThumbnailAnimationTo(anim, w, topt)
 	}
-	return err
+	return ThumbnailImageTo(im, w, topt)
 }
 
 // ThumbnailImageTo ...
-func ThumbnailImageTo(im image.Image, w io.Writer, topt *ThumbOption) error {
+func ThumbnailImageTo(im image.Image, w io.Writer, topt *ThumbOption) (*Output, error) {
 	m, err := ThumbnailImage(im, topt)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	opt := &topt.WriteOption
-	err = SaveTo(w, m, opt)
+	out, err := SaveTo(w, m, opt)
 	if err != nil {
 		slog.Info("save to", "err", err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	return out, nil
+}
+
+// ThumbnailAnimationTo ...
+func ThumbnailAnimationTo(a *Animation, w io.Writer, topt *ThumbOption) (*Output, error) {
+	anim, err := ThumbnailAnimation(a, topt)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := &topt.WriteOption
+	out, err := SaveAnimationTo(w, anim, opt)
+	if err != nil {
+		slog.Info("save animation to", "err", err)
+		return nil, err
+	}
+
+	return out, nil
 }
 
 // ThumbnailFile ...
-func ThumbnailFile(src, dest string, topt *ThumbOption) (err error) {
+func ThumbnailFile(src, dest string, topt *ThumbOption) (output *Output, err error) {
 	var in *os.File
 	in, err = os.Open(src)
 	if err != nil {
@@ -194,7 +213,7 @@ func ThumbnailFile(src, dest string, topt *ThumbOption) (err error) {
 	}
 	defer out.Close()
 
-	err = Thumbnail(in, out, topt)
+	output, err = Thumbnail(in, out, topt)
 
 	return
 }
@@ -3,10 +3,17 @@ package image
 import (
 	"bytes"
 	"encoding/base64"
+	"image"
+	"image/color"
+	"image/color/palette"
 	_ "image/jpeg" // test
+	"image/png"
+
 	// "strings"
 	"log"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 var (
@@ -37,7 +44,7 @@ func TestThumbnails(t *testing.T) {
 
 	// var err error
 	for i, topt := range topts {
-		err = Thumbnail(bytes.NewReader(data), &buf, &topt)
+		_, err = Thumbnail(bytes.NewReader(data), &buf, &topt)
 		if err != nil {
 			t.Fatalf("Thumbnail '%s' error: %s", &topt, err)
 		}
@@ -45,3 +52,46 @@ func TestThumbnails(t *testing.T) {
 	}
 	// t.Fatal("fail")
 }
+
+// deepPNG a 16-bit png with values not representable in 8 bits
+func deepPNG(t *testing.T) []byte {
+	m := image.NewNRGBA64(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			m.SetNRGBA64(x, y, color.NRGBA64{uint16(x*1000 + 1), uint16(y*1000 + 3), 0x8001, 0xffff})
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, m)
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestThumbnailDeep(t *testing.T) {
+	data := deepPNG(t)
+	attr, err := Probe(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(16), attr.BitDepth)
+
+	for _, crop := range []bool{false, true} {
+		var buf bytes.Buffer
+		_, err = Thumbnail(bytes.NewReader(data), &buf, &ThumbOption{Width: 32, Height: 32, IsFit: true, IsCrop: crop})
+		assert.NoError(t, err)
+		m, err := png.Decode(&buf)
+		assert.NoError(t, err)
+		assert.True(t, isDeep(m), "crop %v", crop)
+		_, _, b, _ := m.At(5, 5).RGBA()
+		assert.NotEqual(t, uint32(0), b%257, "crop %v", crop)
+	}
+
+	// 8 位的调色板图像仍输出 8 位
+	pm := image.NewPaletted(image.Rect(0, 0, 64, 48), palette.Plan9)
+	m, err := ThumbnailImage(pm, &ThumbOption{Width: 32, Height: 32, IsFit: true})
+	assert.NoError(t, err)
+	assert.False(t, isDeep(m))
+
+	jpeg, _ := base64.StdEncoding.DecodeString(jpegData)
+	attr, err = Probe(bytes.NewReader(jpeg))
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(8), attr.BitDepth)
+}
@@ -0,0 +1,115 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// tiffMaxPages 遍历 IFD 链的上限, 防止循环引用
+const tiffMaxPages = 10000
+
+func isTIFF(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte("II\x2a\x00")) || bytes.HasPrefix(magic, []byte("MM\x00\x2a"))
+}
+
+// tiffIFDs 返回 TIFF 中全部 IFD 的偏移, 即每一页
+func tiffIFDs(data []byte) ([]uint32, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidFormat
+	}
+	var bo binary.ByteOrder
+	switch string(data[:4]) {
+	case "II\x2a\x00":
+		bo = binary.LittleEndian
+	case "MM\x00\x2a":
+		bo = binary.BigEndian
+	default:
+		return nil, ErrInvalidFormat
+	}
+	var ifds []uint32
+	off := bo.Uint32(data[4:])
+	for off != 0 && len(ifds) < tiffMaxPages {
+		if int64(off)+2 > int64(len(data)) {
+			return nil, ErrInvalidFormat
+		}
+		next := int64(off) + 2 + 12*int64(bo.Uint16(data[off:]))
+		if next+4 > int64(len(data)) {
+			return nil, ErrInvalidFormat
+		}
+		ifds = append(ifds, off)
+		off = bo.Uint32(data[next:])
+	}
+	return ifds, nil
+}
+
+// tiffPage 把第 page 页改为第一页, 以便只解码第一页的解码器读取; 会修改 data
+func tiffPage(data []byte, page int) ([]byte, error) {
+	ifds, err := tiffIFDs(data)
+	if err != nil {
+		return nil, err
+	}
+	if page < 0 || page >= len(ifds) {
+		return nil, ErrPageNotFound
+	}
+	if data[0] == 'I' {
+		binary.LittleEndian.PutUint32(data[4:], ifds[page])
+	} else {
+		binary.BigEndian.PutUint32(data[4:], ifds[page])
+	}
+	return data, nil
+}
+
+// readTIFFPage 读取多页 TIFF 第 page 页的数据及尺寸, 数据已检查过 IFD 偏移
+func readTIFFPage(r io.Reader, page int, l *Limits) ([]byte, image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, image.Config{}, err
+	}
+	if data, err = tiffPage(data, page); err != nil {
+		return nil, image.Config{}, err
+	}
+	cfg, err := tiff.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, cfg, err
+	}
+	return data, cfg, l.Check(cfg)
+}
+
+// decodeTIFFPage 解码多页 TIFF 的第 page 页
+func decodeTIFFPage(r io.Reader, page int, l *Limits) (image.Image, error) {
+	data, _, err := readTIFFPage(r, page, l)
+	if err != nil {
+		return nil, err
+	}
+	return tiff.Decode(bytes.NewReader(data))
+}
+
+// tiffDecode 与 tiff.Decode 相同, 先检查 IFD 偏移
+func tiffDecode(r io.Reader) (image.Image, error) {
+	return decodeTIFFPage(r, 0, &Limits{})
+}
+
+// tiffDecodeConfig 与 tiff.DecodeConfig 相同, 先检查 IFD 偏移
+func tiffDecodeConfig(r io.Reader) (image.Config, error) {
+	_, cfg, err := readTIFFPage(r, 0, &Limits{})
+	return cfg, err
+}
+
+// readPages 读取多页 TIFF 的页数
+func (im *Image) readPages() {
+	if im.Format != FormatTIFF || im.rs == nil {
+		return
+	}
+	_, _ = im.rs.Seek(0, io.SeekStart)
+	data, err := io.ReadAll(im.ropt.limits().reader(im.rs))
+	if err != nil {
+		return
+	}
+	if ifds, err := tiffIFDs(data); err == nil && len(ifds) > 1 {
+		im.Pages = len(ifds)
+	}
+}
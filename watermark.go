@@ -31,6 +31,7 @@ type WaterOption struct {
 	Pos      Position
 	Opacity  Opacity
 	Filename string
+	ReadOption
 	WriteOption
 }
 
@@ -94,7 +95,10 @@ func WatermarkImage(img, water image.Image, pos Position, opacity Opacity) (imag
 	offset := GetPoint(sm, wm, pos)
 	// log.Printf("watermark offset %s", offset)
 	b := img.Bounds()
-	m := image.NewRGBA(b)
+	var m draw.Image = image.NewRGBA(b)
+	if isDeep(img) {
+		m = image.NewRGBA64(b)
+	}
 	wb := water.Bounds()
 
 	if opacity == 0 {
@@ -113,16 +117,24 @@ func WatermarkImage(img, water image.Image, pos Position, opacity Opacity) (imag
 // Watermark ...
 func Watermark(r, wr io.Reader, w io.Writer, wo WaterOption) error {
 
-	im, format, err := image.Decode(r)
+	if wo.KeepMeta != MetaNone && wo.Metadata == nil {
+		var err error
+		r, wo.Metadata, err = readMetaWith(r, &wo.ReadOption)
+		if err != nil {
+			return err
+		}
+	}
+	im, _, format, srgb, err := decodeWith(r, &wo.ReadOption, false)
 	if err != nil {
 		slog.Info("watermark: decode fail", "err", err)
 		return err
 	}
 	if wo.Format == "" {
-		wo.Format = format
+		wo.Format = outputFormat(format)
 	}
+	wo.srgb = srgb
 
-	water, _, err := image.Decode(wr)
+	water, _, err := decodeLimited(wr, wo.limits())
 	if err != nil {
 		slog.Info("watermark: decode water fail", "err", err)
 		return err
@@ -134,7 +146,7 @@ func Watermark(r, wr io.Reader, w io.Writer, wo WaterOption) error {
 	}
 
 	opt := &wo.WriteOption
-	err = SaveTo(w, m, opt)
+	_, err = SaveTo(w, m, opt)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,70 @@
+package image
+
+import (
+	"image"
+	"image/draw"
+	"io"
+)
+
+// WebpEncodable 是否可以编码 WebP; 没有 libwebp 时使用纯 Go 的编码器
+const WebpEncodable = true
+
+// webpMaxSize WebP 的最大边长
+const webpMaxSize = 1 << 14
+
+// encodeWebP 纯 Go 的 WebP 编码, 无损输出 VP8L, 有损输出 VP8, 有透明时 alpha 以无损压缩存入 ALPH;
+// method 用于无损的 VP8L 及 ALPH
+func encodeWebP(w io.Writer, m image.Image, qlt float32, o *WebPOption) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return ErrEmptyImage
+	}
+	if b.Dx() > webpMaxSize || b.Dy() > webpMaxSize {
+		return ErrImageTooLarge
+	}
+	lossless := false
+	if o != nil {
+		lossless = o.lossless(m)
+		m = o.prepare(m, lossless)
+	}
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Rect, m, m.Bounds().Min, draw.Src)
+
+	var chunks []riffChunk
+	switch {
+	case lossless:
+		if !o.Exact {
+			// 透明区域的 RGB 不可见, 清零以便压缩
+			for i := 0; i < len(src.Pix); i += 4 {
+				if src.Pix[i+3] == 0 {
+					src.Pix[i], src.Pix[i+1], src.Pix[i+2] = 0, 0, 0
+				}
+			}
+		}
+		chunks = []riffChunk{{fourcc: "VP8L", data: encodeVP8L(src, o.method(), true)}}
+	case isOpaque(src):
+		chunks = []riffChunk{{fourcc: "VP8 ", data: encodeVP8(src, qlt)}}
+	default:
+		vp8x := make([]byte, 10)
+		vp8x[0] = vp8xAlpha
+		putUint24(vp8x[4:], uint32(b.Dx()-1))
+		putUint24(vp8x[7:], uint32(b.Dy()-1))
+		chunks = []riffChunk{
+			{fourcc: "VP8X", data: vp8x},
+			{fourcc: "ALPH", data: encodeAlpha(src, o.method())},
+			{fourcc: "VP8 ", data: encodeVP8(src, qlt)},
+		}
+	}
+	_, err := w.Write(writeRiffChunks(chunks))
+	return err
+}
+
+// encodeAlpha ALPH 块的内容: 无预测滤波, alpha 放在绿色通道以不带头的 VP8L 压缩
+func encodeAlpha(m *image.NRGBA, method int) []byte {
+	a := image.NewNRGBA(m.Rect)
+	for i := 0; i < len(m.Pix); i += 4 {
+		a.Pix[i+1] = m.Pix[i+3]
+		a.Pix[i+3] = 0xff
+	}
+	return append([]byte{0x01}, encodeVP8L(a, method, false)...)
+}
@@ -0,0 +1,132 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/vp8"
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebPLossless(t *testing.T) {
+	alpha := image.NewNRGBA(image.Rect(0, 0, 37, 21))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = uint8(i * 13)
+	}
+	pal := image.NewPaletted(image.Rect(0, 0, 13, 5), color.Palette{color.Black, color.White, color.NRGBA{255, 0, 0, 128}})
+	for i := range pal.Pix {
+		pal.Pix[i] = uint8(i % 3)
+	}
+	many := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for i := range many.Pix {
+		many.Pix[i] = uint8(i/4%200) | 0x01
+	}
+	dot := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	dot.Pix[0], dot.Pix[3] = 200, 255
+	images := []image.Image{photo(70, 50), gradient(23, 17), alpha, pal, many, dot, photo(40, 40).SubImage(image.Rect(3, 5, 30, 21))}
+
+	for _, m := range images {
+		for _, method := range []int{0, 1, 6} {
+			var buf bytes.Buffer
+			err := encodeWebP(&buf, m, 80, &WebPOption{Lossless: true, Exact: true, Method: method})
+			assert.NoError(t, err)
+			got, err := webp.Decode(&buf)
+			if assert.NoError(t, err) {
+				samePixels(t, m, translateTo(got, m.Bounds().Min))
+			}
+		}
+	}
+
+	// 非 Exact 时透明像素的 RGB 清零
+	alpha.Pix[3] = 0
+	var buf bytes.Buffer
+	assert.NoError(t, encodeWebP(&buf, alpha, 80, &WebPOption{Lossless: true}))
+	got, err := webp.Decode(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, color.NRGBA{}, color.NRGBAModel.Convert(got.At(0, 0)))
+
+	assert.Equal(t, ErrEmptyImage, encodeWebP(&buf, image.NewNRGBA(image.Rect(0, 0, 0, 5)), 80, nil))
+	assert.Equal(t, ErrImageTooLarge, encodeWebP(&buf, image.NewGray(image.Rect(0, 0, webpMaxSize+1, 1)), 80, nil))
+}
+
+func TestEncodeWebPLossy(t *testing.T) {
+	src := photo(70, 50)
+	var low, high bytes.Buffer
+	assert.NoError(t, encodeWebP(&low, src, 30, nil))
+	assert.NoError(t, encodeWebP(&high, src, 90, nil))
+	assert.Less(t, low.Len(), high.Len())
+	// x/image 按 JFIF 转换为 RGB, 与编码使用的 BT.601 有限范围不同, 只比较亮度
+	nrgba := image.NewNRGBA(src.Rect)
+	draw.Draw(nrgba, nrgba.Rect, src, image.Point{}, draw.Src)
+	e := newVP8Encoder(nrgba, 0, 0)
+	var diffs []float64
+	for _, buf := range []*bytes.Buffer{&low, &high} {
+		assert.True(t, bytes.Contains(buf.Bytes()[:20], []byte("VP8 ")))
+		got, err := webp.Decode(buf)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		m := got.(*image.YCbCr)
+		var sum int
+		for y := 0; y < 50; y++ {
+			for x := 0; x < 70; x++ {
+				sum += absInt(int(m.Y[y*m.YStride+x]) - int(e.y[y*e.yStride+x]))
+			}
+		}
+		diffs = append(diffs, float64(sum)/70/50)
+	}
+	if assert.Len(t, diffs, 2) {
+		assert.Less(t, diffs[1], diffs[0])
+		assert.Less(t, diffs[0], 4.0)
+	}
+
+	// 有透明时 alpha 无损存入 ALPH
+	fade := image.NewNRGBA(image.Rect(0, 0, 33, 19))
+	for i := range fade.Pix {
+		fade.Pix[i] = uint8(i * 7)
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, encodeWebP(&buf, fade, 80, nil))
+	assert.True(t, bytes.Contains(buf.Bytes(), []byte("ALPH")))
+	got, err := webp.Decode(&buf)
+	if assert.NoError(t, err) {
+		for y := 0; y < 19; y++ {
+			for x := 0; x < 33; x++ {
+				_, _, _, a := got.At(x, y).RGBA()
+				if !assert.Equal(t, fade.NRGBAAt(x, y).A, uint8(a>>8), "alpha %d,%d", x, y) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestVP8Reconstruct(t *testing.T) {
+	// 不做环路滤波时, 解码结果应与编码器的重建完全相同
+	src := image.NewNRGBA(image.Rect(0, 0, 45, 35))
+	draw.Draw(src, src.Rect, photo(45, 35), image.Point{}, draw.Src)
+	for _, qi := range []int{0, 40, 127} {
+		e := newVP8Encoder(src, qi, 0)
+		e.encode()
+		data := e.bytes()
+		d := vp8.NewDecoder()
+		d.Init(bytes.NewReader(data), len(data))
+		_, err := d.DecodeFrameHeader()
+		assert.NoError(t, err)
+		m, err := d.DecodeFrame()
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for y := 0; y < 35; y++ {
+			assert.Equal(t, e.ry[y*e.yStride:y*e.yStride+45], m.Y[y*m.YStride:y*m.YStride+45], "qi %d row %d", qi, y)
+		}
+		for y := 0; y < 18; y++ {
+			assert.Equal(t, e.ru[y*e.cStride:y*e.cStride+23], m.Cb[y*m.CStride:y*m.CStride+23], "qi %d row %d", qi, y)
+			assert.Equal(t, e.rv[y*e.cStride:y*e.cStride+23], m.Cr[y*m.CStride:y*m.CStride+23], "qi %d row %d", qi, y)
+		}
+	}
+}
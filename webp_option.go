@@ -0,0 +1,151 @@
+package image
+
+import (
+	"image"
+	"image/draw"
+)
+
+// WebPOption WebP 编码选项
+type WebPOption struct {
+	Lossless     bool // 无损
+	AutoLossless bool // 调色板图, 颜色不超过 256 种或有透明的图自动使用无损
+	NearLossless int  // 无损时的近无损预处理, 1-99 越小损失越多, 0 或 100 为不处理
+	AlphaQuality int  // 有损时 alpha 的质量, 1-99 越小 alpha 的级数越少, 0 或 100 为无损
+	Method       int  // 速度与压缩率的权衡 1-6, 越大越慢, 输出越小; 不大于 0 时为默认的 4
+	Exact        bool // 无损时保留透明区域的 RGB
+}
+
+// webpMethod 默认的 method, 与 libwebp 的默认值相同
+const webpMethod = 4
+
+// method 按选项取得 method, 限制在 1-6
+func (o *WebPOption) method() int {
+	if o == nil || o.Method <= 0 {
+		return webpMethod
+	}
+	return min(o.Method, 6)
+}
+
+// lossless 按选项决定是否使用无损
+func (o *WebPOption) lossless(m image.Image) bool {
+	if o == nil {
+		return false
+	}
+	return o.Lossless || o.AutoLossless && isGraphic(m)
+}
+
+// prepare 纯 Go 编码器按选项预处理像素, 与 libwebp 的 near_lossless 及 alpha_quality 相同
+func (o *WebPOption) prepare(m image.Image, lossless bool) image.Image {
+	if o == nil {
+		return m
+	}
+	if lossless && o.NearLossless > 0 && o.NearLossless < 100 {
+		return nearLossless(m, o.NearLossless)
+	}
+	if !lossless && o.AlphaQuality > 0 && o.AlphaQuality < 100 && !isOpaque(m) {
+		return quantizeAlpha(m, o.AlphaQuality)
+	}
+	return m
+}
+
+// isGraphic 是否为调色板图, 有透明或颜色不超过 256 种的图, 这类图无损通常更小
+func isGraphic(m image.Image) bool {
+	switch m.(type) {
+	case *image.Paletted:
+		return true
+	case *image.YCbCr:
+		return false
+	}
+	if !isOpaque(m) {
+		return true
+	}
+	b := m.Bounds()
+	seen := make(map[[4]uint32]struct{}, 257)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := m.At(x, y).RGBA()
+			seen[[4]uint32{r, g, bl, a}] = struct{}{}
+			if len(seen) > 256 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// nearLossless 在不平滑的像素上丢弃低位, 从 5-quality/20 位逐级减少到 1 位; 小图不处理
+func nearLossless(m image.Image, quality int) image.Image {
+	const minDim = 64
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w < minDim && h < minDim || h < 3 {
+		return m
+	}
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	for bits := 5 - quality/20; bits > 0; bits-- {
+		nearLosslessPass(dst, bits)
+	}
+	return dst
+}
+
+func nearLosslessPass(m *image.NRGBA, bits int) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	limit := 1 << bits
+	row := func(y int) []uint8 {
+		return m.Pix[y*m.Stride : y*m.Stride+w*4]
+	}
+	// 需要按原值判断是否平滑, 保留上一行及当前行的副本
+	prev := append([]uint8(nil), row(0)...)
+	cur := append([]uint8(nil), row(1)...)
+	for y := 1; y < h-1; y++ {
+		next := row(y + 1)
+		dst := row(y)
+		for x := 1; x < w-1; x++ {
+			i := x * 4
+			if near(cur[i:], cur[i-4:], limit) && near(cur[i:], cur[i+4:], limit) &&
+				near(cur[i:], prev[i:], limit) && near(cur[i:], next[i:], limit) {
+				continue
+			}
+			for k := 0; k < 4; k++ {
+				dst[i+k] = discretize(cur[i+k], bits)
+			}
+		}
+		prev, cur = cur, append(prev[:0], next...)
+	}
+}
+
+func near(a, b []uint8, limit int) bool {
+	for k := 0; k < 4; k++ {
+		if d := int(a[k]) - int(b[k]); d >= limit || d <= -limit {
+			return false
+		}
+	}
+	return true
+}
+
+// discretize 取最接近的 1<<bits 的倍数 (或 255), 相等时取偶数倍
+func discretize(v uint8, bits int) uint8 {
+	mask := 1<<bits - 1
+	biased := int(v) + mask>>1 + int(v>>bits)&1
+	if biased > 0xff {
+		return 0xff
+	}
+	return uint8(biased &^ mask)
+}
+
+// quantizeAlpha 把 alpha 均匀量化为与 libwebp 相同的级数, 保留 0 及 255
+func quantizeAlpha(m image.Image, quality int) image.Image {
+	levels := 16 + (quality-70)*8
+	if quality <= 70 {
+		levels = 2 + quality/5
+	}
+	b := m.Bounds()
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	step := 255 / float64(levels-1)
+	for i := 3; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = uint8(float64(int(float64(dst.Pix[i])/step+0.5))*step + 0.5)
+	}
+	return dst
+}
@@ -0,0 +1,101 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/webp"
+)
+
+func TestWebPOption(t *testing.T) {
+	icon := image.NewNRGBA(image.Rect(0, 0, 80, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 80; x++ {
+			if (x-40)*(x-40)+(y-40)*(y-40) < 900 {
+				icon.SetNRGBA(x, y, color.NRGBA{200, 30, 30, 255})
+			}
+		}
+	}
+	src := photo(80, 80)
+	assert.True(t, isGraphic(icon))
+	assert.True(t, isGraphic(image.NewPaletted(icon.Rect, color.Palette{color.Black})))
+	assert.False(t, isGraphic(src))
+
+	// 近无损只改变不平滑的像素, 且误差不超过 1<<bits
+	nl := nearLossless(src, 60).(*image.NRGBA)
+	assert.NotEqual(t, src.Pix, nl.Pix)
+	assert.Less(t, meanDiff(src, nl), 4.0)
+	assert.Equal(t, src.Pix[:80*4], nl.Pix[:80*4], "first row untouched")
+	small := photo(20, 20)
+	assert.Same(t, small, nearLossless(small, 0))
+	assert.Equal(t, uint8(0), discretize(1, 2))
+	assert.Equal(t, uint8(8), discretize(6, 2))
+	assert.Equal(t, uint8(255), discretize(254, 2))
+
+	soft := image.NewNRGBA(image.Rect(0, 0, 16, 1))
+	for x := 0; x < 16; x++ {
+		soft.SetNRGBA(x, 0, color.NRGBA{10, 20, 30, uint8(x * 17)})
+	}
+	qa := quantizeAlpha(soft, 10).(*image.NRGBA)
+	levels := map[uint8]bool{}
+	for i := 3; i < len(qa.Pix); i += 4 {
+		levels[qa.Pix[i]] = true
+	}
+	assert.Len(t, levels, 4)
+	assert.True(t, levels[0] && levels[255])
+
+	encode := func(m image.Image, o *WebPOption) []byte {
+		var buf bytes.Buffer
+		_, err := SaveTo(&buf, m, &WriteOption{Format: FormatWEBP, Quality: 80, WebP: o})
+		assert.NoError(t, err)
+		return buf.Bytes()
+	}
+	isVP8L := func(data []byte) bool { return bytes.Contains(data[:40], []byte("VP8L")) }
+
+	lossy := encode(icon, nil)
+	assert.False(t, isVP8L(lossy))
+	lossless := encode(icon, &WebPOption{Lossless: true})
+	assert.True(t, isVP8L(lossless))
+	m, err := webp.Decode(bytes.NewReader(lossless))
+	if assert.NoError(t, err) {
+		assert.Zero(t, meanDiff(icon, m))
+	}
+	assert.True(t, isVP8L(encode(icon, &WebPOption{AutoLossless: true})))
+	assert.False(t, isVP8L(encode(src, &WebPOption{AutoLossless: true})))
+
+	exact := encode(src, &WebPOption{Lossless: true})
+	near := encode(src, &WebPOption{Lossless: true, NearLossless: 40})
+	assert.Less(t, len(near), len(exact))
+
+	// 带噪声的 alpha
+	fade := image.NewNRGBA(image.Rect(0, 0, 80, 80))
+	copy(fade.Pix, src.Pix)
+	for i := 3; i < len(fade.Pix); i += 4 {
+		fade.Pix[i] = 100 + fade.Pix[i-3]/4
+	}
+	assert.Less(t, len(encode(fade, &WebPOption{AlphaQuality: 10})), len(encode(fade, nil)))
+}
+
+func TestWebPMethod(t *testing.T) {
+	assert.Equal(t, webpMethod, (*WebPOption)(nil).method())
+	assert.Equal(t, webpMethod, (&WebPOption{}).method())
+	assert.Equal(t, webpMethod, (&WebPOption{Method: -1}).method())
+	assert.Equal(t, 6, (&WebPOption{Method: 9}).method())
+
+	m := gradient(96, 64)
+	sizes := map[int]int{}
+	for _, method := range []int{1, 6} {
+		var buf bytes.Buffer
+		err := webpEncode(&buf, m, 80, &WebPOption{Lossless: true, Method: method})
+		assert.NoError(t, err)
+		sizes[method] = buf.Len()
+		got, err := webp.Decode(&buf)
+		if assert.NoError(t, err) {
+			samePixels(t, m, got)
+		}
+	}
+	assert.NotEqual(t, sizes[1], sizes[6], "method is honoured")
+}
@@ -0,0 +1,1073 @@
+package image
+
+import (
+	"image"
+	"math"
+)
+
+// VP8 有损编码, 见 RFC 6386. 只输出关键帧, 宏块均使用 16x16 的帧内预测,
+// 不分段, 一个系数分区; 系数的概率按统计结果更新
+
+// 预测模式, 与解码器的编号相同
+const (
+	vp8PredDC = iota
+	vp8PredTM
+	vp8PredVE
+	vp8PredHE
+	vp8PredCnt
+)
+
+// 系数的类型
+const (
+	vp8PlaneYAfterY2 = iota
+	vp8PlaneY2
+	vp8PlaneUV
+)
+
+// vp8Zigzag 扫描顺序到块内位置
+var vp8Zigzag = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+
+// vp8Bands 扫描位置到概率的频带
+var vp8Bands = [17]uint8{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+
+// vp8Cat3456 大系数的额外位的概率
+var vp8Cat3456 = [4][]uint8{
+	{173, 148, 140},
+	{176, 155, 140, 135},
+	{180, 157, 141, 134, 130},
+	{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+}
+
+// vp8Bias 量化时的舍入, 单位 1/256, 依次为 y1, y2, uv 的 DC 及 AC, 与 libwebp 相同
+var vp8Bias = [3][2]int32{{96, 110}, {96, 108}, {110, 115}}
+
+type vp8MB struct {
+	ymode, uvmode uint8
+	skip          bool
+	// 0-15 为亮度, 16-19 为 U, 20-23 为 V, 24 为 Y2; 按扫描顺序
+	levels [25][16]int16
+}
+
+type vp8Encoder struct {
+	w, h     int
+	mbw, mbh int
+	qi       int // 量化索引 0-127
+	level    int // 环路滤波强度 0-63
+
+	y, u, v    []uint8 // 源, 补齐到宏块的整数倍
+	ry, ru, rv []uint8 // 重建, 用于预测
+	yStride    int
+	cStride    int
+	q          [3][2]int32 // y1, y2, uv 的 DC 及 AC 量化步长
+	mbs        []vp8MB
+}
+
+// encodeVP8 把图像编码为 VP8 关键帧, quality 为 0-100
+func encodeVP8(m *image.NRGBA, quality float32) []byte {
+	qi := int(float64(100-min(max(quality, 0), 100))*127/100 + 0.5)
+	e := newVP8Encoder(m, qi, int(vp8ACTable[qi])*3/8)
+	e.encode()
+	return e.bytes()
+}
+
+func newVP8Encoder(m *image.NRGBA, qi, level int) *vp8Encoder {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	e := &vp8Encoder{w: w, h: h, mbw: (w + 15) / 16, mbh: (h + 15) / 16, qi: qi, level: min(level, 63)}
+	e.yStride, e.cStride = e.mbw*16, e.mbw*8
+	e.y = make([]uint8, e.yStride*e.mbh*16)
+	e.u = make([]uint8, e.cStride*e.mbh*8)
+	e.v = make([]uint8, len(e.u))
+	e.ry = make([]uint8, len(e.y))
+	e.ru = make([]uint8, len(e.u))
+	e.rv = make([]uint8, len(e.u))
+	e.mbs = make([]vp8MB, e.mbw*e.mbh)
+
+	e.q[0] = [2]int32{int32(vp8DCTable[qi]), int32(vp8ACTable[qi])}
+	e.q[1] = [2]int32{int32(vp8DCTable[qi]) * 2, max(int32(vp8ACTable[qi])*155/100, 8)}
+	e.q[2] = [2]int32{int32(vp8DCTable[min(qi, 117)]), int32(vp8ACTable[qi])}
+
+	// 按 libwebp 的 BT.601 有限范围转换, 右侧及下方的补齐取边缘像素
+	at := func(x, y int) (r, g, b int) {
+		p := m.Pix[m.PixOffset(m.Rect.Min.X+min(x, w-1), m.Rect.Min.Y+min(y, h-1)):]
+		return int(p[0]), int(p[1]), int(p[2])
+	}
+	for y := 0; y < e.mbh*16; y++ {
+		for x := 0; x < e.yStride; x++ {
+			r, g, b := at(x, y)
+			e.y[y*e.yStride+x] = uint8((16839*r + 33059*g + 6420*b + 1<<15 + 16<<16) >> 16)
+		}
+	}
+	for y := 0; y < e.mbh*8; y++ {
+		for x := 0; x < e.cStride; x++ {
+			var r, g, b int
+			for i := 0; i < 4; i++ {
+				r1, g1, b1 := at(2*x+i&1, 2*y+i>>1)
+				r, g, b = r+r1, g+g1, b+b1
+			}
+			e.u[y*e.cStride+x] = clipUV(-9719*r - 19081*g + 28800*b)
+			e.v[y*e.cStride+x] = clipUV(28800*r - 24116*g - 4684*b)
+		}
+	}
+	return e
+}
+
+func clipUV(v int) uint8 {
+	v = (v + 1<<17 + 128<<18) >> 18
+	return uint8(min(max(v, 0), 255))
+}
+
+// encode 逐个宏块选择预测模式, 量化并重建
+func (e *vp8Encoder) encode() {
+	var pred, best [256]uint8
+	for mby := 0; mby < e.mbh; mby++ {
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mb := &e.mbs[mby*e.mbw+mbx]
+
+			// 亮度
+			x0, y0 := mbx*16, mby*16
+			bestErr := math.MaxInt
+			for mode := uint8(0); mode < vp8PredCnt; mode++ {
+				predict(pred[:], e.ry, e.yStride, x0, y0, 16, mode)
+				if d := sse(e.y[y0*e.yStride+x0:], e.yStride, pred[:], 16); d < bestErr {
+					bestErr, mb.ymode, best = d, mode, pred
+				}
+			}
+			var coeffs [16][16]int32
+			var dc [16]int32
+			for n := 0; n < 16; n++ {
+				bx, by := n%4*4, n/4*4
+				fdct4(e.y[(y0+by)*e.yStride+x0+bx:], e.yStride, best[by*16+bx:], 16, &coeffs[n])
+				dc[n] = coeffs[n][0]
+			}
+			var y2 [16]int32
+			fwht(&dc, &y2)
+			e.quantize(&y2, 1, 0, &mb.levels[24])
+			iwht(&y2, &dc)
+			for n := 0; n < 16; n++ {
+				e.quantize(&coeffs[n], 0, 1, &mb.levels[n])
+				coeffs[n][0] = dc[n]
+				bx, by := n%4*4, n/4*4
+				idct4(&coeffs[n], best[by*16+bx:], 16, e.ry[(y0+by)*e.yStride+x0+bx:], e.yStride)
+			}
+
+			// 色度, U 及 V 使用相同的模式
+			x0, y0 = mbx*8, mby*8
+			bestErr = math.MaxInt
+			var predV, bestV [256]uint8
+			for mode := uint8(0); mode < vp8PredCnt; mode++ {
+				predict(pred[:], e.ru, e.cStride, x0, y0, 8, mode)
+				predict(predV[:], e.rv, e.cStride, x0, y0, 8, mode)
+				d := sse(e.u[y0*e.cStride+x0:], e.cStride, pred[:], 8) + sse(e.v[y0*e.cStride+x0:], e.cStride, predV[:], 8)
+				if d < bestErr {
+					bestErr, mb.uvmode, best, bestV = d, mode, pred, predV
+				}
+			}
+			for n := 0; n < 8; n++ {
+				src, rec, p := e.u, e.ru, best[:]
+				if n >= 4 {
+					src, rec, p = e.v, e.rv, bestV[:]
+				}
+				bx, by := n%2*4, n%4/2*4
+				var c [16]int32
+				fdct4(src[(y0+by)*e.cStride+x0+bx:], e.cStride, p[by*8+bx:], 8, &c)
+				e.quantize(&c, 2, 0, &mb.levels[16+n])
+				idct4(&c, p[by*8+bx:], 8, rec[(y0+by)*e.cStride+x0+bx:], e.cStride)
+			}
+
+			mb.skip = true
+			for i := range mb.levels {
+				if mb.levels[i] != [16]int16{} {
+					mb.skip = false
+					break
+				}
+			}
+		}
+	}
+}
+
+// quantize 从 first 起量化 c 的系数, 按扫描顺序写入 levels, 并把 c 替换为反量化的值
+func (e *vp8Encoder) quantize(c *[16]int32, typ, first int, levels *[16]int16) {
+	for k := 0; k < first; k++ {
+		c[vp8Zigzag[k]] = 0
+	}
+	for k := first; k < 16; k++ {
+		z := vp8Zigzag[k]
+		i := min(int(z), 1)
+		q := e.q[typ][i]
+		v := c[z]
+		neg := v < 0
+		if neg {
+			v = -v
+		}
+		level := min((v*256+q*vp8Bias[typ][i])/(q*256), 2047)
+		c[z] = level * q
+		if neg {
+			level, c[z] = -level, -c[z]
+		}
+		levels[k] = int16(level)
+	}
+}
+
+// predict 按模式预测 n x n 的块; 上方没有像素时取 127, 左侧没有像素时取 129, 与解码器相同
+func predict(dst []uint8, rec []uint8, stride, x0, y0, n int, mode uint8) {
+	var top, left [16]int
+	corner := 127
+	for i := 0; i < n; i++ {
+		top[i], left[i] = 127, 129
+		if y0 > 0 {
+			top[i] = int(rec[(y0-1)*stride+x0+i])
+		}
+		if x0 > 0 {
+			left[i] = int(rec[(y0+i)*stride+x0-1])
+		}
+	}
+	if y0 > 0 {
+		corner = 129
+		if x0 > 0 {
+			corner = int(rec[(y0-1)*stride+x0-1])
+		}
+	}
+	dc := 0x80
+	if mode == vp8PredDC {
+		shift := 3
+		if n == 16 {
+			shift = 4
+		}
+		sum := 0
+		for i := 0; i < n; i++ {
+			if y0 > 0 {
+				sum += top[i]
+			}
+			if x0 > 0 {
+				sum += left[i]
+			}
+		}
+		switch {
+		case x0 > 0 && y0 > 0:
+			dc = (sum + n) >> (shift + 1)
+		case x0 > 0 || y0 > 0:
+			dc = (sum + n/2) >> shift
+		}
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var p int
+			switch mode {
+			case vp8PredDC:
+				p = dc
+			case vp8PredTM:
+				p = min(max(left[y]+top[x]-corner, 0), 255)
+			case vp8PredVE:
+				p = top[x]
+			case vp8PredHE:
+				p = left[y]
+			}
+			dst[y*n+x] = uint8(p)
+		}
+	}
+}
+
+func sse(src []uint8, stride int, pred []uint8, n int) int {
+	sum := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			d := int(src[y*stride+x]) - int(pred[y*n+x])
+			sum += d * d
+		}
+	}
+	return sum
+}
+
+// fdct4 4x4 残差的正变换, 与 libwebp 相同
+func fdct4(src []uint8, stride int, pred []uint8, pstride int, out *[16]int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		s, p := src[i*stride:], pred[i*pstride:]
+		d0 := int32(s[0]) - int32(p[0])
+		d1 := int32(s[1]) - int32(p[1])
+		d2 := int32(s[2]) - int32(p[2])
+		d3 := int32(s[3]) - int32(p[3])
+		a0, a1, a2, a3 := d0+d3, d1+d2, d1-d2, d0-d3
+		tmp[0+i*4] = (a0 + a1) * 8
+		tmp[1+i*4] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[2+i*4] = (a0 - a1) * 8
+		tmp[3+i*4] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+	for i := 0; i < 4; i++ {
+		a0 := tmp[0+i] + tmp[12+i]
+		a1 := tmp[4+i] + tmp[8+i]
+		a2 := tmp[4+i] - tmp[8+i]
+		a3 := tmp[0+i] - tmp[12+i]
+		out[0+i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217+a3*5352+12000)>>16 + int32(btoi(a3 != 0))
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+}
+
+// idct4 反变换并与预测相加, 与解码器相同
+func idct4(c *[16]int32, pred []uint8, pstride int, dst []uint8, stride int) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2)
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2)
+	)
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := c[i] + c[8+i]
+		b := c[i] - c[8+i]
+		cc := (c[4+i]*c2)>>16 - (c[12+i]*c1)>>16
+		d := (c[4+i]*c1)>>16 + (c[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + cc, b - cc, a - d}
+	}
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		cc := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		p, o := pred[j*pstride:], dst[j*stride:]
+		o[0] = clip8(int32(p[0]) + (a+d)>>3)
+		o[1] = clip8(int32(p[1]) + (b+cc)>>3)
+		o[2] = clip8(int32(p[2]) + (b-cc)>>3)
+		o[3] = clip8(int32(p[3]) + (a-d)>>3)
+	}
+}
+
+func clip8(v int32) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+// fwht 16 个 DC 的正 Walsh-Hadamard 变换, 与 libwebp 相同
+func fwht(dc, out *[16]int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		a0 := dc[4*i+0] + dc[4*i+2]
+		a1 := dc[4*i+1] + dc[4*i+3]
+		a2 := dc[4*i+1] - dc[4*i+3]
+		a3 := dc[4*i+0] - dc[4*i+2]
+		tmp[0+i*4] = a0 + a1
+		tmp[1+i*4] = a3 + a2
+		tmp[2+i*4] = a3 - a2
+		tmp[3+i*4] = a0 - a1
+	}
+	for i := 0; i < 4; i++ {
+		a0 := tmp[0+i] + tmp[8+i]
+		a1 := tmp[4+i] + tmp[12+i]
+		a2 := tmp[4+i] - tmp[12+i]
+		a3 := tmp[0+i] - tmp[8+i]
+		out[0+i] = (a0 + a1) >> 1
+		out[4+i] = (a3 + a2) >> 1
+		out[8+i] = (a3 - a2) >> 1
+		out[12+i] = (a0 - a1) >> 1
+	}
+}
+
+// iwht 反 Walsh-Hadamard 变换, 与解码器相同
+func iwht(c, dc *[16]int32) {
+	var m [16]int32
+	for i := 0; i < 4; i++ {
+		a0 := c[0+i] + c[12+i]
+		a1 := c[4+i] + c[8+i]
+		a2 := c[4+i] - c[8+i]
+		a3 := c[0+i] - c[12+i]
+		m[0+i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := 0; i < 4; i++ {
+		d := m[0+i*4] + 3
+		a0 := d + m[3+i*4]
+		a1 := m[1+i*4] + m[2+i*4]
+		a2 := m[1+i*4] - m[2+i*4]
+		a3 := d - m[3+i*4]
+		dc[4*i+0] = (a0 + a1) >> 3
+		dc[4*i+1] = (a3 + a2) >> 3
+		dc[4*i+2] = (a0 - a1) >> 3
+		dc[4*i+3] = (a3 - a2) >> 3
+	}
+}
+
+// vp8Stats 各个系数概率下 0 及 1 的次数
+type vp8Stats [4][8][3][11][2]int
+
+// vp8Tokens 写入系数, enc 为 nil 时只统计
+type vp8Tokens struct {
+	enc   *boolEncoder
+	stats *vp8Stats
+	probs *[4][8][3][11]uint8
+}
+
+func (t *vp8Tokens) put(plane, band, ctx, i int, b bool) {
+	if t.enc == nil {
+		t.stats[plane][band][ctx][i][btoi(b)]++
+		return
+	}
+	t.enc.putBit(b, t.probs[plane][band][ctx][i])
+}
+
+func (t *vp8Tokens) fixed(b bool, prob uint8) {
+	if t.enc != nil {
+		t.enc.putBit(b, prob)
+	}
+}
+
+// block 写入一个块的系数, 返回是否有非零系数
+func (t *vp8Tokens) block(plane, ctx, first int, levels *[16]int16) int {
+	last := -1
+	for k := first; k < 16; k++ {
+		if levels[k] != 0 {
+			last = k
+		}
+	}
+	band := int(vp8Bands[first])
+	if last < 0 {
+		t.put(plane, band, ctx, 0, false)
+		return 0
+	}
+	t.put(plane, band, ctx, 0, true)
+	for k := first; k <= last; k++ {
+		v := int(levels[k])
+		if v < 0 {
+			v = -v
+		}
+		if v == 0 {
+			t.put(plane, band, ctx, 1, false)
+			band, ctx = int(vp8Bands[k+1]), 0
+			continue
+		}
+		t.put(plane, band, ctx, 1, true)
+		if v == 1 {
+			t.put(plane, band, ctx, 2, false)
+		} else {
+			t.put(plane, band, ctx, 2, true)
+			switch {
+			case v <= 4:
+				t.put(plane, band, ctx, 3, false)
+				if v == 2 {
+					t.put(plane, band, ctx, 4, false)
+				} else {
+					t.put(plane, band, ctx, 4, true)
+					t.put(plane, band, ctx, 5, v == 4)
+				}
+			case v <= 10:
+				t.put(plane, band, ctx, 3, true)
+				t.put(plane, band, ctx, 6, false)
+				if v <= 6 {
+					t.put(plane, band, ctx, 7, false)
+					t.fixed(v == 6, 159)
+				} else {
+					t.put(plane, band, ctx, 7, true)
+					t.fixed((v-7)&2 != 0, 165)
+					t.fixed((v-7)&1 != 0, 145)
+				}
+			default:
+				t.put(plane, band, ctx, 3, true)
+				t.put(plane, band, ctx, 6, true)
+				cat := 3
+				for cat > 0 && v < 3+8<<cat {
+					cat--
+				}
+				t.put(plane, band, ctx, 8, cat >= 2)
+				t.put(plane, band, ctx, 9+cat>>1, cat&1 != 0)
+				extra := v - (3 + 8<<cat)
+				tab := vp8Cat3456[cat]
+				for i, p := range tab {
+					t.fixed(extra>>(len(tab)-1-i)&1 != 0, p)
+				}
+			}
+		}
+		ctx = 2
+		if v == 1 {
+			ctx = 1
+		}
+		band = int(vp8Bands[k+1])
+		t.fixed(levels[k] < 0, 128)
+		if k == 15 {
+			break
+		}
+		t.put(plane, band, ctx, 0, k != last)
+	}
+	return 1
+}
+
+// tokens 按解码器的顺序及上下文写入全部系数
+func (e *vp8Encoder) tokens(t *vp8Tokens, useSkip bool) {
+	// 上下文: 0-3 亮度, 4-5 U, 6-7 V, 8 Y2
+	up := make([][9]int, e.mbw)
+	for mby := 0; mby < e.mbh; mby++ {
+		var left [9]int
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mb, u := &e.mbs[mby*e.mbw+mbx], &up[mbx]
+			if useSkip && mb.skip {
+				*u, left = [9]int{}, [9]int{}
+				continue
+			}
+			nz := t.block(vp8PlaneY2, u[8]+left[8], 0, &mb.levels[24])
+			u[8], left[8] = nz, nz
+			for n := 0; n < 16; n++ {
+				x, y := n%4, n/4
+				nz = t.block(vp8PlaneYAfterY2, u[x]+left[y], 1, &mb.levels[n])
+				u[x], left[y] = nz, nz
+			}
+			for n := 0; n < 8; n++ {
+				x, y := 4+n/4*2+n%2, 4+n/4*2+n%4/2
+				nz = t.block(vp8PlaneUV, u[x]+left[y], 0, &mb.levels[16+n])
+				u[x], left[y] = nz, nz
+			}
+		}
+	}
+}
+
+// bytes 写入帧头, 第一分区 (头及预测模式) 及系数分区
+func (e *vp8Encoder) bytes() []byte {
+	var stats vp8Stats
+	e.tokens(&vp8Tokens{stats: &stats}, false)
+	probs := vp8DefaultProb
+
+	fp := newBoolEncoder()
+	fp.putUint(0, 1) // color space
+	fp.putUint(0, 1) // clamping type
+	fp.putUint(0, 1) // segmentation
+	fp.putUint(0, 1) // normal loop filter
+	fp.putUint(uint32(e.level), 6)
+	fp.putUint(0, 3) // sharpness
+	fp.putUint(0, 1) // loop filter adjustments
+	fp.putUint(0, 2) // 一个系数分区
+	fp.putUint(uint32(e.qi), 7)
+	fp.putUint(0, 5) // 没有量化索引的差值
+	fp.putUint(0, 1) // refresh entropy probs
+	for i := range probs {
+		for j := range probs[i] {
+			for k := range probs[i][j] {
+				for l, old := range probs[i][j][k] {
+					c := stats[i][j][k][l]
+					upd := vp8UpdateProb[i][j][k][l]
+					p := newProb(c[0], c[1])
+					update := c[0]+c[1] > 0 &&
+						probCost(c, p)+bitCost(true, upd)+8 < probCost(c, old)+bitCost(false, upd)
+					fp.putBit(update, upd)
+					if update {
+						probs[i][j][k][l] = p
+						fp.putUint(uint32(p), 8)
+					}
+				}
+			}
+		}
+	}
+	skipped := 0
+	for i := range e.mbs {
+		if e.mbs[i].skip {
+			skipped++
+		}
+	}
+	useSkip := skipped > 0
+	skipProb := newProb(len(e.mbs)-skipped, skipped)
+	fp.putBit(useSkip, 128)
+	if useSkip {
+		fp.putUint(uint32(skipProb), 8)
+	}
+	for i := range e.mbs {
+		mb := &e.mbs[i]
+		if useSkip {
+			fp.putBit(mb.skip, skipProb)
+		}
+		fp.putBit(true, 145) // 16x16 预测
+		switch mb.ymode {
+		case vp8PredDC, vp8PredVE:
+			fp.putBit(false, 156)
+			fp.putBit(mb.ymode == vp8PredVE, 163)
+		default:
+			fp.putBit(true, 156)
+			fp.putBit(mb.ymode == vp8PredTM, 128)
+		}
+		fp.putBit(mb.uvmode != vp8PredDC, 142)
+		if mb.uvmode != vp8PredDC {
+			fp.putBit(mb.uvmode != vp8PredVE, 114)
+			if mb.uvmode != vp8PredVE {
+				fp.putBit(mb.uvmode == vp8PredTM, 183)
+			}
+		}
+	}
+	first := fp.flush()
+
+	tp := newBoolEncoder()
+	e.tokens(&vp8Tokens{enc: tp, probs: &probs}, useSkip)
+	part := tp.flush()
+
+	n := len(first)
+	out := make([]byte, 0, 10+len(first)+len(part))
+	out = append(out, byte(1<<4|n<<5), byte(n>>3), byte(n>>11)) // 关键帧, 显示
+	out = append(out, 0x9d, 0x01, 0x2a, byte(e.w), byte(e.w>>8), byte(e.h), byte(e.h>>8))
+	out = append(out, first...)
+	return append(out, part...)
+}
+
+// newProb 按 0 及 1 的次数计算 0 的概率
+func newProb(n0, n1 int) uint8 {
+	if n0+n1 == 0 {
+		return 255
+	}
+	return uint8(min(max((n0*255+(n0+n1)/2)/(n0+n1), 1), 255))
+}
+
+func bitCost(b bool, prob uint8) float64 {
+	p := float64(prob) / 256
+	if b {
+		p = 1 - p
+	}
+	return -math.Log2(p)
+}
+
+func probCost(c [2]int, prob uint8) float64 {
+	return float64(c[0])*bitCost(false, prob) + float64(c[1])*bitCost(true, prob)
+}
+
+// boolEncoder 布尔熵编码, 见 RFC 6386 7.3
+type boolEncoder struct {
+	out    []byte
+	rng    uint32
+	bottom uint32
+	bitCnt int
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bitCnt: 24}
+}
+
+func (e *boolEncoder) putBit(b bool, prob uint8) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if b {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.carry()
+		}
+		e.bottom <<= 1
+		if e.bitCnt--; e.bitCnt == 0 {
+			e.out = append(e.out, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCnt = 8
+		}
+	}
+}
+
+// putUint 按高位在前写入 n 位, 概率均为 1/2
+func (e *boolEncoder) putUint(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.putBit(v>>i&1 != 0, 128)
+	}
+}
+
+func (e *boolEncoder) carry() {
+	i := len(e.out) - 1
+	for ; e.out[i] == 0xff; i-- {
+		e.out[i] = 0
+	}
+	e.out[i]++
+}
+
+func (e *boolEncoder) flush() []byte {
+	c, v := e.bitCnt, e.bottom
+	if v&(1<<(32-c)) != 0 {
+		e.carry()
+	}
+	v <<= c & 7
+	for c >>= 3; c > 0; c-- {
+		v <<= 8
+	}
+	for i := 0; i < 4; i++ {
+		e.out = append(e.out, byte(v>>24))
+		v <<= 8
+	}
+	return e.out
+}
+
+// vp8UpdateProb 系数概率的更新概率, 见 RFC 6386 13.4
+var vp8UpdateProb = [4][8][3][11]uint8{
+	{
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{176, 246, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{223, 241, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 244, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{234, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 246, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{239, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 248, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 253, 255, 254, 255, 255, 255, 255, 255, 255},
+			{250, 255, 254, 255, 254, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{217, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{225, 252, 241, 253, 255, 255, 254, 255, 255, 255, 255},
+			{234, 250, 241, 250, 253, 255, 253, 254, 255, 255, 255},
+		},
+		{
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{223, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{238, 253, 254, 254, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 248, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{247, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{186, 251, 250, 255, 255, 255, 255, 255, 255, 255, 255},
+			{234, 251, 244, 254, 255, 255, 255, 255, 255, 255, 255},
+			{251, 251, 243, 253, 254, 255, 254, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{236, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 253, 253, 254, 254, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{248, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 254, 252, 254, 255, 255, 255, 255, 255, 255, 255},
+			{248, 254, 249, 253, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{246, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 254, 251, 254, 254, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{248, 254, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 254, 254, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 251, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{245, 251, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 251, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 252, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+}
+
+// vp8DefaultProb 默认的系数概率, 见 RFC 6386 13.5
+var vp8DefaultProb = [4][8][3][11]uint8{
+	{
+		{
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{253, 136, 254, 255, 228, 219, 128, 128, 128, 128, 128},
+			{189, 129, 242, 255, 227, 213, 255, 219, 128, 128, 128},
+			{106, 126, 227, 252, 214, 209, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 98, 248, 255, 236, 226, 255, 255, 128, 128, 128},
+			{181, 133, 238, 254, 221, 234, 255, 154, 128, 128, 128},
+			{78, 134, 202, 247, 198, 180, 255, 219, 128, 128, 128},
+		},
+		{
+			{1, 185, 249, 255, 243, 255, 128, 128, 128, 128, 128},
+			{184, 150, 247, 255, 236, 224, 128, 128, 128, 128, 128},
+			{77, 110, 216, 255, 236, 230, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 101, 251, 255, 241, 255, 128, 128, 128, 128, 128},
+			{170, 139, 241, 252, 236, 209, 255, 255, 128, 128, 128},
+			{37, 116, 196, 243, 228, 255, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 204, 254, 255, 245, 255, 128, 128, 128, 128, 128},
+			{207, 160, 250, 255, 238, 128, 128, 128, 128, 128, 128},
+			{102, 103, 231, 255, 211, 171, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 152, 252, 255, 240, 255, 128, 128, 128, 128, 128},
+			{177, 135, 243, 255, 234, 225, 128, 128, 128, 128, 128},
+			{80, 129, 211, 255, 194, 224, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{246, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{255, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{198, 35, 237, 223, 193, 187, 162, 160, 145, 155, 62},
+			{131, 45, 198, 221, 172, 176, 220, 157, 252, 221, 1},
+			{68, 47, 146, 208, 149, 167, 221, 162, 255, 223, 128},
+		},
+		{
+			{1, 149, 241, 255, 221, 224, 255, 255, 128, 128, 128},
+			{184, 141, 234, 253, 222, 220, 255, 199, 128, 128, 128},
+			{81, 99, 181, 242, 176, 190, 249, 202, 255, 255, 128},
+		},
+		{
+			{1, 129, 232, 253, 214, 197, 242, 196, 255, 255, 128},
+			{99, 121, 210, 250, 201, 198, 255, 202, 128, 128, 128},
+			{23, 91, 163, 242, 170, 187, 247, 210, 255, 255, 128},
+		},
+		{
+			{1, 200, 246, 255, 234, 255, 128, 128, 128, 128, 128},
+			{109, 178, 241, 255, 231, 245, 255, 255, 128, 128, 128},
+			{44, 130, 201, 253, 205, 192, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 132, 239, 251, 219, 209, 255, 165, 128, 128, 128},
+			{94, 136, 225, 251, 218, 190, 255, 255, 128, 128, 128},
+			{22, 100, 174, 245, 186, 161, 255, 199, 128, 128, 128},
+		},
+		{
+			{1, 182, 249, 255, 232, 235, 128, 128, 128, 128, 128},
+			{124, 143, 241, 255, 227, 234, 128, 128, 128, 128, 128},
+			{35, 77, 181, 251, 193, 211, 255, 205, 128, 128, 128},
+		},
+		{
+			{1, 157, 247, 255, 236, 231, 255, 255, 128, 128, 128},
+			{121, 141, 235, 255, 225, 227, 255, 255, 128, 128, 128},
+			{45, 99, 188, 251, 195, 217, 255, 224, 128, 128, 128},
+		},
+		{
+			{1, 1, 251, 255, 213, 255, 128, 128, 128, 128, 128},
+			{203, 1, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+			{137, 1, 177, 255, 224, 255, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{253, 9, 248, 251, 207, 208, 255, 192, 128, 128, 128},
+			{175, 13, 224, 243, 193, 185, 249, 198, 255, 255, 128},
+			{73, 17, 171, 221, 161, 179, 236, 167, 255, 234, 128},
+		},
+		{
+			{1, 95, 247, 253, 212, 183, 255, 255, 128, 128, 128},
+			{239, 90, 244, 250, 211, 209, 255, 255, 128, 128, 128},
+			{155, 77, 195, 248, 188, 195, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 24, 239, 251, 218, 219, 255, 205, 128, 128, 128},
+			{201, 51, 219, 255, 196, 186, 128, 128, 128, 128, 128},
+			{69, 46, 190, 239, 201, 218, 255, 228, 128, 128, 128},
+		},
+		{
+			{1, 191, 251, 255, 255, 128, 128, 128, 128, 128, 128},
+			{223, 165, 249, 255, 213, 255, 128, 128, 128, 128, 128},
+			{141, 124, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 16, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+			{190, 36, 230, 255, 236, 255, 128, 128, 128, 128, 128},
+			{149, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 226, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{247, 192, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{240, 128, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 134, 252, 255, 255, 128, 128, 128, 128, 128, 128},
+			{213, 62, 250, 255, 255, 128, 128, 128, 128, 128, 128},
+			{55, 93, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{202, 24, 213, 235, 186, 191, 220, 160, 240, 175, 255},
+			{126, 38, 182, 232, 169, 184, 228, 174, 255, 187, 128},
+			{61, 46, 138, 219, 151, 178, 240, 170, 255, 216, 128},
+		},
+		{
+			{1, 112, 230, 250, 199, 191, 247, 159, 255, 255, 128},
+			{166, 109, 228, 252, 211, 215, 255, 174, 128, 128, 128},
+			{39, 77, 162, 232, 172, 180, 245, 178, 255, 255, 128},
+		},
+		{
+			{1, 52, 220, 246, 198, 199, 249, 220, 255, 255, 128},
+			{124, 74, 191, 243, 183, 193, 250, 221, 255, 255, 128},
+			{24, 71, 130, 219, 154, 170, 243, 182, 255, 255, 128},
+		},
+		{
+			{1, 182, 225, 249, 219, 240, 255, 224, 128, 128, 128},
+			{149, 150, 226, 252, 216, 205, 255, 171, 128, 128, 128},
+			{28, 108, 170, 242, 183, 194, 254, 223, 255, 255, 128},
+		},
+		{
+			{1, 81, 230, 252, 204, 203, 255, 192, 128, 128, 128},
+			{123, 102, 209, 247, 188, 196, 255, 233, 128, 128, 128},
+			{20, 95, 153, 243, 164, 173, 255, 203, 128, 128, 128},
+		},
+		{
+			{1, 222, 248, 255, 216, 213, 128, 128, 128, 128, 128},
+			{168, 175, 246, 252, 235, 205, 255, 255, 128, 128, 128},
+			{47, 116, 215, 255, 211, 212, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 121, 236, 253, 212, 214, 255, 255, 128, 128, 128},
+			{141, 84, 213, 252, 201, 202, 255, 219, 128, 128, 128},
+			{42, 80, 160, 240, 162, 185, 255, 205, 128, 128, 128},
+		},
+		{
+			{1, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{244, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{238, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+}
+
+// 量化步长, 见 RFC 6386 14.1
+var (
+	vp8DCTable = [128]uint16{
+		4, 5, 6, 7, 8, 9, 10, 10,
+		11, 12, 13, 14, 15, 16, 17, 17,
+		18, 19, 20, 20, 21, 21, 22, 22,
+		23, 23, 24, 25, 25, 26, 27, 28,
+		29, 30, 31, 32, 33, 34, 35, 36,
+		37, 37, 38, 39, 40, 41, 42, 43,
+		44, 45, 46, 46, 47, 48, 49, 50,
+		51, 52, 53, 54, 55, 56, 57, 58,
+		59, 60, 61, 62, 63, 64, 65, 66,
+		67, 68, 69, 70, 71, 72, 73, 74,
+		75, 76, 76, 77, 78, 79, 80, 81,
+		82, 83, 84, 85, 86, 87, 88, 89,
+		91, 93, 95, 96, 98, 100, 101, 102,
+		104, 106, 108, 110, 112, 114, 116, 118,
+		122, 124, 126, 128, 130, 132, 134, 136,
+		138, 140, 143, 145, 148, 151, 154, 157,
+	}
+	vp8ACTable = [128]uint16{
+		4, 5, 6, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16, 17, 18, 19,
+		20, 21, 22, 23, 24, 25, 26, 27,
+		28, 29, 30, 31, 32, 33, 34, 35,
+		36, 37, 38, 39, 40, 41, 42, 43,
+		44, 45, 46, 47, 48, 49, 50, 51,
+		52, 53, 54, 55, 56, 57, 58, 60,
+		62, 64, 66, 68, 70, 72, 74, 76,
+		78, 80, 82, 84, 86, 88, 90, 92,
+		94, 96, 98, 100, 102, 104, 106, 108,
+		110, 112, 114, 116, 119, 122, 125, 128,
+		131, 134, 137, 140, 143, 146, 149, 152,
+		155, 158, 161, 164, 167, 170, 173, 177,
+		181, 185, 189, 193, 197, 201, 205, 209,
+		213, 217, 221, 225, 229, 234, 239, 245,
+		249, 254, 259, 264, 269, 274, 279, 284,
+	}
+)
@@ -0,0 +1,730 @@
+package image
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// VP8L 无损编码, 见 https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+// 只使用一组 Huffman 码; 调色板图使用颜色索引变换, 其余使用减绿及预测变换
+
+const (
+	vp8lMagic           = 0x2f
+	vp8lPredictor       = 0
+	vp8lSubtractGreen   = 2
+	vp8lColorIndexing   = 3
+	vp8lPredictorBits   = 4 // 预测模式按 16x16 分块
+	vp8lMinLength       = 3
+	vp8lMaxLength       = 4096
+	vp8lWindow          = 1<<20 - 120
+	vp8lMaxCacheBits    = 10
+	vp8lCacheMultiplier = 0x1e35a7bd
+	vp8lHashBits        = 16
+)
+
+// vp8lDistanceMap 短距离的二维偏移 (yoffset<<4 | 8-xoffset), 前 120 个距离码使用
+var vp8lDistanceMap = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// vp8lCodeOrder 码长的码长的写入顺序
+var vp8lCodeOrder = [19]uint8{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// encodeVP8L 把图像编码为 VP8L 码流, method 0-6 越大越慢;
+// header 为 false 时省略 5 字节的头, 用于 ALPH 块
+func encodeVP8L(m *image.NRGBA, method int, header bool) []byte {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	argb := make([]uint32, w*h)
+	alpha := uint32(0)
+	for y := 0; y < h; y++ {
+		row := m.Pix[m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			p := row[x*4 : x*4+4]
+			argb[y*w+x] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+			if p[3] != 0xff {
+				alpha = 1
+			}
+		}
+	}
+
+	var b vp8lBits
+	if header {
+		b.write(vp8lMagic, 8)
+		b.write(uint32(w-1), 14)
+		b.write(uint32(h-1), 14)
+		b.write(alpha, 1)
+		b.write(0, 3) // version
+	}
+	e := vp8lEncoder{depth: 16 << min(max(method, 0), 6)}
+	pal := vp8lPalette(argb)
+	if pal == nil {
+		return e.encodePredicted(b, argb, w, h)
+	}
+	out := e.encodeIndexed(b, argb, w, h, pal)
+	if len(pal) > 16 {
+		// 颜色较多时预测变换可能更小
+		if alt := e.encodePredicted(b, argb, w, h); len(alt) < len(out) {
+			out = alt
+		}
+	}
+	return out
+}
+
+type vp8lEncoder struct {
+	depth int // 哈希链的最大查找次数
+}
+
+// encodeIndexed 使用颜色索引变换, 颜色不超过 16 种时多个索引合并为一个像素
+func (e *vp8lEncoder) encodeIndexed(b vp8lBits, argb []uint32, w, h int, pal []uint32) []byte {
+	b.out = append([]byte(nil), b.out...)
+	b.write(1, 1)
+	b.write(vp8lColorIndexing, 2)
+	b.write(uint32(len(pal)-1), 8)
+	delta := make([]uint32, len(pal))
+	for i := range pal {
+		delta[i] = pal[i]
+		if i > 0 {
+			delta[i] = subPixels(pal[i], pal[i-1])
+		}
+	}
+	e.encodeImage(&b, delta, len(pal), 1, false)
+
+	xbits := 0
+	switch n := len(pal); {
+	case n <= 2:
+		xbits = 3
+	case n <= 4:
+		xbits = 2
+	case n <= 16:
+		xbits = 1
+	}
+	index := make(map[uint32]uint32, len(pal))
+	for i, c := range pal {
+		index[c] = uint32(i)
+	}
+	pw := (w + 1<<xbits - 1) >> xbits
+	packed := make([]uint32, pw*h)
+	depth := 8 >> xbits
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*pw + x>>xbits
+			packed[i] |= index[argb[y*w+x]] << (8 + (x&(1<<xbits-1))*depth)
+		}
+	}
+	for i := range packed {
+		packed[i] |= 0xff000000
+	}
+	b.write(0, 1) // 没有更多变换
+	e.encodeImage(&b, packed, pw, h, true)
+	return b.bytes()
+}
+
+// encodePredicted 使用减绿及预测变换
+func (e *vp8lEncoder) encodePredicted(b vp8lBits, argb []uint32, w, h int) []byte {
+	b.out = append([]byte(nil), b.out...)
+	res := make([]uint32, len(argb))
+	for i, c := range argb {
+		g := c >> 8 & 0xff
+		res[i] = c&0xff00ff00 | (c>>16-g)&0xff<<16 | (c-g)&0xff
+	}
+	b.write(1, 1)
+	b.write(vp8lSubtractGreen, 2)
+
+	tw, th := (w+1<<vp8lPredictorBits-1)>>vp8lPredictorBits, (h+1<<vp8lPredictorBits-1)>>vp8lPredictorBits
+	modes := make([]uint32, tw*th)
+	for ty := 0; ty < th; ty++ {
+		for tx := 0; tx < tw; tx++ {
+			modes[ty*tw+tx] = 0xff000000 | uint32(bestPredictor(res, w, h, tx, ty))<<8
+		}
+	}
+	b.write(1, 1)
+	b.write(vp8lPredictor, 2)
+	b.write(vp8lPredictorBits-2, 3)
+	e.encodeImage(&b, modes, tw, th, false)
+
+	// 残差需按变换前的像素计算, 从后向前原地改写
+	for y := h - 1; y >= 0; y-- {
+		for x := w - 1; x >= 0; x-- {
+			i := y*w + x
+			mode := modes[(y>>vp8lPredictorBits)*tw+x>>vp8lPredictorBits] >> 8 & 0xf
+			res[i] = subPixels(res[i], predictPixel(res, w, x, y, int(mode)))
+		}
+	}
+	b.write(0, 1)
+	e.encodeImage(&b, res, w, h, true)
+	return b.bytes()
+}
+
+// vp8lPalette 不超过 256 种颜色时返回排序后的调色板
+func vp8lPalette(argb []uint32) []uint32 {
+	seen := make(map[uint32]struct{}, 257)
+	for _, c := range argb {
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		if len(seen) == 256 {
+			return nil
+		}
+		seen[c] = struct{}{}
+	}
+	pal := make([]uint32, 0, len(seen))
+	for c := range seen {
+		pal = append(pal, c)
+	}
+	sort.Slice(pal, func(i, j int) bool { return pal[i] < pal[j] })
+	return pal
+}
+
+// subPixels 逐通道相减
+func subPixels(a, b uint32) uint32 {
+	ag := 0x00ff00ff + a&0xff00ff00 - b&0xff00ff00
+	rb := 0xff00ff00 + a&0x00ff00ff - b&0x00ff00ff
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+// avg2 逐通道取平均
+func avg2(a, b uint32) uint32 {
+	return (a^b)&0xfefefefe>>1 + a&b
+}
+
+// predictPixel 按模式预测 (x, y) 的像素, 第一行及第一列使用固定的模式
+func predictPixel(argb []uint32, w, x, y, mode int) uint32 {
+	i := y*w + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-w]
+	}
+	l, t, tl, tr := argb[i-1], argb[i-w], argb[i-w-1], argb[i-w+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return avg2(avg2(l, tr), t)
+	case 6:
+		return avg2(l, tl)
+	case 7:
+		return avg2(l, t)
+	case 8:
+		return avg2(tl, t)
+	case 9:
+		return avg2(t, tr)
+	case 10:
+		return avg2(avg2(l, tl), avg2(t, tr))
+	case 11:
+		var pl, pt int
+		for s := 0; s < 32; s += 8 {
+			c := int(tl >> s & 0xff)
+			pl += absInt(c - int(t>>s&0xff))
+			pt += absInt(c - int(l>>s&0xff))
+		}
+		if pl < pt {
+			return l
+		}
+		return t
+	case 12:
+		var c uint32
+		for s := 0; s < 32; s += 8 {
+			v := int(l>>s&0xff) + int(t>>s&0xff) - int(tl>>s&0xff)
+			c |= uint32(min(max(v, 0), 255)) << s
+		}
+		return c
+	default:
+		a := avg2(l, t)
+		var c uint32
+		for s := 0; s < 32; s += 8 {
+			v := int(a >> s & 0xff)
+			v += (v - int(tl>>s&0xff)) / 2
+			c |= uint32(min(max(v, 0), 255)) << s
+		}
+		return c
+	}
+}
+
+// bestPredictor 选择使分块残差绝对值之和最小的模式
+func bestPredictor(argb []uint32, w, h, tx, ty int) int {
+	x0, y0 := tx<<vp8lPredictorBits, ty<<vp8lPredictorBits
+	x1, y1 := min(x0+1<<vp8lPredictorBits, w), min(y0+1<<vp8lPredictorBits, h)
+	best, bestCost := 0, math.MaxInt
+	for mode := 0; mode < 14; mode++ {
+		cost := 0
+		for y := max(y0, 1); y < y1 && cost < bestCost; y++ {
+			for x := max(x0, 1); x < x1; x++ {
+				d := subPixels(argb[y*w+x], predictPixel(argb, w, x, y, mode))
+				for s := 0; s < 32; s += 8 {
+					cost += absInt(int(int8(d >> s)))
+				}
+			}
+		}
+		if cost < bestCost {
+			best, bestCost = mode, cost
+		}
+	}
+	return best
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// vp8lSym LZ77 后的符号: 字面像素, 颜色缓存索引或向前复制
+type vp8lSym struct {
+	kind uint8
+	argb uint32 // 字面像素或缓存索引
+	len  int
+	dist int // 距离码, 已映射短距离
+}
+
+const (
+	symLiteral = iota
+	symCache
+	symCopy
+)
+
+// encodeImage 写入熵编码的像素, topLevel 时可使用颜色缓存
+func (e *vp8lEncoder) encodeImage(b *vp8lBits, argb []uint32, w, h int, topLevel bool) {
+	syms := e.backwardRefs(argb, w)
+	cacheBits := 0
+	if topLevel {
+		best := math.Inf(1)
+		for cb := 0; cb <= vp8lMaxCacheBits; cb++ {
+			if c := vp8lHistogram(applyCache(syms, argb, cb), cb).cost(); c < best {
+				best, cacheBits = c, cb
+			}
+		}
+		syms = applyCache(syms, argb, cacheBits)
+		b.write(btoi(cacheBits > 0), 1)
+		if cacheBits > 0 {
+			b.write(uint32(cacheBits), 4)
+		}
+		b.write(0, 1) // 只有一组 Huffman 码
+	} else {
+		b.write(0, 1) // 不使用颜色缓存
+	}
+
+	hist := vp8lHistogram(syms, cacheBits)
+	var codes [5]huffCode
+	for i := range codes {
+		codes[i] = newHuffCode(hist.freq[i], 15)
+		codes[i].write(b)
+	}
+	for _, s := range syms {
+		switch s.kind {
+		case symLiteral:
+			codes[0].put(b, int(s.argb>>8&0xff))
+			codes[1].put(b, int(s.argb>>16&0xff))
+			codes[2].put(b, int(s.argb&0xff))
+			codes[3].put(b, int(s.argb>>24))
+		case symCache:
+			codes[0].put(b, 256+24+int(s.argb))
+		case symCopy:
+			sym, n, extra := vp8lPrefix(s.len)
+			codes[0].put(b, 256+sym)
+			b.write(uint32(extra), uint(n))
+			sym, n, extra = vp8lPrefix(s.dist)
+			codes[4].put(b, sym)
+			b.write(uint32(extra), uint(n))
+		}
+	}
+}
+
+func btoi(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// backwardRefs 用哈希链查找向前复制, 优先尝试左侧及上方的像素
+func (e *vp8lEncoder) backwardRefs(argb []uint32, w int) []vp8lSym {
+	n := len(argb)
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (argb[i]*0x9e3779b1 + argb[i+1]*0x85ebca6b) >> (32 - vp8lHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			k := hash(i)
+			prev[i], head[k] = head[k], int32(i)
+		}
+	}
+	codes := vp8lDistanceCodes(w)
+
+	syms := make([]vp8lSym, 0, n/2)
+	for i := 0; i < n; {
+		bestLen, bestDist := 0, 0
+		maxLen := min(vp8lMaxLength, n-i)
+		if maxLen >= vp8lMinLength {
+			for _, d := range [2]int{1, w} {
+				if d <= i {
+					if l := matchLen(argb, i-d, i, maxLen); l > bestLen {
+						bestLen, bestDist = l, d
+					}
+				}
+			}
+			for j, k := head[hash(i)], 0; j >= 0 && k < e.depth && i-int(j) <= vp8lWindow && bestLen < maxLen; j, k = prev[j], k+1 {
+				if l := matchLen(argb, int(j), i, maxLen); l > bestLen {
+					bestLen, bestDist = l, i-int(j)
+				}
+			}
+		}
+		if bestLen < vp8lMinLength {
+			syms = append(syms, vp8lSym{kind: symLiteral, argb: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+		dist, ok := codes[bestDist]
+		if !ok {
+			dist = bestDist + len(vp8lDistanceMap)
+		}
+		syms = append(syms, vp8lSym{kind: symCopy, len: bestLen, dist: dist})
+		for end := i + bestLen; i < end; i++ {
+			insert(i)
+		}
+	}
+	return syms
+}
+
+func matchLen(argb []uint32, j, i, max int) int {
+	n := 0
+	for n < max && argb[j+n] == argb[i+n] {
+		n++
+	}
+	return n
+}
+
+// vp8lDistanceCodes 按图像宽度把短距离映射到距离码
+func vp8lDistanceCodes(w int) map[int]int {
+	codes := make(map[int]int, len(vp8lDistanceMap))
+	for i, c := range vp8lDistanceMap {
+		d := int(c>>4)*w + 8 - int(c&0xf)
+		if _, ok := codes[d]; d >= 1 && !ok {
+			codes[d] = i + 1
+		}
+	}
+	return codes
+}
+
+// vp8lPrefix 长度或距离的前缀码, 额外位数及额外位
+func vp8lPrefix(v int) (sym, n, extra int) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	hb := bits.Len(uint(d)) - 1
+	n = hb - 1
+	return 2*hb + d>>n&1, n, d & (1<<n - 1)
+}
+
+// applyCache 把命中颜色缓存的字面像素替换为缓存索引
+func applyCache(syms []vp8lSym, argb []uint32, cacheBits int) []vp8lSym {
+	if cacheBits == 0 {
+		return syms
+	}
+	cache := make([]uint32, 1<<cacheBits)
+	shift := 32 - cacheBits
+	out := make([]vp8lSym, len(syms))
+	p := 0
+	for i, s := range syms {
+		out[i] = s
+		if s.kind == symCopy {
+			for end := p + s.len; p < end; p++ {
+				cache[argb[p]*vp8lCacheMultiplier>>shift] = argb[p]
+			}
+			continue
+		}
+		c := argb[p]
+		k := c * vp8lCacheMultiplier >> shift
+		if cache[k] == c {
+			out[i] = vp8lSym{kind: symCache, argb: k}
+		}
+		cache[k] = c
+		p++
+	}
+	return out
+}
+
+// vp8lHist 绿 (含长度及缓存), 红, 蓝, alpha 及距离的符号频率, 以及额外位数
+type vp8lHist struct {
+	freq  [5][]int
+	extra int
+}
+
+func vp8lHistogram(syms []vp8lSym, cacheBits int) *vp8lHist {
+	h := new(vp8lHist)
+	cacheSize := 0
+	if cacheBits > 0 {
+		cacheSize = 1 << cacheBits
+	}
+	h.freq[0] = make([]int, 256+24+cacheSize)
+	for i := 1; i < 4; i++ {
+		h.freq[i] = make([]int, 256)
+	}
+	h.freq[4] = make([]int, 40)
+	for _, s := range syms {
+		switch s.kind {
+		case symLiteral:
+			h.freq[0][s.argb>>8&0xff]++
+			h.freq[1][s.argb>>16&0xff]++
+			h.freq[2][s.argb&0xff]++
+			h.freq[3][s.argb>>24]++
+		case symCache:
+			h.freq[0][256+24+s.argb]++
+		case symCopy:
+			sym, n, _ := vp8lPrefix(s.len)
+			h.freq[0][256+sym]++
+			h.extra += n
+			sym, n, _ = vp8lPrefix(s.dist)
+			h.freq[4][sym]++
+			h.extra += n
+		}
+	}
+	return h
+}
+
+// cost 按熵估计的位数
+func (h *vp8lHist) cost() float64 {
+	bits := float64(h.extra)
+	for _, freq := range h.freq {
+		total := 0
+		for _, f := range freq {
+			total += f
+		}
+		for _, f := range freq {
+			if f > 0 {
+				bits += float64(f) * math.Log2(float64(total)/float64(f))
+			}
+		}
+	}
+	return bits
+}
+
+// vp8lBits 按低位在前写入
+type vp8lBits struct {
+	out []byte
+	acc uint64
+	n   uint
+}
+
+func (b *vp8lBits) write(v uint32, n uint) {
+	b.acc |= uint64(v) << b.n
+	b.n += n
+	for b.n >= 8 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc >>= 8
+		b.n -= 8
+	}
+}
+
+func (b *vp8lBits) bytes() []byte {
+	if b.n > 0 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc, b.n = 0, 0
+	}
+	return b.out
+}
+
+// huffCode 规范 Huffman 码, codes 已按写入顺序反转
+type huffCode struct {
+	lengths []uint8
+	codes   []uint16
+	used    []int // 使用的符号
+}
+
+// newHuffCode 按频率生成码长不超过 limit 的规范 Huffman 码
+func newHuffCode(freq []int, limit int) huffCode {
+	c := huffCode{lengths: make([]uint8, len(freq)), codes: make([]uint16, len(freq))}
+	for s, f := range freq {
+		if f > 0 {
+			c.used = append(c.used, s)
+		}
+	}
+	if len(c.used) == 1 {
+		c.lengths[c.used[0]] = 1 // 写入码长为 1, 编码时不占位
+		return c
+	}
+	if len(c.used) == 0 {
+		return c
+	}
+	// 码长超出限制时提高低频符号的频率后重建, 与 libwebp 相同
+	for minCount := 1; ; minCount *= 2 {
+		if huffLengths(freq, c.used, minCount, c.lengths) <= limit {
+			break
+		}
+	}
+	var count [16]int
+	for _, s := range c.used {
+		count[c.lengths[s]]++
+	}
+	var next [16]int
+	code := 0
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for _, s := range c.used {
+		l := c.lengths[s]
+		c.codes[s] = uint16(bits.Reverse16(uint16(next[l])) >> (16 - l))
+		next[l]++
+	}
+	return c
+}
+
+// huffLengths 生成 Huffman 树并写入码长, 返回最大码长
+func huffLengths(freq []int, used []int, minCount int, lengths []uint8) int {
+	type node struct {
+		f      int
+		parent int
+	}
+	n := len(used)
+	leaves := append([]int(nil), used...)
+	f := func(s int) int { return max(freq[s], minCount) }
+	sort.SliceStable(leaves, func(i, j int) bool { return f(leaves[i]) < f(leaves[j]) })
+	nodes := make([]node, 2*n-1)
+	for i, s := range leaves {
+		nodes[i].f = f(s)
+	}
+	li, ii := 0, n
+	pick := func(next int) int {
+		if li < n && (ii >= next || nodes[li].f <= nodes[ii].f) {
+			li++
+			return li - 1
+		}
+		ii++
+		return ii - 1
+	}
+	for next := n; next < 2*n-1; next++ {
+		a := pick(next)
+		b := pick(next)
+		nodes[next].f = nodes[a].f + nodes[b].f
+		nodes[a].parent, nodes[b].parent = next, next
+	}
+	depth := make([]int, 2*n-1)
+	maxDepth := 0
+	for i := 2*n - 3; i >= 0; i-- {
+		depth[i] = depth[nodes[i].parent] + 1
+		if i < n {
+			lengths[leaves[i]] = uint8(min(depth[i], 255))
+			maxDepth = max(maxDepth, depth[i])
+		}
+	}
+	return maxDepth
+}
+
+// put 写入符号
+func (c *huffCode) put(b *vp8lBits, s int) {
+	if len(c.used) > 1 {
+		b.write(uint32(c.codes[s]), uint(c.lengths[s]))
+	}
+}
+
+// write 写入码长, 不超过两个小于 256 的符号时使用简单码
+func (c *huffCode) write(b *vp8lBits) {
+	if len(c.used) == 0 {
+		b.write(1, 1)
+		b.write(0, 1)
+		b.write(0, 1)
+		b.write(0, 1)
+		return
+	}
+	if len(c.used) <= 2 && c.used[len(c.used)-1] < 256 {
+		b.write(1, 1)
+		b.write(uint32(len(c.used)-1), 1)
+		if s := c.used[0]; s <= 1 {
+			b.write(0, 1)
+			b.write(uint32(s), 1)
+		} else {
+			b.write(1, 1)
+			b.write(uint32(s), 8)
+		}
+		if len(c.used) == 2 {
+			b.write(uint32(c.used[1]), 8)
+		}
+		return
+	}
+
+	// 码长按游程编码: 16 重复上一个非零码长 3-6 次, 17 及 18 分别重复 0 3-10 及 11-138 次
+	type token struct{ code, extra, n uint8 }
+	var tokens []token
+	for i := 0; i < len(c.lengths); {
+		v := c.lengths[i]
+		run := 1
+		for i+run < len(c.lengths) && c.lengths[i+run] == v {
+			run++
+		}
+		i += run
+		if v != 0 {
+			tokens = append(tokens, token{code: v})
+			run--
+			for ; run >= 3; run -= min(run, 6) {
+				tokens = append(tokens, token{16, uint8(min(run, 6) - 3), 2})
+			}
+		} else {
+			for run >= 3 {
+				if run >= 11 {
+					r := min(run, 138)
+					tokens = append(tokens, token{18, uint8(r - 11), 7})
+					run -= r
+				} else {
+					r := min(run, 10)
+					tokens = append(tokens, token{17, uint8(r - 3), 3})
+					run -= r
+				}
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, token{code: v})
+		}
+	}
+	freq := make([]int, 19)
+	for _, t := range tokens {
+		freq[t.code]++
+	}
+	cl := newHuffCode(freq, 7)
+	n := len(vp8lCodeOrder)
+	for n > 4 && cl.lengths[vp8lCodeOrder[n-1]] == 0 {
+		n--
+	}
+	b.write(0, 1)
+	b.write(uint32(n-4), 4)
+	for _, s := range vp8lCodeOrder[:n] {
+		b.write(uint32(cl.lengths[s]), 3)
+	}
+	b.write(0, 1) // 写入全部码长
+	for _, t := range tokens {
+		cl.put(b, int(t.code))
+		b.write(uint32(t.extra), uint(t.n))
+	}
+}